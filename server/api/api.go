@@ -4,13 +4,21 @@ import (
 	"embed"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/api/config"
 	"github.com/scarlettmiss/petJournal/api/middlewares"
 	"github.com/scarlettmiss/petJournal/application"
 	"github.com/scarlettmiss/petJournal/application/domain/pet"
 	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"github.com/scarlettmiss/petJournal/application/domain/session"
+	"github.com/scarlettmiss/petJournal/application/domain/token"
 	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/application/domain/usertoken"
 	"github.com/scarlettmiss/petJournal/application/services"
+	jwtUtils "github.com/scarlettmiss/petJournal/utils/jwt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type API struct {
@@ -18,7 +26,7 @@ type API struct {
 	app application.Application
 }
 
-func New(application application.Application, ui embed.FS) *API {
+func New(application application.Application, ui embed.FS, queryTimeout time.Duration) *API {
 	api := &API{
 		Engine: gin.Default(),
 		app:    application,
@@ -32,26 +40,53 @@ func New(application application.Application, ui embed.FS) *API {
 	//api.Use(cors.New(config))
 
 	api.NoRoute(middlewares.NoRouteMiddleware("/", ui, "public"))
+	api.Use(middlewares.Timeout(queryTimeout))
 
 	api.POST("/api/auth/register", api.register)
 	api.POST("/api/auth/login", api.login)
+	api.POST("/api/auth/restore", api.restoreUser)
+	api.POST("/api/auth/refresh", api.refresh)
+	api.POST("/api/auth/forgot", api.forgotPassword)
+	api.POST("/api/auth/reset", api.resetPassword)
+	api.POST("/api/auth/verify", api.verifyEmail)
+	api.POST("/api/auth/2fa", api.completeLogin)
 	api.GET("/api/vets", api.vets)
+	api.GET("/.well-known/jwks.json", api.jwks)
 
-	userApi := api.Group("/").Use(middlewares.Auth())
-	userApi.GET("/api/users", api.users)
+	userApi := api.Group("/").Use(middlewares.Auth(application.SessionActive))
+	userApi.POST("/api/auth/logout", api.logout)
 	userApi.GET("/api/user", api.user)
 	userApi.GET("/api/user/:id", api.user)
 	userApi.PATCH("/api/user", api.updateUser)
 	userApi.DELETE("/api/user", api.deleteUser)
-
-	petApi := api.Group("/").Use(middlewares.Auth())
+	userApi.PATCH("/api/user/password", api.changePassword)
+	userApi.POST("/api/user/verify", api.resendVerification)
+	userApi.POST("/api/user/2fa", api.enrollTOTP)
+	userApi.POST("/api/user/2fa/confirm", api.confirmTOTP)
+	userApi.POST("/api/user/2fa/disable", api.disableTOTP)
+	userApi.GET("/api/user/sessions", api.sessions)
+	userApi.DELETE("/api/user/sessions", api.revokeSessions)
+	userApi.DELETE("/api/user/sessions/:sessionId", api.revokeSession)
+	userApi.GET("/api/trash", api.trash)
+
+	adminApi := api.Group("/").Use(middlewares.Auth(application.SessionActive), middlewares.Role(user.Admin))
+	adminApi.GET("/api/users", api.users)
+	adminApi.POST("/api/users/:id/disable", api.disableUser)
+	adminApi.POST("/api/users/:id/enable", api.enableUser)
+	adminApi.POST("/api/users/:id/unlock", api.unlockAccount)
+	adminApi.GET("/api/vets/pending", api.pendingVets)
+	adminApi.POST("/api/users/:id/license/approve", api.approveVet)
+	adminApi.POST("/api/users/:id/license/reject", api.rejectVet)
+
+	petApi := api.Group("/").Use(middlewares.Auth(application.SessionActive))
 	petApi.POST("/api/pet", api.createPet)
 	petApi.GET("/api/pets", api.pets)
 	petApi.GET("/api/pet/:petId", api.pet)
 	petApi.PATCH("/api/pet/:petId", api.updatePet)
 	petApi.DELETE("/api/pet/:petId", api.deletePet)
+	petApi.POST("/api/pet/:petId/restore", api.restorePet)
 
-	recordApi := api.Group("/").Use(middlewares.Auth())
+	recordApi := api.Group("/").Use(middlewares.Auth(application.SessionActive))
 	recordApi.POST("/api/pet/:petId/record", api.createRecord)
 	recordApi.POST("/api/pet/:petId/records", api.createRecords)
 	recordApi.GET("/api/pet/:petId/records", api.recordsByPet)
@@ -59,6 +94,8 @@ func New(application application.Application, ui embed.FS) *API {
 	recordApi.GET("/api/pet/:petId/record/:recordId", api.recordByPet)
 	recordApi.PATCH("/api/pet/:petId/record/:recordId", api.updateRecord)
 	recordApi.DELETE("/api/pet/:petId/record/:recordId", api.deleteRecord)
+	recordApi.POST("/api/pet/:petId/record/:recordId/restore", api.restoreRecord)
+	recordApi.GET("/api/pet/:petId/record/:recordId/history", api.recordHistory)
 
 	return api
 }
@@ -67,91 +104,831 @@ func (api *API) errorResponse(err error) map[string]any {
 	return map[string]any{
 		"error": err.Error(),
 	}
-}
+}
+
+func (api *API) tokensResponse(tokens services.Tokens) gin.H {
+	return gin.H{
+		"token":        tokens.AccessToken,
+		"expiresAt":    tokens.ExpiresAt.UnixMilli(),
+		"refreshToken": tokens.RefreshToken,
+	}
+}
+
+// challengeResponse tells the client to finish the login with a second factor
+func (api *API) challengeResponse(challenge services.Challenge) gin.H {
+	return gin.H{
+		"challenge":          challenge.Token,
+		"challengeExpiresAt": challenge.ExpiresAt.UnixMilli(),
+	}
+}
+
+// sessionOptions describe the device the request comes from
+func (api *API) sessionOptions(c *gin.Context) services.SessionOptions {
+	return services.SessionOptions{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+func (api *API) register(c *gin.Context) {
+	var requestBody UserCreateRequest
+	err := c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	uOpts := UserCreateRequestToUserCreateOptions(requestBody)
+	uOpts.Session = api.sessionOptions(c)
+	u, tokens, err := api.app.CreateUser(c.Request.Context(), uOpts)
+	if err != nil {
+		switch err {
+		case user.ErrUserDeleted,
+			user.ErrNoValidType,
+			user.ErrNoValidMail,
+			user.ErrMailExists,
+			user.ErrNoValidName,
+			user.ErrNoValidSurname,
+			user.ErrNoValidLicense,
+			user.ErrPasswordLength,
+			user.ErrPasswordLowerCase,
+			user.ErrPasswordUpperCase,
+			user.ErrPasswordDigit,
+			user.ErrPasswordSpecialChar:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+		}
+		return
+	}
+
+	resp := api.tokensResponse(tokens)
+	resp["user"] = PrivateUserToResponse(u)
+	c.JSON(http.StatusCreated, resp)
+}
+
+// users lists the users matching the q, type and deleted query parameters
+func (api *API) users(c *gin.Context) {
+	query := services.UserQuery{Text: c.Query("q")}
+
+	if t := c.Query("type"); t != "" {
+		typ, err := user.ParseType(t)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, api.errorResponse(user.ErrNoValidType))
+			return
+		}
+		query.Type = typ
+	}
+
+	if d := c.Query("deleted"); d != "" {
+		includeDel, err := strconv.ParseBool(d)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+			return
+		}
+		query.IncludeDel = includeDel
+	}
+
+	query.Limit = config.UsersPageSize
+	if l := c.Query("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > config.MaxUsersPageSize {
+			c.JSON(http.StatusBadRequest, api.errorResponse(user.ErrNoValidPage))
+			return
+		}
+		query.Limit = limit
+	}
+
+	if o := c.Query("offset"); o != "" {
+		offset, err := strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, api.errorResponse(user.ErrNoValidPage))
+			return
+		}
+		query.Offset = offset
+	}
+
+	users, err := api.app.SearchUsers(c.Request.Context(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	usersResp := make([]*UserResponse, 0, len(users))
+	for _, u := range users {
+		userResponse := PrivateUserToResponse(u)
+		usersResp = append(usersResp, userResponse)
+	}
+
+	c.JSON(http.StatusOK, usersResp)
+}
+
+func (api *API) disableUser(c *gin.Context) {
+	adminId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	uId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	u, err := api.app.DisableUser(c.Request.Context(), adminId, uId)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrDisableSelf:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, PrivateUserToResponse(u))
+}
+
+func (api *API) enableUser(c *gin.Context) {
+	uId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	u, err := api.app.EnableUser(c.Request.Context(), uId)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, PrivateUserToResponse(u))
+}
+
+func (api *API) unlockAccount(c *gin.Context) {
+	uId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	err = api.app.UnlockAccount(c.Request.Context(), uId)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account unlocked"})
+}
+
+func (api *API) pendingVets(c *gin.Context) {
+	vets, err := api.app.PendingVets(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	vetsResp := make([]*UserResponse, 0, len(vets))
+	for _, v := range vets {
+		vetsResp = append(vetsResp, PrivateUserToResponse(v))
+	}
+
+	c.JSON(http.StatusOK, vetsResp)
+}
+
+func (api *API) approveVet(c *gin.Context) {
+	api.reviewVet(c, true)
+}
+
+func (api *API) rejectVet(c *gin.Context) {
+	api.reviewVet(c, false)
+}
+
+func (api *API) reviewVet(c *gin.Context, approve bool) {
+	adminId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	vetId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	var v user.User
+	if approve {
+		v, err = api.app.ApproveVet(c.Request.Context(), adminId, vetId)
+	} else {
+		// the note is optional, and so is the body
+		var requestBody LicenseRejectRequest
+		err = c.ShouldBindJSON(&requestBody)
+		if err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+			return
+		}
+
+		v, err = api.app.RejectVet(c.Request.Context(), adminId, vetId, requestBody.Note)
+	}
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrLicenseNotPending:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, PrivateUserToResponse(v))
+}
+
+// jwks publishes the public keys that the access tokens are signed with, for
+// the services that verify them
+func (api *API) jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwtUtils.PublicKeys())
+}
+
+func (api *API) vets(c *gin.Context) {
+	users, err := api.app.Vets(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+		return
+	}
+
+	usersResp := make([]*UserResponse, 0, len(users))
+	for _, u := range users {
+		userResponse := UserToResponse(u)
+		usersResp = append(usersResp, userResponse)
+	}
+
+	c.JSON(http.StatusOK, usersResp)
+}
+
+func (api *API) user(c *gin.Context) {
+	id := c.Param("id")
+
+	if id == "" {
+		id = c.GetString("UserId")
+	}
+
+	//parse
+	uId, err := uuid.Parse(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	u, err := api.app.User(c.Request.Context(), uId)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	// the other users only get the public fields
+	if u.Id.String() != c.GetString("UserId") {
+		c.JSON(http.StatusOK, UserToResponse(u))
+		return
+	}
+
+	resp := PrivateUserToResponse(u)
+	resp.TwoFactor = &u.TOTPEnabled
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *API) updateUser(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	var requestBody UserUpdateRequest
+	err = c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	uOpts := UserUpdateRequestToUserOptions(requestBody, uId)
+
+	u, err := api.app.UpdateUser(c.Request.Context(), uOpts, false)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		case user.ErrNoValidType,
+			user.ErrNoValidMail,
+			user.ErrMailExists,
+			user.ErrNoValidName,
+			user.ErrNoValidSurname:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, PrivateUserToResponse(u))
+}
+
+func (api *API) deleteUser(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	err = api.app.DeleteUser(c.Request.Context(), uId)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrConflict, pet.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
+}
+
+func (api *API) login(c *gin.Context) {
+	var requestBody LoginRequest
+
+	err := c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	loginOpts := services.LoginOptions{
+		Email:    requestBody.Email,
+		Password: requestBody.Password,
+		Session:  api.sessionOptions(c),
+	}
+
+	u, tokens, challenge, err := api.app.Authenticate(c.Request.Context(), loginOpts)
+	if err != nil {
+		switch err {
+		case user.ErrUserDeleted:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case user.ErrAccountLocked:
+			c.JSON(http.StatusTooManyRequests, api.errorResponse(err))
+		case user.ErrUserDisabled:
+			c.JSON(http.StatusForbidden, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		}
+		return
+	}
+
+	if challenge.Token != "" {
+		c.JSON(http.StatusOK, api.challengeResponse(challenge))
+		return
+	}
+
+	resp := api.tokensResponse(tokens)
+	resp["user"] = PrivateUserToResponse(u)
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *API) restoreUser(c *gin.Context) {
+	var requestBody LoginRequest
+
+	err := c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	loginOpts := services.LoginOptions{
+		Email:    requestBody.Email,
+		Password: requestBody.Password,
+		Session:  api.sessionOptions(c),
+	}
+
+	u, tokens, challenge, err := api.app.RestoreUser(c.Request.Context(), loginOpts)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound, user.ErrAuthentication:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		case user.ErrNotDeleted:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case user.ErrRestoreExpired:
+			c.JSON(http.StatusGone, api.errorResponse(err))
+		case user.ErrAccountLocked:
+			c.JSON(http.StatusTooManyRequests, api.errorResponse(err))
+		case user.ErrUserDisabled:
+			c.JSON(http.StatusForbidden, api.errorResponse(err))
+		case user.ErrConflict, pet.ErrConflict, record.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	if challenge.Token != "" {
+		c.JSON(http.StatusOK, api.challengeResponse(challenge))
+		return
+	}
+
+	resp := api.tokensResponse(tokens)
+	resp["user"] = PrivateUserToResponse(u)
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *API) completeLogin(c *gin.Context) {
+	var requestBody TwoFactorLoginRequest
+	err := c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	u, tokens, err := api.app.CompleteLogin(c.Request.Context(), services.ChallengeOptions{
+		Challenge: requestBody.Challenge,
+		Code:      requestBody.Code,
+		Session:   api.sessionOptions(c),
+	})
+	if err != nil {
+		switch err {
+		case user.ErrChallengeInvalid, user.ErrTOTPCode:
+			c.JSON(http.StatusUnauthorized, api.errorResponse(err))
+		case user.ErrUserDeleted:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case user.ErrAccountLocked:
+			c.JSON(http.StatusTooManyRequests, api.errorResponse(err))
+		case user.ErrUserDisabled:
+			c.JSON(http.StatusForbidden, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	resp := api.tokensResponse(tokens)
+	resp["user"] = PrivateUserToResponse(u)
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *API) refresh(c *gin.Context) {
+	var requestBody RefreshRequest
+
+	err := c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	tokens, err := api.app.Refresh(c.Request.Context(), requestBody.RefreshToken)
+	if err != nil {
+		switch err {
+		case token.ErrNotFound, token.ErrExpired, token.ErrRevoked, token.ErrReused,
+			session.ErrNotFound, session.ErrRevoked, user.ErrNotFound, user.ErrUserDeleted, user.ErrUserDisabled:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, api.tokensResponse(tokens))
+}
+
+func (api *API) logout(c *gin.Context) {
+	sId, err := uuid.Parse(c.GetString("SessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	err = api.app.Logout(c.Request.Context(), sId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+func (api *API) changePassword(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	sId, err := uuid.Parse(c.GetString("SessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	var requestBody PasswordChangeRequest
+	err = c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	err = api.app.ChangePassword(c.Request.Context(), services.PasswordChangeOptions{
+		UserId:          uId,
+		CurrentPassword: requestBody.CurrentPassword,
+		Password:        requestBody.Password,
+		SessionId:       sId,
+	})
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		case user.ErrAccountLocked:
+			c.JSON(http.StatusTooManyRequests, api.errorResponse(err))
+		case user.ErrAuthentication,
+			user.ErrPasswordLength,
+			user.ErrPasswordLowerCase,
+			user.ErrPasswordUpperCase,
+			user.ErrPasswordDigit,
+			user.ErrPasswordSpecialChar:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password changed"})
+}
+
+// forgotPassword answers the same whether the email belongs to a user or not
+func (api *API) forgotPassword(c *gin.Context) {
+	var requestBody PasswordForgotRequest
+	err := c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	err = api.app.RequestPasswordReset(c.Request.Context(), requestBody.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "if the email belongs to an account, a reset link was sent to it"})
+}
+
+func (api *API) resetPassword(c *gin.Context) {
+	var requestBody PasswordResetRequest
+	err := c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	err = api.app.ResetPassword(c.Request.Context(), services.PasswordResetOptions{
+		Token:    requestBody.Token,
+		Password: requestBody.Password,
+	})
+	if err != nil {
+		switch err {
+		case usertoken.ErrNotFound, usertoken.ErrExpired, usertoken.ErrUsed,
+			user.ErrNotFound, user.ErrUserDeleted:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		case user.ErrPasswordLength,
+			user.ErrPasswordLowerCase,
+			user.ErrPasswordUpperCase,
+			user.ErrPasswordDigit,
+			user.ErrPasswordSpecialChar:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset"})
+}
+
+func (api *API) verifyEmail(c *gin.Context) {
+	var requestBody VerifyEmailRequest
+	err := c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	u, err := api.app.VerifyEmail(c.Request.Context(), requestBody.Token)
+	if err != nil {
+		switch err {
+		case user.ErrVerificationInvalid, user.ErrAlreadyVerified, user.ErrUserDeleted:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, PrivateUserToResponse(u))
+}
+
+func (api *API) resendVerification(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	err = api.app.ResendVerification(c.Request.Context(), uId)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrAlreadyVerified, user.ErrUserDeleted:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
+}
+
+func (api *API) enrollTOTP(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	enrollment, err := api.app.EnrollTOTP(c.Request.Context(), uId)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrTOTPEnabled:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPEnrollmentResponse{Secret: enrollment.Secret, URI: enrollment.URI})
+}
+
+func (api *API) confirmTOTP(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	var requestBody TOTPCodeRequest
+	err = c.ShouldBindJSON(&requestBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	codes, err := api.app.ConfirmTOTP(c.Request.Context(), uId, requestBody.Code)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrTOTPEnabled, user.ErrTOTPNotEnrolled, user.ErrTOTPCode:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (api *API) disableTOTP(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
 
-func (api *API) register(c *gin.Context) {
-	var requestBody UserCreateRequest
-	err := c.ShouldBindJSON(&requestBody)
+	var requestBody TOTPCodeRequest
+	err = c.ShouldBindJSON(&requestBody)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		return
 	}
 
-	uOpts := UserCreateRequestToUserCreateOptions(requestBody)
-	u, token, err := api.app.CreateUser(uOpts)
+	err = api.app.DisableTOTP(c.Request.Context(), uId, requestBody.Code)
 	if err != nil {
 		switch err {
-		case user.ErrUserDeleted,
-			user.ErrNoValidType,
-			user.ErrNoValidMail,
-			user.ErrMailExists,
-			user.ErrNoValidName,
-			user.ErrNoValidSurname,
-			user.ErrPasswordLength,
-			user.ErrPasswordLowerCase,
-			user.ErrPasswordUpperCase,
-			user.ErrPasswordDigit,
-			user.ErrPasswordSpecialChar:
+		case user.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case user.ErrTOTPNotEnabled, user.ErrTOTPCode:
 			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case user.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		case user.ErrAccountLocked:
+			c.JSON(http.StatusTooManyRequests, api.errorResponse(err))
 		default:
-			c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		}
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"user": UserToResponse(u), "token": token})
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
 }
 
-func (api *API) users(c *gin.Context) {
-	users, err := api.app.Users(true)
+func (api *API) sessions(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		return
 	}
 
-	usersResp := make([]*UserResponse, 0, len(users))
-	for _, u := range users {
-		userResponse := UserToResponse(u)
-		usersResp = append(usersResp, userResponse)
+	sId, err := uuid.Parse(c.GetString("SessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
 	}
 
-	c.JSON(http.StatusOK, usersResp)
-}
-
-func (api *API) vets(c *gin.Context) {
-	users, err := api.app.UsersByType(user.Vet, false)
+	sessions, err := api.app.Sessions(c.Request.Context(), uId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	usersResp := make([]*UserResponse, 0, len(users))
-	for _, u := range users {
-		userResponse := UserToResponse(u)
-		usersResp = append(usersResp, userResponse)
+	sessionsResp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		sessionsResp = append(sessionsResp, SessionToResponse(s, sId))
 	}
 
-	c.JSON(http.StatusOK, usersResp)
+	c.JSON(http.StatusOK, sessionsResp)
 }
 
-func (api *API) user(c *gin.Context) {
-	id := c.Param("id")
-
-	if id == "" {
-		id = c.GetString("UserId")
+func (api *API) revokeSession(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
 	}
 
-	//parse
-	uId, err := uuid.Parse(id)
+	sId, err := uuid.Parse(c.Param("sessionId"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		return
 	}
 
-	u, err := api.app.User(uId)
+	err = api.app.RevokeSession(c.Request.Context(), uId, sId)
 	if err != nil {
 		switch err {
-		case user.ErrNotFound:
+		case session.ErrNotFound:
 			c.JSON(http.StatusNotFound, api.errorResponse(err))
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -159,89 +936,59 @@ func (api *API) user(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, UserToResponse(u))
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
 }
 
-func (api *API) updateUser(c *gin.Context) {
+// revokeSessions logs the user out everywhere but on the device of the request
+func (api *API) revokeSessions(c *gin.Context) {
 	uId, err := uuid.Parse(c.GetString("UserId"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		return
 	}
 
-	var requestBody UserUpdateRequest
-	err = c.ShouldBindJSON(&requestBody)
+	sId, err := uuid.Parse(c.GetString("SessionId"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		return
 	}
 
-	uOpts := UserUpdateRequestToUserOptions(requestBody, uId)
-
-	u, err := api.app.UpdateUser(uOpts, false)
+	err = api.app.RevokeSessions(c.Request.Context(), uId, sId)
 	if err != nil {
-		switch err {
-		case user.ErrNotFound:
-			c.JSON(http.StatusNotFound, api.errorResponse(err))
-		case user.ErrNoValidType,
-			user.ErrNoValidMail,
-			user.ErrMailExists,
-			user.ErrNoValidName,
-			user.ErrNoValidSurname:
-			c.JSON(http.StatusBadRequest, api.errorResponse(err))
-		default:
-			c.JSON(http.StatusInternalServerError, api.errorResponse(err))
-		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, UserToResponse(u))
+	c.JSON(http.StatusOK, gin.H{"message": "sessions revoked"})
 }
 
-func (api *API) deleteUser(c *gin.Context) {
+func (api *API) trash(c *gin.Context) {
 	uId, err := uuid.Parse(c.GetString("UserId"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		return
 	}
 
-	err = api.app.DeleteUser(uId)
+	pets, records, err := api.app.Trash(c.Request.Context(), uId)
 	if err != nil {
-		switch err {
-		case user.ErrNotFound:
-			c.JSON(http.StatusNotFound, api.errorResponse(err))
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
-}
-
-func (api *API) login(c *gin.Context) {
-	var requestBody LoginRequest
-
-	err := c.ShouldBindJSON(&requestBody)
+	l := api.newLoader()
+	petsResp, err := l.petsResponse(c.Request.Context(), pets)
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	loginOpts := services.LoginOptions{Email: requestBody.Email, Password: requestBody.Password}
-
-	u, token, err := api.app.Authenticate(loginOpts)
+	recordsResp, err := l.recordsResponse(c.Request.Context(), records)
 	if err != nil {
-		if err == user.ErrUserDeleted {
-			c.JSON(http.StatusBadRequest, api.errorResponse(err))
-			return
-		}
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user": UserToResponse(u), "token": token})
-
+	c.JSON(http.StatusOK, TrashResponse{Pets: petsResp, Records: recordsResp})
 }
 
 func (api *API) createPet(c *gin.Context) {
@@ -264,24 +1011,25 @@ func (api *API) createPet(c *gin.Context) {
 		return
 	}
 
-	p, err := api.app.CreatePet(opts)
+	p, err := api.app.CreatePet(c.Request.Context(), opts)
 	if err != nil {
 		switch err {
-		case pet.ErrNoValidName, pet.ErrNoValidBreedname, pet.ErrNoValidBirthDate:
+		case pet.ErrNoValidName, pet.ErrNoValidBreedname, pet.ErrNoValidBirthDate,
+			user.ErrNotFound, user.ErrVetNotVerified:
 			c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		}
 		return
 	}
-	owner, vet, err := api.ownerVetResponse(p)
+	resp, err := api.newLoader().petResponse(c.Request.Context(), p)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 
 		return
 	}
 
-	c.JSON(http.StatusCreated, PetToResponse(p, owner, vet))
+	c.JSON(http.StatusCreated, resp)
 }
 
 func (api *API) pets(c *gin.Context) {
@@ -291,25 +1039,14 @@ func (api *API) pets(c *gin.Context) {
 		return
 	}
 
-	pets, err := api.app.PetsByUser(uId, false)
+	pets, err := api.app.PetsByUser(c.Request.Context(), uId, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, api.errorResponse(err))
 		return
 	}
 
-	petsResp := make([]PetResponse, 0, len(pets))
-	var hasError bool
-	for _, p := range pets {
-		owner, vet, err := api.ownerVetResponse(p)
-		if err != nil {
-			hasError = true
-		}
-
-		petResponse := PetToResponse(p, owner, vet)
-		petsResp = append(petsResp, petResponse)
-	}
-
-	if hasError {
+	petsResp, err := api.newLoader().petsResponse(c.Request.Context(), pets)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
@@ -337,7 +1074,7 @@ func (api *API) pet(c *gin.Context) {
 		return
 	}
 
-	p, err := api.app.PetByUser(uId, pId, false)
+	p, err := api.app.PetByUser(c.Request.Context(), uId, pId, false)
 	if err != nil {
 		switch err {
 		case pet.ErrNotFound:
@@ -348,13 +1085,13 @@ func (api *API) pet(c *gin.Context) {
 		return
 	}
 
-	owner, vet, err := api.ownerVetResponse(p)
+	resp, err := api.newLoader().petResponse(c.Request.Context(), p)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, PetToResponse(p, owner, vet))
+	c.JSON(http.StatusOK, resp)
 }
 
 func (api *API) updatePet(c *gin.Context) {
@@ -389,14 +1126,18 @@ func (api *API) updatePet(c *gin.Context) {
 		return
 	}
 
-	p, err := api.app.UpdatePet(opts)
+	p, err := api.app.UpdatePet(c.Request.Context(), opts)
 	if err != nil {
 		switch err {
 		case pet.ErrNotFound:
 			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case pet.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
 		case pet.ErrNoValidName,
 			pet.ErrNoValidBreedname,
-			pet.ErrNoValidBirthDate:
+			pet.ErrNoValidBirthDate,
+			user.ErrNotFound,
+			user.ErrVetNotVerified:
 			c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -404,30 +1145,46 @@ func (api *API) updatePet(c *gin.Context) {
 		return
 	}
 
-	owner, vet, err := api.ownerVetResponse(p)
+	resp, err := api.newLoader().petResponse(c.Request.Context(), p)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, PetToResponse(p, owner, vet))
+	c.JSON(http.StatusOK, resp)
 }
 
-func (api *API) ownerVetResponse(p pet.Pet) (user.User, user.User, error) {
-	owner, err := api.app.User(p.OwnerId)
+func (api *API) deletePet(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	id := c.Param("petId")
+	pId, err := uuid.Parse(id)
 	if err != nil {
-		return user.Nil, user.Nil, err
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
 	}
 
-	vet, err := api.app.UserByType(p.VetId, user.Vet, false)
-	if err != nil && err != user.ErrNotFound {
-		return user.Nil, user.Nil, err
+	err = api.app.DeletePet(c.Request.Context(), uId, pId)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound, pet.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case pet.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
 	}
 
-	return owner, vet, nil
+	c.JSON(http.StatusOK, gin.H{"message": "pet deleted"})
 }
 
-func (api *API) deletePet(c *gin.Context) {
+func (api *API) restorePet(c *gin.Context) {
 	uId, err := uuid.Parse(c.GetString("UserId"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, api.errorResponse(err))
@@ -441,18 +1198,30 @@ func (api *API) deletePet(c *gin.Context) {
 		return
 	}
 
-	err = api.app.DeletePet(uId, pId)
+	p, err := api.app.RestorePet(c.Request.Context(), uId, pId)
 	if err != nil {
 		switch err {
-		case user.ErrNotFound, pet.ErrNotFound:
+		case pet.ErrNotFound:
 			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case pet.ErrNotDeleted:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case pet.ErrRestoreExpired:
+			c.JSON(http.StatusGone, api.errorResponse(err))
+		case pet.ErrConflict, record.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "pet deleted"})
+	resp, err := api.newLoader().petResponse(c.Request.Context(), p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 func (api *API) createRecord(c *gin.Context) {
@@ -469,7 +1238,7 @@ func (api *API) createRecord(c *gin.Context) {
 		return
 	}
 
-	u, err := api.app.User(uId)
+	u, err := api.app.User(c.Request.Context(), uId)
 	if err != nil {
 		switch err {
 		case user.ErrNotFound:
@@ -488,20 +1257,21 @@ func (api *API) createRecord(c *gin.Context) {
 	}
 
 	opts := RecordCreateRequestToRecord(requestBody, petId, u)
-	r, err := api.app.CreateRecord(opts)
+	r, err := api.app.CreateRecord(c.Request.Context(), opts)
 	if err != nil {
 		switch err {
 		case record.ErrNotFound:
 			c.JSON(http.StatusNotFound, api.errorResponse(err))
 		case pet.ErrNotFound, record.ErrNotValidType, record.ErrNotValidResult,
-			record.ErrNotValidName, record.ErrNotValidDate, record.ErrNotValidVerifier:
+			record.ErrNotValidName, record.ErrNotValidDate, record.ErrNotValidVerifier, user.ErrVetNotApproved:
 			c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		default:
 			c.JSON(http.StatusInternalServerError, api.errorResponse(err))
 		}
+		return
 	}
 
-	p, err := api.app.Pet(r.PetId)
+	resp, err := api.newLoader().recordResponse(c.Request.Context(), r)
 	if err != nil {
 		switch err {
 		case pet.ErrNotFound:
@@ -512,45 +1282,7 @@ func (api *API) createRecord(c *gin.Context) {
 		return
 	}
 
-	administer, err := api.app.User(r.AdministeredBy)
-	if err != nil && err != user.ErrNotFound {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	verifier, err := api.app.User(r.VerifiedBy)
-	if err != nil && err != user.ErrNotFound {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, RecordToResponse(r, p, administer, verifier))
-}
-
-func (api *API) recordsToRecordsResponse(records map[uuid.UUID]record.Record) ([]RecordResponse, bool) {
-	hasError := false
-	recordsResp := make([]RecordResponse, 0, len(records))
-	for _, r := range records {
-		administer, err := api.app.User(r.AdministeredBy)
-		if err != nil && err != user.ErrNotFound {
-			hasError = true
-		}
-
-		verifier, err := api.app.User(r.VerifiedBy)
-		if err != nil && err != user.ErrNotFound {
-			hasError = true
-		}
-
-		p, err := api.app.Pet(r.PetId)
-		if err != nil {
-			hasError = true
-		}
-
-		recordResponse := RecordToResponse(r, p, administer, verifier)
-		recordsResp = append(recordsResp, recordResponse)
-	}
-
-	return recordsResp, !hasError
+	c.JSON(http.StatusCreated, resp)
 }
 
 func (api *API) createRecords(c *gin.Context) {
@@ -567,7 +1299,7 @@ func (api *API) createRecords(c *gin.Context) {
 		return
 	}
 
-	u, err := api.app.User(uId)
+	u, err := api.app.User(c.Request.Context(), uId)
 	if err != nil {
 		switch err {
 		case user.ErrNotFound:
@@ -586,15 +1318,23 @@ func (api *API) createRecords(c *gin.Context) {
 	}
 
 	opts := RecordsCreateRequestToRecord(requestBody, petId, u)
-	records, err := api.app.CreateRecords(opts)
+	records, err := api.app.CreateRecords(c.Request.Context(), opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+		switch err {
+		case pet.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case record.ErrNotValidType, record.ErrNotValidResult,
+			record.ErrNotValidName, record.ErrNotValidDate, record.ErrNotValidVerifier, user.ErrVetNotApproved:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+		}
 		return
 	}
 
-	recordsResp, ok := api.recordsToRecordsResponse(records)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+	recordsResp, err := api.newLoader().recordsResponse(c.Request.Context(), records)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
@@ -615,7 +1355,7 @@ func (api *API) recordsByPet(c *gin.Context) {
 		return
 	}
 
-	records, err := api.app.RecordsByUserPet(uId, petId, false)
+	records, err := api.app.RecordsByUserPet(c.Request.Context(), uId, petId, false)
 	if err != nil {
 		switch err {
 		case pet.ErrNotFound:
@@ -626,9 +1366,9 @@ func (api *API) recordsByPet(c *gin.Context) {
 		return
 	}
 
-	recordsResp, ok := api.recordsToRecordsResponse(records)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+	recordsResp, err := api.newLoader().recordsResponse(c.Request.Context(), records)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
@@ -642,15 +1382,15 @@ func (api *API) records(c *gin.Context) {
 		return
 	}
 
-	records, err := api.app.RecordsByUser(uId, false)
+	records, err := api.app.RecordsByUser(c.Request.Context(), uId, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	recordsResp, ok := api.recordsToRecordsResponse(records)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+	recordsResp, err := api.newLoader().recordsResponse(c.Request.Context(), records)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
@@ -678,7 +1418,7 @@ func (api *API) recordByPet(c *gin.Context) {
 		return
 	}
 
-	r, err := api.app.RecordByUserPet(uId, petId, recordId, false)
+	r, err := api.app.RecordByUserPet(c.Request.Context(), uId, petId, recordId, false)
 	if err != nil {
 		switch err {
 		case pet.ErrNotFound, record.ErrNotFound:
@@ -689,7 +1429,7 @@ func (api *API) recordByPet(c *gin.Context) {
 		return
 	}
 
-	p, err := api.app.Pet(r.PetId)
+	resp, err := api.newLoader().recordResponse(c.Request.Context(), r)
 	if err != nil {
 		switch err {
 		case pet.ErrNotFound:
@@ -700,19 +1440,7 @@ func (api *API) recordByPet(c *gin.Context) {
 		return
 	}
 
-	administer, err := api.app.User(r.AdministeredBy)
-	if err != nil && err != user.ErrNotFound {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	verifier, err := api.app.User(r.VerifiedBy)
-	if err != nil && err != user.ErrNotFound {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	c.JSON(http.StatusOK, RecordToResponse(r, p, administer, verifier))
+	c.JSON(http.StatusOK, resp)
 }
 
 func (api *API) updateRecord(c *gin.Context) {
@@ -736,20 +1464,22 @@ func (api *API) updateRecord(c *gin.Context) {
 		return
 	}
 
-	u, err := api.app.User(uId)
+	u, err := api.app.User(c.Request.Context(), uId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, api.errorResponse(err))
 		return
 	}
 
 	opts := RecordUpdateRequestToRecord(requestBody, recordId, u)
-	r, err := api.app.UpdateRecord(opts)
+	r, err := api.app.UpdateRecord(c.Request.Context(), opts)
 	if err != nil {
 		switch err {
 		case record.ErrNotFound:
 			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case record.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
 		case record.ErrNotValidType, record.ErrNotValidResult,
-			record.ErrNotValidName, record.ErrNotValidDate, record.ErrNotValidVerifier:
+			record.ErrNotValidName, record.ErrNotValidDate, record.ErrNotValidVerifier, user.ErrVetNotApproved:
 			c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		default:
 			c.JSON(http.StatusInternalServerError, api.errorResponse(err))
@@ -757,7 +1487,7 @@ func (api *API) updateRecord(c *gin.Context) {
 		return
 	}
 
-	p, err := api.app.Pet(r.PetId)
+	resp, err := api.newLoader().recordResponse(c.Request.Context(), r)
 	if err != nil {
 		switch err {
 		case pet.ErrNotFound:
@@ -768,22 +1498,45 @@ func (api *API) updateRecord(c *gin.Context) {
 		return
 	}
 
-	administer, err := api.app.User(r.AdministeredBy)
-	if err != nil && err != user.ErrNotFound {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *API) deleteRecord(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
 		return
 	}
 
-	verifier, err := api.app.User(r.VerifiedBy)
-	if err != nil && err != user.ErrNotFound {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	rId := c.Param("recordId")
+	recordId, err := uuid.Parse(rId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	pId := c.Param("petId")
+	petId, err := uuid.Parse(pId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	err = api.app.DeleteRecordUserPet(c.Request.Context(), uId, petId, recordId)
+	if err != nil {
+		switch err {
+		case pet.ErrNotFound, user.ErrNotFound, record.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, RecordToResponse(r, p, administer, verifier))
+	c.JSON(http.StatusOK, gin.H{"message": "record deleted"})
 }
 
-func (api *API) deleteRecord(c *gin.Context) {
+func (api *API) restoreRecord(c *gin.Context) {
 	uId, err := uuid.Parse(c.GetString("UserId"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, api.errorResponse(err))
@@ -804,16 +1557,69 @@ func (api *API) deleteRecord(c *gin.Context) {
 		return
 	}
 
-	err = api.app.DeleteRecordUserPet(uId, petId, recordId)
+	r, err := api.app.RestoreRecordUserPet(c.Request.Context(), uId, petId, recordId)
 	if err != nil {
 		switch err {
-		case pet.ErrNotFound, user.ErrNotFound, record.ErrNotFound:
+		case pet.ErrNotFound, record.ErrNotFound:
 			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		case record.ErrNotDeleted:
+			c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		case record.ErrRestoreExpired:
+			c.JSON(http.StatusGone, api.errorResponse(err))
+		case record.ErrConflict:
+			c.JSON(http.StatusConflict, api.errorResponse(err))
 		default:
-			c.JSON(http.StatusInternalServerError, api.errorResponse(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "record deleted"})
+	resp, err := api.newLoader().recordResponse(c.Request.Context(), r)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *API) recordHistory(c *gin.Context) {
+	uId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	pId := c.Param("petId")
+	petId, err := uuid.Parse(pId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	rId := c.Param("recordId")
+	recordId, err := uuid.Parse(rId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.errorResponse(err))
+		return
+	}
+
+	revisions, err := api.app.RecordRevisionsUserPet(c.Request.Context(), uId, petId, recordId)
+	if err != nil {
+		switch err {
+		case pet.ErrNotFound, record.ErrNotFound:
+			c.JSON(http.StatusNotFound, api.errorResponse(err))
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	revisionsResp, err := api.newLoader().revisionsResponse(c.Request.Context(), revisions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisionsResp)
 }
@@ -1,4 +1,60 @@
 package config
 
+import "time"
+
 const Host = ""
 const Port = "8080"
+
+// QueryTimeout is the default deadline of the storage calls made while serving
+// a request. It can be overridden with the QUERY_TIMEOUT environment variable.
+const QueryTimeout = 10 * time.Second
+
+// RestoreGracePeriod is how long deleted accounts, pets and records can be
+// restored. It can be overridden with the RESTORE_GRACE_PERIOD environment
+// variable.
+const RestoreGracePeriod = 30 * 24 * time.Hour
+
+// PurgeRetention is how long deleted data is kept before it is purged for
+// good. It can be overridden with the PURGE_RETENTION environment variable and
+// must not be shorter than the restore grace period.
+const PurgeRetention = 90 * 24 * time.Hour
+
+// PurgeInterval is how often the server purges the deleted data. It can be
+// overridden with the PURGE_INTERVAL environment variable, "0" disables it.
+const PurgeInterval = 24 * time.Hour
+
+// PublicURL is where the UI is served, to link to it in the emails sent to the
+// users. It can be overridden with the PUBLIC_URL environment variable.
+const PublicURL = "http://localhost:" + Port
+
+// MailFrom is the address the emails are sent from. It can be overridden with
+// the MAIL_FROM environment variable.
+const MailFrom = "Pet Journal <no-reply@localhost>"
+
+// RequireVerifiedVets is whether vets must verify their email before they can
+// be assigned to pets. It can be overridden with the REQUIRE_VERIFIED_VETS
+// environment variable.
+const RequireVerifiedVets = false
+
+// RelayInterval is how often the outbox relay looks for events to deliver when
+// it has caught up. It can be overridden with the RELAY_INTERVAL environment
+// variable.
+const RelayInterval = time.Second
+
+// RelayBatchSize is how many events the relay delivers at most per pass
+const RelayBatchSize = 100
+
+// CacheSize is how many users and how many pets the server caches. It can be
+// overridden with the CACHE_SIZE environment variable, "0" disables the cache.
+const CacheSize = 10000
+
+// CacheTTL is how long a cached user or pet is served before it is read again.
+// It can be overridden with the CACHE_TTL environment variable.
+const CacheTTL = time.Minute
+
+// UsersPageSize is how many users the admins list per page when they do not
+// ask for a size, and MaxUsersPageSize the most they can ask for
+const (
+	UsersPageSize    = 100
+	MaxUsersPageSize = 1000
+)
@@ -4,6 +4,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/scarlettmiss/petJournal/application/domain/pet"
 	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"github.com/scarlettmiss/petJournal/application/domain/revision"
+	"github.com/scarlettmiss/petJournal/application/domain/session"
 	"github.com/scarlettmiss/petJournal/application/domain/user"
 	"github.com/scarlettmiss/petJournal/application/services"
 	"github.com/scarlettmiss/petJournal/utils/text"
@@ -61,6 +63,7 @@ func PetUpdateRequestToPetUpdateOpts(requestBody PetUpdateRequest, pId uuid.UUID
 	opts.OwnerId = uId
 	opts.Metas = requestBody.Metas
 	opts.Avatar = requestBody.Avatar
+	opts.Version = requestBody.Version
 
 	return opts, nil
 }
@@ -71,6 +74,10 @@ func PetToResponse(pet pet.Pet, owner user.User, vet user.User) PetResponse {
 	p.CreatedAt = pet.CreatedAt.UnixMilli()
 	p.UpdatedAt = pet.UpdatedAt.UnixMilli()
 	p.Deleted = pet.Deleted
+	if !pet.DeletedAt.IsZero() {
+		p.DeletedAt = pet.DeletedAt.UnixMilli()
+	}
+	p.Version = pet.Version
 	p.Name = pet.Name
 	p.DateOfBirth = pet.DateOfBirth.UnixMilli()
 	p.Gender = string(pet.Gender)
@@ -80,7 +87,7 @@ func PetToResponse(pet pet.Pet, owner user.User, vet user.User) PetResponse {
 	p.Pedigree = pet.Pedigree
 	p.Microchip = pet.Microchip
 	p.Owner = UserToResponse(owner)
-	if vet != user.Nil {
+	if vet.Id != uuid.Nil {
 		p.Vet = UserToResponse(vet)
 	}
 	p.Metas = pet.Metas
@@ -102,7 +109,8 @@ func PetToVerySimplifiedResponse(pet pet.Pet) PetResponse {
 func RecordCreateRequestToRecord(requestBody RecordCreateRequest, petId uuid.UUID, administeredBy user.User) services.RecordCreateOptions {
 	opts := services.RecordCreateOptions{}
 	verifierId := uuid.Nil
-	if administeredBy.UserType == user.Vet {
+	// only vets with an approved license verify the records they write
+	if administeredBy.LicenseApproved() {
 		verifierId = administeredBy.Id
 	}
 	opts.PetId = petId
@@ -122,7 +130,8 @@ func RecordCreateRequestToRecord(requestBody RecordCreateRequest, petId uuid.UUI
 func RecordsCreateRequestToRecord(requestBody RecordCreateRequest, petId uuid.UUID, administeredBy user.User) services.RecordsCreateOptions {
 	opts := services.RecordsCreateOptions{}
 	verifierId := uuid.Nil
-	if administeredBy.UserType == user.Vet {
+	// only vets with an approved license verify the records they write
+	if administeredBy.LicenseApproved() {
 		verifierId = administeredBy.Id
 	}
 	opts.PetId = petId
@@ -143,12 +152,13 @@ func RecordsCreateRequestToRecord(requestBody RecordCreateRequest, petId uuid.UU
 func RecordUpdateRequestToRecord(requestBody RecordUpdateRequest, rId uuid.UUID, updatedBy user.User) services.RecordUpdateOptions {
 	opts := services.RecordUpdateOptions{}
 	verifierId := uuid.Nil
-	if updatedBy.UserType == user.Vet {
+	if updatedBy.LicenseApproved() {
 		verifierId = updatedBy.Id
 	}
 	opts.Id = rId
 	opts.VerifiedBy = verifierId
 	opts.AdministeredBy = updatedBy.Id
+	opts.UpdatedBy = updatedBy.Id
 	opts.RecordType = requestBody.RecordType
 	opts.Name = requestBody.Name
 	opts.Date = time.Unix(requestBody.Date/1000, (requestBody.Date%1000)*1000000)
@@ -157,6 +167,7 @@ func RecordUpdateRequestToRecord(requestBody RecordUpdateRequest, rId uuid.UUID,
 	opts.Description = requestBody.Description
 	opts.Notes = requestBody.Notes
 	opts.NextDate = time.Unix(requestBody.NextDate/1000, (requestBody.NextDate%1000)*1000000)
+	opts.Version = requestBody.Version
 	return opts
 }
 
@@ -166,6 +177,10 @@ func RecordToResponse(r record.Record, pet pet.Pet, administeredBy user.User, ve
 	resp.CreatedAt = r.CreatedAt.UnixMilli()
 	resp.UpdatedAt = r.UpdatedAt.UnixMilli()
 	resp.Deleted = r.Deleted
+	if !r.DeletedAt.IsZero() {
+		resp.DeletedAt = r.DeletedAt.UnixMilli()
+	}
+	resp.Version = r.Version
 	resp.Pet = PetToVerySimplifiedResponse(pet)
 	resp.RecordType = string(r.RecordType)
 	resp.Name = r.Name
@@ -174,10 +189,10 @@ func RecordToResponse(r record.Record, pet pet.Pet, administeredBy user.User, ve
 	resp.Result = r.Result
 	resp.Description = r.Description
 	resp.Notes = r.Notes
-	if administeredBy != user.Nil {
+	if administeredBy.Id != uuid.Nil {
 		resp.AdministeredBy = UserToResponse(administeredBy)
 	}
-	if verifiedBy != user.Nil {
+	if verifiedBy.Id != uuid.Nil {
 		resp.VerifiedBy = UserToResponse(verifiedBy)
 	}
 	resp.GroupId = r.GroupId.String()
@@ -198,12 +213,15 @@ func UserCreateRequestToUserCreateOptions(requestBody UserCreateRequest) service
 	uOpts.State = requestBody.State
 	uOpts.Country = requestBody.Country
 	uOpts.Zip = requestBody.Zip
+	uOpts.LicenseNumber = requestBody.LicenseNumber
+	uOpts.LicenseAuthority = requestBody.LicenseAuthority
 	return uOpts
 }
 
 func UserUpdateRequestToUserOptions(requestBody UserUpdateRequest, uId uuid.UUID) services.UserUpdateOptions {
 	uOpts := services.UserUpdateOptions{}
 	uOpts.Id = uId
+	uOpts.Version = requestBody.Version
 	uOpts.Email = requestBody.Email
 	uOpts.Name = requestBody.Name
 	uOpts.Surname = requestBody.Surname
@@ -213,6 +231,8 @@ func UserUpdateRequestToUserOptions(requestBody UserUpdateRequest, uId uuid.UUID
 	uOpts.State = requestBody.State
 	uOpts.Country = requestBody.Country
 	uOpts.Zip = requestBody.Zip
+	uOpts.LicenseNumber = requestBody.LicenseNumber
+	uOpts.LicenseAuthority = requestBody.LicenseAuthority
 	return uOpts
 }
 
@@ -225,6 +245,7 @@ func UserToResponse(u user.User) *UserResponse {
 	resp.CreatedAt = u.CreatedAt.UnixMilli()
 	resp.UpdatedAt = u.UpdatedAt.UnixMilli()
 	resp.Deleted = u.Deleted
+	resp.Version = u.Version
 	resp.UserType = u.UserType
 	resp.Email = u.Email
 	resp.Name = u.Name
@@ -235,5 +256,55 @@ func UserToResponse(u user.User) *UserResponse {
 	resp.State = u.State
 	resp.Country = u.Country
 	resp.Zip = u.Zip
+	if u.UserType == user.Vet {
+		resp.LicenseNumber = u.LicenseNumber
+		resp.LicenseAuthority = u.LicenseAuthority
+		resp.LicenseStatus = u.LicenseStatus
+		if u.LicensePending() {
+			resp.LicenseStatus = user.LicensePending
+		}
+	}
 	return &resp
 }
+
+// PrivateUserToResponse is UserToResponse with the fields that only the user
+// themself and the admins may see
+func PrivateUserToResponse(u user.User) *UserResponse {
+	resp := UserToResponse(u)
+	if resp == nil {
+		return nil
+	}
+
+	resp.Disabled = u.Disabled
+	resp.EmailVerified = &u.EmailVerified
+	if u.UserType == user.Vet {
+		resp.LicenseNote = u.LicenseNote
+	}
+	return resp
+}
+
+func SessionToResponse(s session.Session, current uuid.UUID) SessionResponse {
+	resp := SessionResponse{}
+	resp.Id = s.Id.String()
+	resp.CreatedAt = s.CreatedAt.UnixMilli()
+	resp.UserAgent = s.UserAgent
+	resp.IP = s.IP
+	resp.LastSeenAt = s.LastSeenAt.UnixMilli()
+	resp.Current = s.Id == current
+
+	return resp
+}
+
+func RevisionToResponse(r revision.Revision, u user.User) RevisionResponse {
+	resp := RevisionResponse{}
+	resp.Id = r.Id.String()
+	resp.CreatedAt = r.CreatedAt.UnixMilli()
+	resp.Version = r.Version
+	resp.User = UserToResponse(u)
+	resp.Changes = make([]ChangeResponse, 0, len(r.Changes))
+	for _, c := range r.Changes {
+		resp.Changes = append(resp.Changes, ChangeResponse{Field: c.Field, Old: c.Old, New: c.New})
+	}
+
+	return resp
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application"
+	"github.com/scarlettmiss/petJournal/application/domain/pet"
+	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"github.com/scarlettmiss/petJournal/application/domain/revision"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+)
+
+// loader fetches the users and pets a response refers to in batches and keeps
+// them for the rest of the request, so building a response costs a couple of
+// lookups instead of a few per item. It is not safe for concurrent use.
+type loader struct {
+	app   application.Application
+	users map[uuid.UUID]user.User
+	pets  map[uuid.UUID]pet.Pet
+}
+
+func (api *API) newLoader() *loader {
+	return &loader{
+		app:   api.app,
+		users: make(map[uuid.UUID]user.User),
+		pets:  make(map[uuid.UUID]pet.Pet),
+	}
+}
+
+// loadUsers fetches the users of ids that are not loaded yet. Missing users are
+// remembered as user.Nil.
+func (l *loader) loadUsers(ctx context.Context, ids ...uuid.UUID) error {
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if _, ok := l.users[id]; !ok && id != uuid.Nil {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	users, err := l.app.UsersByIds(ctx, missing)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range missing {
+		l.users[id] = users[id]
+	}
+
+	return nil
+}
+
+// loadPets fetches the pets of ids that are not loaded yet. Missing pets are
+// remembered as pet.Nil.
+func (l *loader) loadPets(ctx context.Context, ids ...uuid.UUID) error {
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if _, ok := l.pets[id]; !ok && id != uuid.Nil {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	pets, err := l.app.PetsByIds(ctx, missing)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range missing {
+		l.pets[id] = pets[id]
+	}
+
+	return nil
+}
+
+// vet returns the user if they are a vet that was not deleted
+func (l *loader) vet(id uuid.UUID) user.User {
+	u := l.users[id]
+	if u.UserType != user.Vet || u.Deleted {
+		return user.Nil
+	}
+
+	return u
+}
+
+func (l *loader) petsResponse(ctx context.Context, pets map[uuid.UUID]pet.Pet) ([]PetResponse, error) {
+	ids := make([]uuid.UUID, 0, 2*len(pets))
+	for _, p := range pets {
+		ids = append(ids, p.OwnerId, p.VetId)
+	}
+
+	err := l.loadUsers(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	petsResp := make([]PetResponse, 0, len(pets))
+	for _, p := range pets {
+		owner := l.users[p.OwnerId]
+		if owner.Id == uuid.Nil {
+			return nil, user.ErrNotFound
+		}
+
+		petsResp = append(petsResp, PetToResponse(p, owner, l.vet(p.VetId)))
+	}
+
+	return petsResp, nil
+}
+
+func (l *loader) petResponse(ctx context.Context, p pet.Pet) (PetResponse, error) {
+	petsResp, err := l.petsResponse(ctx, map[uuid.UUID]pet.Pet{p.Id: p})
+	if err != nil {
+		return PetResponse{}, err
+	}
+
+	return petsResp[0], nil
+}
+
+func (l *loader) recordsResponse(ctx context.Context, records map[uuid.UUID]record.Record) ([]RecordResponse, error) {
+	uIds := make([]uuid.UUID, 0, 2*len(records))
+	pIds := make([]uuid.UUID, 0, len(records))
+	for _, r := range records {
+		uIds = append(uIds, r.AdministeredBy, r.VerifiedBy)
+		pIds = append(pIds, r.PetId)
+	}
+
+	err := l.loadUsers(ctx, uIds...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.loadPets(ctx, pIds...)
+	if err != nil {
+		return nil, err
+	}
+
+	recordsResp := make([]RecordResponse, 0, len(records))
+	for _, r := range records {
+		p := l.pets[r.PetId]
+		if p.Id == uuid.Nil {
+			return nil, pet.ErrNotFound
+		}
+
+		recordsResp = append(recordsResp, RecordToResponse(r, p, l.users[r.AdministeredBy], l.users[r.VerifiedBy]))
+	}
+
+	return recordsResp, nil
+}
+
+func (l *loader) recordResponse(ctx context.Context, r record.Record) (RecordResponse, error) {
+	recordsResp, err := l.recordsResponse(ctx, map[uuid.UUID]record.Record{r.Id: r})
+	if err != nil {
+		return RecordResponse{}, err
+	}
+
+	return recordsResp[0], nil
+}
+
+func (l *loader) revisionsResponse(ctx context.Context, revisions []revision.Revision) ([]RevisionResponse, error) {
+	ids := make([]uuid.UUID, 0, len(revisions))
+	for _, r := range revisions {
+		ids = append(ids, r.UserId)
+	}
+
+	err := l.loadUsers(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	revisionsResp := make([]RevisionResponse, 0, len(revisions))
+	for _, r := range revisions {
+		// the user may have been purged since
+		revisionsResp = append(revisionsResp, RevisionToResponse(r, l.users[r.UserId]))
+	}
+
+	return revisionsResp, nil
+}
@@ -1,14 +1,18 @@
 package middlewares
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	jwtUtils "github.com/scarlettmiss/petJournal/utils/jwt"
 	"net/http"
 	"strings"
 )
 
-func Auth() gin.HandlerFunc {
+// Auth accepts the requests that carry a valid access token of an active
+// session, and sets the UserId, UserType and SessionId of the token.
+func Auth(active func(ctx context.Context, sessionId uuid.UUID) (bool, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		const BEARER_SCHEMA = "Bearer "
 		authHeader := c.GetHeader("Authorization")
@@ -35,8 +39,28 @@ func Auth() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		// tokens issued before sessions have none
+		sessionId, _ := claims["SessionId"].(string)
+		sId, err := uuid.Parse(sessionId)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+		isActive, err := active(c.Request.Context(), sId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+		if !isActive {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
 		c.Set("UserId", claims["UserId"])
 		c.Set("UserType", claims["UserType"])
+		c.Set("SessionId", sessionId)
 		c.Next()
 	}
 }
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"net/http"
+)
+
+// Role accepts the requests of the users of the given types. It must run after
+// Auth, which sets the UserType of the access token.
+func Role(types ...user.Type) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !lo.Contains(types, user.Type(c.GetString("UserType"))) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// Timeout bounds the request context with the given deadline, so that the
+// storage calls made by a handler are cancelled once it expires or the
+// client goes away. A non-positive timeout leaves the context untouched.
+func Timeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -9,6 +9,46 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	Password        string `json:"password"`
+}
+
+type PasswordForgotRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type TwoFactorLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
 type UserCreateRequest struct {
 	UserType string `json:"userType"`
 	Email    string `json:"email"`
@@ -21,6 +61,9 @@ type UserCreateRequest struct {
 	State    string `json:"state,omitempty"`
 	Country  string `json:"country,omitempty"`
 	Zip      string `json:"zip,omitempty"`
+	// LicenseNumber and LicenseAuthority are required of vets
+	LicenseNumber    string `json:"licenseNumber,omitempty"`
+	LicenseAuthority string `json:"licenseAuthority,omitempty"`
 }
 
 type UserUpdateRequest struct {
@@ -33,23 +76,41 @@ type UserUpdateRequest struct {
 	State   string `json:"state,omitempty"`
 	Country string `json:"country,omitempty"`
 	Zip     string `json:"zip,omitempty"`
+	// LicenseNumber and LicenseAuthority submit another license of a vet for
+	// review
+	LicenseNumber    string `json:"licenseNumber,omitempty"`
+	LicenseAuthority string `json:"licenseAuthority,omitempty"`
+	Version          int64  `json:"version,omitempty"`
+}
+
+type LicenseRejectRequest struct {
+	Note string `json:"note,omitempty"`
 }
 
 type UserResponse struct {
-	Id        string    `json:"id,omitempty"`
-	CreatedAt int64     `json:"createdAt,omitempty"`
-	UpdatedAt int64     `json:"updatedAt,omitempty"`
-	Deleted   bool      `json:"deleted,omitempty"`
-	UserType  user.Type `json:"userType,omitempty"`
-	Email     string    `json:"email,omitempty"`
-	Name      string    `json:"name,omitempty"`
-	Surname   string    `json:"surname,omitempty"`
-	Phone     string    `json:"phone,omitempty"`
-	Address   string    `json:"address,omitempty"`
-	City      string    `json:"city,omitempty"`
-	State     string    `json:"state,omitempty"`
-	Country   string    `json:"country,omitempty"`
-	Zip       string    `json:"zip,omitempty"`
+	Id            string    `json:"id,omitempty"`
+	CreatedAt     int64     `json:"createdAt,omitempty"`
+	UpdatedAt     int64     `json:"updatedAt,omitempty"`
+	Deleted       bool      `json:"deleted,omitempty"`
+	Disabled      bool      `json:"disabled,omitempty"`
+	Version       int64     `json:"version,omitempty"`
+	UserType      user.Type `json:"userType,omitempty"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified *bool     `json:"emailVerified,omitempty"`
+	TwoFactor     *bool     `json:"twoFactor,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Surname       string    `json:"surname,omitempty"`
+	Phone         string    `json:"phone,omitempty"`
+	Address       string    `json:"address,omitempty"`
+	City          string    `json:"city,omitempty"`
+	State         string    `json:"state,omitempty"`
+	Country       string    `json:"country,omitempty"`
+	Zip           string    `json:"zip,omitempty"`
+
+	LicenseNumber    string             `json:"licenseNumber,omitempty"`
+	LicenseAuthority string             `json:"licenseAuthority,omitempty"`
+	LicenseStatus    user.LicenseStatus `json:"licenseStatus,omitempty"`
+	LicenseNote      string             `json:"licenseNote,omitempty"`
 }
 
 type RecordCreateRequest struct {
@@ -72,6 +133,7 @@ type RecordUpdateRequest struct {
 	Description string `json:"description,omitempty"`
 	Notes       string `json:"notes,omitempty"`
 	NextDate    int64  `json:"nextDate,omitempty"`
+	Version     int64  `json:"version,omitempty"`
 }
 
 type RecordResponse struct {
@@ -79,6 +141,8 @@ type RecordResponse struct {
 	CreatedAt      int64         `json:"createdAt"`
 	UpdatedAt      int64         `json:"updatedAt"`
 	Deleted        bool          `json:"deleted"`
+	DeletedAt      int64         `json:"deletedAt,omitempty"`
+	Version        int64         `json:"version"`
 	Pet            PetResponse   `json:"pet"`
 	RecordType     string        `json:"recordType"`
 	Name           string        `json:"name"`
@@ -118,6 +182,7 @@ type PetUpdateRequest struct {
 	Microchip   string            `json:"microchip,omitempty"`
 	VetId       string            `json:"vetId,omitempty"`
 	Metas       map[string]string `json:"metas,omitempty"`
+	Version     int64             `json:"version,omitempty"`
 }
 
 type PetResponse struct {
@@ -125,6 +190,8 @@ type PetResponse struct {
 	CreatedAt   int64             `json:"createdAt,omitempty"`
 	UpdatedAt   int64             `json:"updatedAt,omitempty"`
 	Deleted     bool              `json:"deleted,omitempty"`
+	DeletedAt   int64             `json:"deletedAt,omitempty"`
+	Version     int64             `json:"version,omitempty"`
 	Name        string            `json:"name,omitempty"`
 	DateOfBirth int64             `json:"dateOfBirth,omitempty"`
 	Gender      string            `json:"gender,omitempty"`
@@ -138,3 +205,32 @@ type PetResponse struct {
 	Metas       map[string]string `json:"metas,omitempty"`
 	Avatar      string            `json:"avatar,omitempty"`
 }
+
+type TrashResponse struct {
+	Pets    []PetResponse    `json:"pets"`
+	Records []RecordResponse `json:"records"`
+}
+
+type SessionResponse struct {
+	Id         string `json:"id"`
+	CreatedAt  int64  `json:"createdAt"`
+	UserAgent  string `json:"userAgent,omitempty"`
+	IP         string `json:"ip,omitempty"`
+	LastSeenAt int64  `json:"lastSeenAt"`
+	// Current is set on the session of the request
+	Current bool `json:"current"`
+}
+
+type RevisionResponse struct {
+	Id        string           `json:"id"`
+	CreatedAt int64            `json:"createdAt"`
+	Version   int64            `json:"version"`
+	User      *UserResponse    `json:"user,omitempty"`
+	Changes   []ChangeResponse `json:"changes"`
+}
+
+type ChangeResponse struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
@@ -1,18 +1,42 @@
 package application
 
 import (
+	"context"
 	"github.com/google/uuid"
 	"github.com/samber/lo"
+	"github.com/scarlettmiss/petJournal/application/domain/outbox"
 	"github.com/scarlettmiss/petJournal/application/domain/pet"
 	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"github.com/scarlettmiss/petJournal/application/domain/revision"
+	"github.com/scarlettmiss/petJournal/application/domain/session"
+	"github.com/scarlettmiss/petJournal/application/domain/token"
 	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/application/domain/usertoken"
+	"github.com/scarlettmiss/petJournal/application/events"
+	"github.com/scarlettmiss/petJournal/application/mailer"
 	"github.com/scarlettmiss/petJournal/application/services"
+	attemptService "github.com/scarlettmiss/petJournal/application/services/attemptService"
+	outboxService "github.com/scarlettmiss/petJournal/application/services/outboxService"
 	petService "github.com/scarlettmiss/petJournal/application/services/petService"
 	recordService "github.com/scarlettmiss/petJournal/application/services/recordService"
+	revisionService "github.com/scarlettmiss/petJournal/application/services/revisionService"
+	sessionService "github.com/scarlettmiss/petJournal/application/services/sessionService"
+	tokenService "github.com/scarlettmiss/petJournal/application/services/tokenService"
 	userService "github.com/scarlettmiss/petJournal/application/services/userService"
+	usertokenService "github.com/scarlettmiss/petJournal/application/services/usertokenService"
+	"github.com/scarlettmiss/petJournal/repositories/attemptrepo"
+	"github.com/scarlettmiss/petJournal/repositories/outboxrepo"
 	"github.com/scarlettmiss/petJournal/repositories/petrepo"
 	"github.com/scarlettmiss/petJournal/repositories/recordrepo"
+	"github.com/scarlettmiss/petJournal/repositories/revisionrepo"
+	"github.com/scarlettmiss/petJournal/repositories/sessionrepo"
+	"github.com/scarlettmiss/petJournal/repositories/tokenrepo"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
 	"github.com/scarlettmiss/petJournal/repositories/userrepo"
+	"github.com/scarlettmiss/petJournal/repositories/usertokenrepo"
+	"os"
+	"strings"
+	"time"
 )
 
 /*
@@ -20,39 +44,115 @@ what the actor can do.
 application talks with all the services
 */
 type application struct {
-	petService    petService.Service
-	userService   userService.Service
-	recordService recordService.Service
+	petService       petService.Service
+	userService      userService.Service
+	recordService    recordService.Service
+	revisionService  revisionService.Service
+	outboxService    outboxService.Service
+	tokenService     tokenService.Service
+	sessionService   sessionService.Service
+	usertokenService usertokenService.Service
+	attemptService   attemptService.Service
+	transactor       transaction.Transactor
+	bus              events.Bus
+	mailer           mailer.Mailer
+	// publicURL is where the UI is served, to link to it in emails
+	publicURL string
+	// restoreGracePeriod is how long deleted data can be restored
+	restoreGracePeriod time.Duration
+	// requireVerifiedVets keeps vets from being assigned to pets until they
+	// verify their email
+	requireVerifiedVets bool
 }
 
 type Options struct {
-	PetRepo    petrepo.Repository
-	UserRepo   userrepo.Repository
-	RecordRepo recordrepo.Repository
+	PetRepo      petrepo.Repository
+	UserRepo     userrepo.Repository
+	RecordRepo   recordrepo.Repository
+	RevisionRepo revisionrepo.Repository
+	// OutboxRepo stores the events until the relay delivers them to the Bus
+	OutboxRepo outboxrepo.Repository
+	// TokenRepo stores the refresh tokens issued to the users
+	TokenRepo tokenrepo.Repository
+	// SessionRepo stores the sessions the tokens are issued for
+	SessionRepo sessionrepo.Repository
+	// UserTokenRepo stores the one-time tokens sent to the users by email
+	UserTokenRepo usertokenrepo.Repository
+	// AttemptRepo counts the failed logins per account and IP address
+	AttemptRepo attemptrepo.Repository
+	// Transactor must belong to the same storage backend as the repositories
+	Transactor transaction.Transactor
+	// Bus receives the events of the changes the application makes from
+	// RelayEvents. A new bus is used when it is nil.
+	Bus events.Bus
+	// Mailer sends the emails to the users. The emails are written to the
+	// standard output when it is nil.
+	Mailer mailer.Mailer
+	// PublicURL is where the UI is served, e.g. https://petjournal.example.com
+	PublicURL string
+	// RestoreGracePeriod is how long deleted users, pets and records can be
+	// restored after they are deleted
+	RestoreGracePeriod time.Duration
+	// RequireVerifiedVets keeps vets from being assigned to pets, or listed
+	// as assignable, until they verify their email
+	RequireVerifiedVets bool
 }
 
 type Application interface {
-	CreateUser(opts services.UserCreateOptions) (user.User, string, error)
-	UpdateUser(opts services.UserUpdateOptions, includeDel bool) (user.User, error)
-	Users(includeDel bool) ([]user.User, error)
-	UsersByType(t user.Type, includeDel bool) ([]user.User, error)
-	User(id uuid.UUID) (user.User, error)
-	UserByType(id uuid.UUID, t user.Type, includeDel bool) (user.User, error)
-	DeleteUser(id uuid.UUID) error
-	Authenticate(opts services.LoginOptions) (user.User, string, error)
-	PetsByUser(uId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error)
-	Pet(id uuid.UUID) (pet.Pet, error)
-	PetByUser(uId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error)
-	DeletePet(uId uuid.UUID, id uuid.UUID) error
-	CreatePet(opts services.PetCreateOptions) (pet.Pet, error)
-	UpdatePet(opts services.PetUpdateOptions) (pet.Pet, error)
-	CreateRecord(opts services.RecordCreateOptions) (record.Record, error)
-	CreateRecords(opts services.RecordsCreateOptions) (map[uuid.UUID]record.Record, error)
-	RecordsByUser(uId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error)
-	RecordsByUserPet(uId uuid.UUID, pId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error)
-	RecordByUserPet(uId uuid.UUID, pId uuid.UUID, tId uuid.UUID, includeDel bool) (record.Record, error)
-	UpdateRecord(opts services.RecordUpdateOptions) (record.Record, error)
-	DeleteRecordUserPet(uId uuid.UUID, pId uuid.UUID, id uuid.UUID) error
+	CreateUser(ctx context.Context, opts services.UserCreateOptions) (user.User, services.Tokens, error)
+	UpdateUser(ctx context.Context, opts services.UserUpdateOptions, includeDel bool) (user.User, error)
+	Users(ctx context.Context, includeDel bool) ([]user.User, error)
+	UsersByType(ctx context.Context, t user.Type, includeDel bool) ([]user.User, error)
+	User(ctx context.Context, id uuid.UUID) (user.User, error)
+	UsersByIds(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]user.User, error)
+	UserByType(ctx context.Context, id uuid.UUID, t user.Type, includeDel bool) (user.User, error)
+	Vets(ctx context.Context) ([]user.User, error)
+	SearchUsers(ctx context.Context, query services.UserQuery) ([]user.User, error)
+	CreateAdmin(ctx context.Context, opts services.UserCreateOptions) (user.User, error)
+	DisableUser(ctx context.Context, adminId uuid.UUID, id uuid.UUID) (user.User, error)
+	EnableUser(ctx context.Context, id uuid.UUID) (user.User, error)
+	UnlockAccount(ctx context.Context, id uuid.UUID) error
+	PendingVets(ctx context.Context) ([]user.User, error)
+	ApproveVet(ctx context.Context, adminId uuid.UUID, id uuid.UUID) (user.User, error)
+	RejectVet(ctx context.Context, adminId uuid.UUID, id uuid.UUID, note string) (user.User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	Authenticate(ctx context.Context, opts services.LoginOptions) (user.User, services.Tokens, services.Challenge, error)
+	CompleteLogin(ctx context.Context, opts services.ChallengeOptions) (user.User, services.Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (services.Tokens, error)
+	Logout(ctx context.Context, sessionId uuid.UUID) error
+	SessionActive(ctx context.Context, sessionId uuid.UUID) (bool, error)
+	Sessions(ctx context.Context, uId uuid.UUID) ([]session.Session, error)
+	RevokeSession(ctx context.Context, uId uuid.UUID, id uuid.UUID) error
+	RevokeSessions(ctx context.Context, uId uuid.UUID, except uuid.UUID) error
+	ChangePassword(ctx context.Context, opts services.PasswordChangeOptions) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, opts services.PasswordResetOptions) error
+	VerifyEmail(ctx context.Context, token string) (user.User, error)
+	ResendVerification(ctx context.Context, uId uuid.UUID) error
+	EnrollTOTP(ctx context.Context, uId uuid.UUID) (services.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, uId uuid.UUID, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, uId uuid.UUID, code string) error
+	PetsByUser(ctx context.Context, uId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error)
+	Pet(ctx context.Context, id uuid.UUID) (pet.Pet, error)
+	PetsByIds(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]pet.Pet, error)
+	PetByUser(ctx context.Context, uId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error)
+	DeletePet(ctx context.Context, uId uuid.UUID, id uuid.UUID) error
+	CreatePet(ctx context.Context, opts services.PetCreateOptions) (pet.Pet, error)
+	UpdatePet(ctx context.Context, opts services.PetUpdateOptions) (pet.Pet, error)
+	CreateRecord(ctx context.Context, opts services.RecordCreateOptions) (record.Record, error)
+	CreateRecords(ctx context.Context, opts services.RecordsCreateOptions) (map[uuid.UUID]record.Record, error)
+	RecordsByUser(ctx context.Context, uId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error)
+	RecordsByUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error)
+	RecordByUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, tId uuid.UUID, includeDel bool) (record.Record, error)
+	UpdateRecord(ctx context.Context, opts services.RecordUpdateOptions) (record.Record, error)
+	DeleteRecordUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, id uuid.UUID) error
+	Trash(ctx context.Context, uId uuid.UUID) (map[uuid.UUID]pet.Pet, map[uuid.UUID]record.Record, error)
+	RestoreUser(ctx context.Context, opts services.LoginOptions) (user.User, services.Tokens, services.Challenge, error)
+	RestorePet(ctx context.Context, uId uuid.UUID, id uuid.UUID) (pet.Pet, error)
+	RestoreRecordUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, id uuid.UUID) (record.Record, error)
+	Purge(ctx context.Context, before time.Time) (services.PurgeResult, error)
+	RecordRevisionsUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, id uuid.UUID) ([]revision.Revision, error)
+	RelayEvents(ctx context.Context, limit int) (services.RelayResult, error)
 }
 
 func New(opts Options) (Application, error) {
@@ -69,166 +169,1489 @@ func New(opts Options) (Application, error) {
 	if err != nil {
 		return nil, err
 	}
+	revs, err := revisionService.New(opts.RevisionRepo)
+	if err != nil {
+		return nil, err
+	}
+	obs, err := outboxService.New(opts.OutboxRepo)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := tokenService.New(opts.TokenRepo)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := sessionService.New(opts.SessionRepo)
+	if err != nil {
+		return nil, err
+	}
+	uts, err := usertokenService.New(opts.UserTokenRepo)
+	if err != nil {
+		return nil, err
+	}
+	ats, err := attemptService.New(opts.AttemptRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	bus := opts.Bus
+	if bus == nil {
+		bus = events.NewBus()
+	}
+
+	m := opts.Mailer
+	if m == nil {
+		m = mailer.NewLog(os.Stdout, "no-reply@localhost")
+	}
+
+	app := application{
+		petService:          ps,
+		userService:         us,
+		recordService:       rs,
+		revisionService:     revs,
+		outboxService:       obs,
+		tokenService:        ts,
+		sessionService:      ss,
+		usertokenService:    uts,
+		attemptService:      ats,
+		transactor:          opts.Transactor,
+		bus:                 bus,
+		mailer:              m,
+		publicURL:           opts.PublicURL,
+		restoreGracePeriod:  opts.RestoreGracePeriod,
+		requireVerifiedVets: opts.RequireVerifiedVets,
+	}
 
-	app := application{petService: ps, userService: us, recordService: rs}
+	// the verification emails are sent once the change is committed, and sent
+	// again if sending them fails
+	events.On(bus, func(ctx context.Context, e events.UserRegistered) error {
+		return app.sendVerification(ctx, e.User.Id, e.User.Email)
+	})
+	events.On(bus, func(ctx context.Context, e events.EmailChanged) error {
+		return app.sendVerification(ctx, e.UserId, e.Email)
+	})
+	events.On(bus, func(ctx context.Context, e events.AccountLocked) error {
+		return app.sendAccountLocked(ctx, e.UserId, e.LockedUntil)
+	})
+	events.On(bus, func(ctx context.Context, e events.LicenseApproved) error {
+		return app.sendLicenseReview(ctx, e.UserId, true, "")
+	})
+	events.On(bus, func(ctx context.Context, e events.LicenseRejected) error {
+		return app.sendLicenseReview(ctx, e.UserId, false, e.Note)
+	})
 
 	return &app, nil
 }
 
-func (a *application) CreateUser(opts services.UserCreateOptions) (user.User, string, error) {
-	return a.userService.CreateUser(opts)
+func (a *application) CreateUser(ctx context.Context, opts services.UserCreateOptions) (user.User, services.Tokens, error) {
+	var (
+		u      user.User
+		tokens services.Tokens
+	)
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		u, err = a.userService.CreateUser(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		tokens, err = a.newSession(ctx, u, opts.Session)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.UserRegistered{User: events.ProfileOf(u)})
+	})
+	if err != nil {
+		return user.Nil, services.Tokens{}, err
+	}
+
+	return u, tokens, nil
+}
+
+func (a *application) UpdateUser(ctx context.Context, opts services.UserUpdateOptions, includeDel bool) (user.User, error) {
+	var u user.User
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		old, err := a.userService.User(ctx, opts.Id)
+		if err != nil {
+			return err
+		}
+
+		u, err = a.userService.UpdateUser(ctx, opts, includeDel)
+		if err != nil {
+			return err
+		}
+
+		evs := []events.Event{events.UserUpdated{User: events.ProfileOf(u)}}
+		if !strings.EqualFold(old.Email, u.Email) {
+			evs = append(evs, events.EmailChanged{UserId: u.Id, Email: u.Email})
+		}
+
+		return a.publish(ctx, evs...)
+	})
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return u, nil
+}
+
+func (a *application) Users(ctx context.Context, includeDel bool) ([]user.User, error) {
+	return a.userService.Users(ctx, includeDel)
 }
 
-func (a *application) UpdateUser(opts services.UserUpdateOptions, includeDel bool) (user.User, error) {
-	return a.userService.UpdateUser(opts, includeDel)
+func (a *application) UsersByType(ctx context.Context, t user.Type, includeDel bool) ([]user.User, error) {
+	return a.userService.UsersByType(ctx, t, includeDel)
 }
 
-func (a *application) Users(includeDel bool) ([]user.User, error) {
-	return a.userService.Users(includeDel)
+func (a *application) User(ctx context.Context, id uuid.UUID) (user.User, error) {
+	return a.userService.User(ctx, id)
 }
 
-func (a *application) UsersByType(t user.Type, includeDel bool) ([]user.User, error) {
-	return a.userService.UsersByType(t, includeDel)
+// UsersByIds returns the users with the given ids, deleted ones included, in a
+// single lookup. Ids without a user are missing from the map.
+func (a *application) UsersByIds(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]user.User, error) {
+	return a.userService.UsersByIds(ctx, ids)
 }
 
-func (a *application) User(id uuid.UUID) (user.User, error) {
-	return a.userService.User(id)
+func (a *application) UserByType(ctx context.Context, id uuid.UUID, t user.Type, includeDel bool) (user.User, error) {
+	return a.userService.UserByType(ctx, id, t, includeDel)
 }
 
-func (a *application) UserByType(id uuid.UUID, t user.Type, includeDel bool) (user.User, error) {
-	return a.userService.UserByType(id, t, includeDel)
+// Vets returns the vets that can be assigned to pets
+func (a *application) Vets(ctx context.Context) ([]user.User, error) {
+	vets, err := a.userService.UsersByType(ctx, user.Vet, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !a.requireVerifiedVets {
+		return vets, nil
+	}
+
+	return lo.Filter(vets, func(v user.User, _ int) bool { return v.EmailVerified }), nil
 }
 
-func (a *application) DeleteUser(id uuid.UUID) error {
-	return a.userService.DeleteUser(id)
+// SearchUsers returns the users that match the query. It is meant for admins.
+func (a *application) SearchUsers(ctx context.Context, query services.UserQuery) ([]user.User, error) {
+	return a.userService.SearchUsers(ctx, query)
 }
 
-func (a *application) Authenticate(opts services.LoginOptions) (user.User, string, error) {
-	return a.userService.Authenticate(opts.Email, opts.Password)
+// CreateAdmin creates an admin, who can then log in like any other user
+func (a *application) CreateAdmin(ctx context.Context, opts services.UserCreateOptions) (user.User, error) {
+	var u user.User
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		u, err = a.userService.CreateAdmin(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.UserRegistered{User: events.ProfileOf(u)})
+	})
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return u, nil
 }
 
-func (a *application) PetsByUser(uId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error) {
-	return a.petService.PetsByUser(uId, includeDel)
+// DisableUser keeps the user from logging in until they are enabled again, and
+// revokes every session of theirs. Admins cannot disable themselves, so that
+// there is always one left to enable the others.
+func (a *application) DisableUser(ctx context.Context, adminId uuid.UUID, id uuid.UUID) (user.User, error) {
+	if adminId == id {
+		return user.Nil, user.ErrDisableSelf
+	}
+
+	var u user.User
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		u, err = a.userService.SetDisabled(ctx, id, true)
+		if err != nil {
+			return err
+		}
+
+		err = a.revokeSessions(ctx, id, uuid.Nil)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.UserDisabled{UserId: id, AdminId: adminId})
+	})
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return u, nil
 }
 
-func (a *application) Pet(id uuid.UUID) (pet.Pet, error) {
-	return a.petService.Pet(id)
+func (a *application) EnableUser(ctx context.Context, id uuid.UUID) (user.User, error) {
+	var u user.User
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		u, err = a.userService.SetDisabled(ctx, id, false)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.UserEnabled{UserId: id})
+	})
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return u, nil
 }
 
-func (a *application) PetByUser(uId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
-	return a.petService.PetByUser(uId, id, includeDel)
+// UnlockAccount forgets the failed logins on the account of the user, so they
+// can log in again right away
+func (a *application) UnlockAccount(ctx context.Context, id uuid.UUID) error {
+	u, err := a.userService.User(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return a.attemptService.Reset(ctx, attemptService.AccountKey(u.Email))
 }
 
-func (a *application) DeletePet(uId uuid.UUID, id uuid.UUID) error {
-	return a.petService.DeletePet(uId, id)
+// PendingVets returns the vets whose license awaits review by an admin, oldest
+// first
+func (a *application) PendingVets(ctx context.Context) ([]user.User, error) {
+	return a.userService.PendingVets(ctx)
 }
 
-func (a *application) CreatePet(opts services.PetCreateOptions) (pet.Pet, error) {
-	_, err := a.User(opts.OwnerId)
+// ApproveVet approves the license of the vet, who can then verify records
+func (a *application) ApproveVet(ctx context.Context, adminId uuid.UUID, id uuid.UUID) (user.User, error) {
+	var v user.User
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		v, err = a.userService.ReviewLicense(ctx, adminId, id, true, "")
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.LicenseApproved{UserId: id, AdminId: adminId})
+	})
 	if err != nil {
-		return pet.Nil, err
+		return user.Nil, err
 	}
 
-	if opts.VetId != uuid.Nil {
-		_, err = a.UserByType(opts.VetId, user.Vet, false)
+	return v, nil
+}
+
+// RejectVet rejects the license of the vet. They can submit another one by
+// updating their profile.
+func (a *application) RejectVet(ctx context.Context, adminId uuid.UUID, id uuid.UUID, note string) (user.User, error) {
+	var v user.User
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		v, err = a.userService.ReviewLicense(ctx, adminId, id, false, note)
 		if err != nil {
-			return pet.Nil, err
+			return err
 		}
+
+		return a.publish(ctx, events.LicenseRejected{UserId: id, AdminId: adminId, Note: v.LicenseNote})
+	})
+	if err != nil {
+		return user.Nil, err
 	}
 
-	return a.petService.CreatePet(opts)
+	return v, nil
 }
 
-func (a *application) UpdatePet(opts services.PetUpdateOptions) (pet.Pet, error) {
-	return a.petService.UpdatePet(opts)
+// DeleteUser deletes the user along with the pets they own and the records of
+// those pets, and unassigns them from the pets they are the vet of. Every
+// session of the user is revoked.
+func (a *application) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := a.userService.DeleteUser(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		err = a.revokeSessions(ctx, id, uuid.Nil)
+		if err != nil {
+			return err
+		}
+
+		pIds, err := a.petService.DeletePetsByOwner(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		err = a.recordService.DeletePetsRecords(ctx, pIds)
+		if err != nil {
+			return err
+		}
+
+		err = a.petService.UnassignVet(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.UserDeleted{UserId: id})
+	})
 }
 
-func (a *application) CreateRecord(opts services.RecordCreateOptions) (record.Record, error) {
-	_, err := a.PetByUser(opts.AdministeredBy, opts.PetId, false)
+// Authenticate checks the password of the user and starts a session. Users
+// with two-factor authentication get a challenge to answer with CompleteLogin
+// instead. Too many failed logins on the account or from the IP address lock
+// them out for a while with user.ErrAccountLocked.
+func (a *application) Authenticate(ctx context.Context, opts services.LoginOptions) (user.User, services.Tokens, services.Challenge, error) {
+	err := a.checkLogin(ctx, opts.Email, opts.Session.IP)
 	if err != nil {
-		return record.Nil, err
+		return user.Nil, services.Tokens{}, services.Challenge{}, err
 	}
 
-	if opts.VerifiedBy != uuid.Nil {
-		_, err = a.UserByType(opts.VerifiedBy, user.Vet, true)
+	u, err := a.userService.Authenticate(ctx, opts.Email, opts.Password)
+	if err == user.ErrAuthentication || err == user.ErrNotFound {
+		return user.Nil, services.Tokens{}, services.Challenge{}, a.loginFailed(ctx, opts.Email, opts.Session.IP, err)
+	}
+	if err != nil {
+		return u, services.Tokens{}, services.Challenge{}, err
+	}
+
+	if u.TOTPEnabled {
+		challenge, err := a.userService.Challenge(u)
 		if err != nil {
-			switch err {
-			case user.ErrNotFound:
-				return record.Nil, record.ErrNotValidVerifier
-			default:
-				return record.Nil, err
-			}
+			return user.Nil, services.Tokens{}, services.Challenge{}, err
 		}
+
+		return u, services.Tokens{}, challenge, nil
+	}
+
+	var tokens services.Tokens
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		tokens, err = a.newSession(ctx, u, opts.Session)
+		return err
+	})
+	if err != nil {
+		return user.Nil, services.Tokens{}, services.Challenge{}, err
+	}
+
+	err = a.loginSucceeded(ctx, u.Email)
+	if err != nil {
+		return user.Nil, services.Tokens{}, services.Challenge{}, err
 	}
 
-	return a.recordService.CreateRecord(opts)
+	return u, tokens, services.Challenge{}, nil
 }
 
-func (a *application) CreateRecords(opts services.RecordsCreateOptions) (map[uuid.UUID]record.Record, error) {
-	_, err := a.PetByUser(opts.AdministeredBy, opts.PetId, false)
+// CompleteLogin starts a session of the user the challenge was issued to when
+// the code is one of their TOTP or recovery codes
+func (a *application) CompleteLogin(ctx context.Context, opts services.ChallengeOptions) (user.User, services.Tokens, error) {
+	var (
+		u      user.User
+		tokens services.Tokens
+	)
+
+	u, err := a.userService.ChallengedUser(ctx, opts.Challenge)
 	if err != nil {
-		return nil, err
+		return user.Nil, services.Tokens{}, err
 	}
 
-	if opts.VerifiedBy != uuid.Nil {
-		_, err := a.UserByType(opts.VerifiedBy, user.Vet, true)
+	err = a.checkLogin(ctx, u.Email, opts.Session.IP)
+	if err != nil {
+		return user.Nil, services.Tokens{}, err
+	}
+
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		u, err = a.userService.CheckSecondFactor(ctx, u, opts.Code)
 		if err != nil {
-			switch err {
-			case user.ErrNotFound:
-				return nil, record.ErrNotValidVerifier
-			default:
-				return nil, err
-			}
+			return err
 		}
+
+		tokens, err = a.newSession(ctx, u, opts.Session)
+		return err
+	})
+	if err == user.ErrTOTPCode {
+		return user.Nil, services.Tokens{}, a.loginFailed(ctx, u.Email, opts.Session.IP, err)
+	}
+	if err != nil {
+		return user.Nil, services.Tokens{}, err
+	}
+
+	err = a.loginSucceeded(ctx, u.Email)
+	if err != nil {
+		return user.Nil, services.Tokens{}, err
 	}
-	return a.recordService.CreateRecords(opts)
+
+	return u, tokens, nil
 }
 
-func (a *application) RecordsByUser(uId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error) {
-	pets, err := a.PetsByUser(uId, includeDel)
+// Refresh exchanges the refresh token for new tokens of the same session. A
+// refresh token that is used twice was probably stolen, so the whole session
+// is revoked and token.ErrReused returned.
+func (a *application) Refresh(ctx context.Context, refreshToken string) (services.Tokens, error) {
+	var (
+		t      token.RefreshToken
+		tokens services.Tokens
+	)
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		t, err = a.tokenService.Use(ctx, refreshToken)
+		if err != nil {
+			return err
+		}
+
+		s, err := a.sessionService.Session(ctx, t.FamilyId)
+		if err != nil {
+			return err
+		}
+
+		err = a.sessionService.Touch(ctx, s)
+		if err != nil {
+			return err
+		}
+
+		u, err := a.userService.User(ctx, t.UserId)
+		if err != nil {
+			return err
+		}
+
+		if u.Disabled {
+			return user.ErrUserDisabled
+		}
+
+		tokens, err = a.tokenService.Issue(ctx, u, t.FamilyId)
+		return err
+	})
+	if err == token.ErrReused {
+		// outside the transaction, which was rolled back
+		revokeErr := a.revokeSession(ctx, t.FamilyId)
+		if revokeErr != nil {
+			return services.Tokens{}, revokeErr
+		}
+	}
 	if err != nil {
-		return nil, err
+		return services.Tokens{}, err
+	}
+
+	return tokens, nil
+}
+
+// Logout revokes the session, so neither its refresh token nor its access
+// tokens are accepted anymore
+func (a *application) Logout(ctx context.Context, sessionId uuid.UUID) error {
+	return a.revokeSession(ctx, sessionId)
+}
+
+// SessionActive reports whether the tokens of the session are still accepted,
+// and records that the session was seen if they are
+func (a *application) SessionActive(ctx context.Context, sessionId uuid.UUID) (bool, error) {
+	s, err := a.sessionService.Session(ctx, sessionId)
+	switch err {
+	case nil:
+	case session.ErrNotFound, session.ErrRevoked:
+		return false, nil
+	default:
+		return false, err
 	}
-	return a.recordService.PetsRecords(lo.Keys[uuid.UUID, pet.Pet](pets), includeDel)
+
+	return true, a.sessionService.Touch(ctx, s)
+}
+
+// Sessions returns the sessions of the user that were not revoked, oldest first
+func (a *application) Sessions(ctx context.Context, uId uuid.UUID) ([]session.Session, error) {
+	return a.sessionService.UserSessions(ctx, uId)
 }
 
-func (a *application) RecordsByUserPet(uId uuid.UUID, pId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error) {
-	_, err := a.PetByUser(uId, pId, false)
+func (a *application) RevokeSession(ctx context.Context, uId uuid.UUID, id uuid.UUID) error {
+	s, err := a.sessionService.Session(ctx, id)
+	if err == session.ErrRevoked {
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if s.UserId != uId {
+		return session.ErrNotFound
+	}
+
+	return a.revokeSession(ctx, id)
+}
+
+// RevokeSessions revokes every session of the user but the given one, which
+// may be uuid.Nil
+func (a *application) RevokeSessions(ctx context.Context, uId uuid.UUID, except uuid.UUID) error {
+	return a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		return a.revokeSessions(ctx, uId, except)
+	})
+}
+
+func (a *application) PetsByUser(ctx context.Context, uId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error) {
+	return a.petService.PetsByUser(ctx, uId, includeDel)
+}
+
+func (a *application) Pet(ctx context.Context, id uuid.UUID) (pet.Pet, error) {
+	return a.petService.Pet(ctx, id)
+}
+
+// PetsByIds returns the pets with the given ids like UsersByIds does users
+func (a *application) PetsByIds(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]pet.Pet, error) {
+	return a.petService.PetsByIds(ctx, ids)
+}
+
+func (a *application) PetByUser(ctx context.Context, uId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
+	return a.petService.PetByUser(ctx, uId, id, includeDel)
+}
+
+// DeletePet deletes the pet and its records when the user is the owner. When
+// the user is the vet of the pet they are only unassigned from it.
+func (a *application) DeletePet(ctx context.Context, uId uuid.UUID, id uuid.UUID) error {
+	return a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		p, err := a.petService.PetByUser(ctx, uId, id, false)
+		if err != nil {
+			return err
+		}
+
+		err = a.petService.DeletePet(ctx, uId, id)
+		if err != nil {
+			return err
+		}
+
+		if p.OwnerId != uId {
+			return a.publish(ctx, events.VetUnassigned{PetId: id, VetId: uId})
+		}
+
+		err = a.recordService.DeletePetsRecords(ctx, []uuid.UUID{id})
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.PetDeleted{PetId: id, OwnerId: uId})
+	})
+}
+
+func (a *application) CreatePet(ctx context.Context, opts services.PetCreateOptions) (pet.Pet, error) {
+	_, err := a.User(ctx, opts.OwnerId)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	if opts.VetId != uuid.Nil {
+		err = a.checkAssignable(ctx, opts.VetId)
+		if err != nil {
+			return pet.Nil, err
+		}
+	}
+
+	var p pet.Pet
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		p, err = a.petService.CreatePet(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		evs := []events.Event{events.PetCreated{Pet: p}}
+		if p.VetId != uuid.Nil {
+			evs = append(evs, events.VetAssigned{PetId: p.Id, VetId: p.VetId})
+		}
+
+		return a.publish(ctx, evs...)
+	})
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	return p, nil
+}
+
+func (a *application) UpdatePet(ctx context.Context, opts services.PetUpdateOptions) (pet.Pet, error) {
+	var p pet.Pet
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		old, err := a.petService.PetByUser(ctx, opts.OwnerId, opts.Id, false)
+		if err != nil {
+			return err
+		}
+
+		if opts.VetId != uuid.Nil && opts.VetId != old.VetId {
+			err = a.checkAssignable(ctx, opts.VetId)
+			if err != nil {
+				return err
+			}
+		}
+
+		p, err = a.petService.UpdatePet(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		evs := []events.Event{events.PetUpdated{Pet: p}}
+		if old.VetId != p.VetId {
+			if old.VetId != uuid.Nil {
+				evs = append(evs, events.VetUnassigned{PetId: p.Id, VetId: old.VetId})
+			}
+			if p.VetId != uuid.Nil {
+				evs = append(evs, events.VetAssigned{PetId: p.Id, VetId: p.VetId})
+			}
+		}
+
+		return a.publish(ctx, evs...)
+	})
+	if err != nil {
+		return pet.Nil, err
 	}
-	return a.recordService.PetRecords(pId, includeDel)
+
+	return p, nil
 }
 
-func (a *application) RecordByUserPet(uId uuid.UUID, pId uuid.UUID, tId uuid.UUID, includeDel bool) (record.Record, error) {
-	_, err := a.PetByUser(uId, pId, false)
+func (a *application) CreateRecord(ctx context.Context, opts services.RecordCreateOptions) (record.Record, error) {
+	_, err := a.PetByUser(ctx, opts.AdministeredBy, opts.PetId, false)
 	if err != nil {
 		return record.Nil, err
 	}
-	return a.recordService.PetRecord(pId, tId, includeDel)
-}
 
-func (a *application) UpdateRecord(opts services.RecordUpdateOptions) (record.Record, error) {
 	if opts.VerifiedBy != uuid.Nil {
-		_, err := a.UserByType(opts.VerifiedBy, user.Vet, true)
+		err = a.checkVerifier(ctx, opts.VerifiedBy)
 		if err != nil {
-			switch err {
-			case user.ErrNotFound:
-				return record.Nil, record.ErrNotValidVerifier
-			default:
-				return record.Nil, err
-			}
+			return record.Nil, err
+		}
+	}
+
+	var r record.Record
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		r, err = a.recordService.CreateRecord(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		err = a.revisionService.CreateRevision(ctx, record.Nil, r, opts.AdministeredBy)
+		if err != nil {
+			return err
 		}
+
+		return a.publishRecordCreated(ctx, r)
+	})
+	if err != nil {
+		return record.Nil, err
 	}
 
-	return a.recordService.UpdateRecord(opts)
+	return r, nil
 }
 
-func (a *application) DeleteRecordUserPet(uId uuid.UUID, pId uuid.UUID, id uuid.UUID) error {
-	_, err := a.RecordByUserPet(uId, pId, id, false)
+func (a *application) CreateRecords(ctx context.Context, opts services.RecordsCreateOptions) (map[uuid.UUID]record.Record, error) {
+	_, err := a.PetByUser(ctx, opts.AdministeredBy, opts.PetId, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return a.recordService.DeleteRecord(id)
+	if opts.VerifiedBy != uuid.Nil {
+		err := a.checkVerifier(ctx, opts.VerifiedBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var records map[uuid.UUID]record.Record
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		records, err = a.recordService.CreateRecords(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range records {
+			err = a.revisionService.CreateRevision(ctx, record.Nil, r, opts.AdministeredBy)
+			if err != nil {
+				return err
+			}
+
+			err = a.publishRecordCreated(ctx, r)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (a *application) RecordsByUser(ctx context.Context, uId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error) {
+	pets, err := a.PetsByUser(ctx, uId, includeDel)
+	if err != nil {
+		return nil, err
+	}
+	return a.recordService.PetsRecords(ctx, lo.Keys[uuid.UUID, pet.Pet](pets), includeDel)
+}
+
+func (a *application) RecordsByUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error) {
+	_, err := a.PetByUser(ctx, uId, pId, false)
+	if err != nil {
+		return nil, err
+	}
+	return a.recordService.PetRecords(ctx, pId, includeDel)
+}
+
+func (a *application) RecordByUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, tId uuid.UUID, includeDel bool) (record.Record, error) {
+	_, err := a.PetByUser(ctx, uId, pId, false)
+	if err != nil {
+		return record.Nil, err
+	}
+	return a.recordService.PetRecord(ctx, pId, tId, includeDel)
+}
+
+func (a *application) UpdateRecord(ctx context.Context, opts services.RecordUpdateOptions) (record.Record, error) {
+	if opts.VerifiedBy != uuid.Nil {
+		err := a.checkVerifier(ctx, opts.VerifiedBy)
+		if err != nil {
+			return record.Nil, err
+		}
+	}
+
+	var r record.Record
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		old, err := a.recordService.Record(ctx, opts.Id)
+		if err != nil {
+			return err
+		}
+
+		r, err = a.recordService.UpdateRecord(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		err = a.revisionService.CreateRevision(ctx, old, r, opts.UpdatedBy)
+		if err != nil {
+			return err
+		}
+
+		evs := []events.Event{events.RecordUpdated{Record: r, UserId: opts.UpdatedBy}}
+		if r.VerifiedBy != uuid.Nil && r.VerifiedBy != old.VerifiedBy {
+			evs = append(evs, events.RecordVerified{Record: r})
+		}
+
+		return a.publish(ctx, evs...)
+	})
+	if err != nil {
+		return record.Nil, err
+	}
+
+	return r, nil
+}
+
+func (a *application) DeleteRecordUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, id uuid.UUID) error {
+	_, err := a.RecordByUserPet(ctx, uId, pId, id, false)
+	if err != nil {
+		return err
+	}
+
+	return a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := a.recordService.DeleteRecord(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.RecordDeleted{RecordId: id, PetId: pId, UserId: uId})
+	})
+}
+
+// Trash returns the deleted pets the user owns and the deleted records of the
+// pets they can still see, as long as they can be restored. The records deleted
+// along with a pet are restored with it, so they are not listed.
+func (a *application) Trash(ctx context.Context, uId uuid.UUID) (map[uuid.UUID]pet.Pet, map[uuid.UUID]record.Record, error) {
+	since := a.restorableSince()
+
+	pets, err := a.petService.DeletedPetsByOwner(ctx, uId, since)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uPets, err := a.PetsByUser(ctx, uId, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records, err := a.recordService.DeletedPetsRecords(ctx, lo.Keys[uuid.UUID, pet.Pet](uPets), since)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pets, records, nil
+}
+
+// RestoreUser restores the deleted account of the user along with the pets and
+// records that were deleted with it. The user is not assigned back as the vet
+// of the pets they were unassigned from.
+func (a *application) RestoreUser(ctx context.Context, opts services.LoginOptions) (user.User, services.Tokens, services.Challenge, error) {
+	var (
+		u         user.User
+		tokens    services.Tokens
+		challenge services.Challenge
+	)
+
+	err := a.checkLogin(ctx, opts.Email, opts.Session.IP)
+	if err != nil {
+		return user.Nil, services.Tokens{}, services.Challenge{}, err
+	}
+
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		deleted, err := a.userService.DeletedUser(ctx, opts.Email, opts.Password, a.restorableSince())
+		if err != nil {
+			return err
+		}
+
+		u, err = a.userService.RestoreUser(ctx, deleted)
+		if err != nil {
+			return err
+		}
+
+		// the account is restored, but users with two-factor authentication
+		// still need their code to log in
+		if u.TOTPEnabled {
+			challenge, err = a.userService.Challenge(u)
+		} else {
+			tokens, err = a.newSession(ctx, u, opts.Session)
+		}
+		if err != nil {
+			return err
+		}
+
+		pIds, err := a.petService.RestorePetsByOwner(ctx, u.Id, deleted.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		err = a.recordService.RestorePetsRecords(ctx, pIds, deleted.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.UserRestored{User: events.ProfileOf(u)})
+	})
+	if err == user.ErrAuthentication || err == user.ErrNotFound {
+		return user.Nil, services.Tokens{}, services.Challenge{}, a.loginFailed(ctx, opts.Email, opts.Session.IP, err)
+	}
+	if err != nil {
+		return user.Nil, services.Tokens{}, services.Challenge{}, err
+	}
+
+	if challenge.Token == "" {
+		err = a.loginSucceeded(ctx, u.Email)
+		if err != nil {
+			return user.Nil, services.Tokens{}, services.Challenge{}, err
+		}
+	}
+
+	return u, tokens, challenge, nil
+}
+
+// RestorePet restores the deleted pet of the owner along with the records that
+// were deleted with it.
+func (a *application) RestorePet(ctx context.Context, uId uuid.UUID, id uuid.UUID) (pet.Pet, error) {
+	var p pet.Pet
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		deleted, err := a.petService.DeletedPet(ctx, uId, id, a.restorableSince())
+		if err != nil {
+			return err
+		}
+
+		p, err = a.petService.RestorePet(ctx, deleted)
+		if err != nil {
+			return err
+		}
+
+		err = a.recordService.RestorePetsRecords(ctx, []uuid.UUID{id}, deleted.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.PetRestored{Pet: p})
+	})
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	return p, nil
+}
+
+func (a *application) RestoreRecordUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, id uuid.UUID) (record.Record, error) {
+	_, err := a.PetByUser(ctx, uId, pId, false)
+	if err != nil {
+		return record.Nil, err
+	}
+
+	var r record.Record
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		deleted, err := a.recordService.DeletedPetRecord(ctx, pId, id, a.restorableSince())
+		if err != nil {
+			return err
+		}
+
+		r, err = a.recordService.RestoreRecord(ctx, deleted)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.RecordRestored{Record: r})
+	})
+	if err != nil {
+		return record.Nil, err
+	}
+
+	return r, nil
+}
+
+// ChangePassword changes the password of the user when the current one is
+// right, and revokes their other sessions. Wrong passwords count as failed
+// logins, so that they cannot be guessed with a stolen access token.
+func (a *application) ChangePassword(ctx context.Context, opts services.PasswordChangeOptions) error {
+	u, err := a.userService.User(ctx, opts.UserId)
+	if err != nil {
+		return err
+	}
+
+	err = a.checkLogin(ctx, u.Email, "")
+	if err != nil {
+		return err
+	}
+
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := a.userService.ChangePassword(ctx, opts.UserId, opts.CurrentPassword, opts.Password)
+		if err != nil {
+			return err
+		}
+
+		err = a.revokeSessions(ctx, opts.UserId, opts.SessionId)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.PasswordChanged{UserId: opts.UserId})
+	})
+	if err == user.ErrAuthentication {
+		return a.loginFailed(ctx, u.Email, "", err)
+	}
+
+	return err
+}
+
+// RequestPasswordReset emails a password reset link to the user with the
+// email. Nothing is sent if there is no such user, and no error is returned
+// either so that the emails of the users cannot be found out.
+func (a *application) RequestPasswordReset(ctx context.Context, email string) error {
+	u, err := a.userService.UserByEmail(ctx, email)
+	if err == user.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var token string
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		token, err = a.usertokenService.Issue(ctx, u.Id, usertoken.PasswordReset, usertokenService.PasswordResetTTL)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, a.passwordResetMail(u, token))
+}
+
+// ResetPassword sets the password of the user the reset token was sent to,
+// revokes all their sessions and unlocks their account
+func (a *application) ResetPassword(ctx context.Context, opts services.PasswordResetOptions) error {
+	return a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		t, err := a.usertokenService.Use(ctx, usertoken.PasswordReset, opts.Token)
+		if err != nil {
+			return err
+		}
+
+		u, err := a.userService.User(ctx, t.UserId)
+		if err != nil {
+			return err
+		}
+
+		_, err = a.userService.SetPassword(ctx, u, opts.Password)
+		if err != nil {
+			return err
+		}
+
+		err = a.usertokenService.DeleteUserTokens(ctx, u.Id, usertoken.PasswordReset)
+		if err != nil {
+			return err
+		}
+
+		err = a.attemptService.Reset(ctx, attemptService.AccountKey(u.Email))
+		if err != nil {
+			return err
+		}
+
+		err = a.revokeSessions(ctx, u.Id, uuid.Nil)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.PasswordChanged{UserId: u.Id})
+	})
+}
+
+// VerifyEmail marks the email the verification token was sent to as verified
+func (a *application) VerifyEmail(ctx context.Context, token string) (user.User, error) {
+	var u user.User
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		u, err = a.userService.VerifyEmail(ctx, token)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.EmailVerified{UserId: u.Id})
+	})
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return u, nil
+}
+
+// ResendVerification emails a new verification link to the user
+func (a *application) ResendVerification(ctx context.Context, uId uuid.UUID) error {
+	u, err := a.userService.User(ctx, uId)
+	if err != nil {
+		return err
+	}
+
+	if u.Deleted {
+		return user.ErrUserDeleted
+	}
+
+	if u.EmailVerified {
+		return user.ErrAlreadyVerified
+	}
+
+	return a.sendVerification(ctx, u.Id, u.Email)
+}
+
+// EnrollTOTP starts the two-factor authentication enrollment of the user. It
+// is enabled once ConfirmTOTP gets a code of the secret.
+func (a *application) EnrollTOTP(ctx context.Context, uId uuid.UUID) (services.TOTPEnrollment, error) {
+	u, err := a.userService.EnrollTOTP(ctx, uId)
+	if err != nil {
+		return services.TOTPEnrollment{}, err
+	}
+
+	return services.TOTPEnrollment{Secret: u.TOTPSecret, URI: a.userService.TOTPURI(u)}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication and returns the recovery codes
+// of the user, which are not shown again
+func (a *application) ConfirmTOTP(ctx context.Context, uId uuid.UUID, code string) ([]string, error) {
+	var codes []string
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		_, codes, err = a.userService.ConfirmTOTP(ctx, uId, code)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.TwoFactorEnabled{UserId: uId})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP disables two-factor authentication when the code is one of the
+// TOTP or recovery codes of the user. Wrong codes count as failed logins, as
+// they do when logging in.
+func (a *application) DisableTOTP(ctx context.Context, uId uuid.UUID, code string) error {
+	u, err := a.userService.User(ctx, uId)
+	if err != nil {
+		return err
+	}
+
+	err = a.checkLogin(ctx, u.Email, "")
+	if err != nil {
+		return err
+	}
+
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := a.userService.DisableTOTP(ctx, uId, code)
+		if err != nil {
+			return err
+		}
+
+		return a.publish(ctx, events.TwoFactorDisabled{UserId: uId})
+	})
+	if err == user.ErrTOTPCode {
+		return a.loginFailed(ctx, u.Email, "", err)
+	}
+
+	return err
+}
+
+// Purge hard-deletes the users, pets and records deleted before the given time.
+// The pets of the purged users and the records of the purged pets are purged
+// with them, and each is removed before what it references. The sessions and
+// tokens of the purged users and the expired ones are purged too, along with
+// the login attempts that are no longer remembered.
+func (a *application) Purge(ctx context.Context, before time.Time) (services.PurgeResult, error) {
+	var res services.PurgeResult
+
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		uIds, err := a.userService.UsersDeletedBefore(ctx, before)
+		if err != nil {
+			return err
+		}
+
+		pIds, err := a.petService.PetsToPurge(ctx, before, uIds)
+		if err != nil {
+			return err
+		}
+
+		rIds, err := a.recordService.PurgeRecords(ctx, before, pIds)
+		if err != nil {
+			return err
+		}
+
+		err = a.revisionService.PurgeRecordsRevisions(ctx, rIds)
+		if err != nil {
+			return err
+		}
+
+		err = a.petService.PurgePets(ctx, pIds)
+		if err != nil {
+			return err
+		}
+
+		err = a.tokenService.PurgeTokens(ctx, uIds)
+		if err != nil {
+			return err
+		}
+
+		err = a.sessionService.PurgeSessions(ctx, uIds)
+		if err != nil {
+			return err
+		}
+
+		err = a.usertokenService.PurgeTokens(ctx, uIds)
+		if err != nil {
+			return err
+		}
+
+		err = a.attemptService.Purge(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = a.userService.PurgeUsers(ctx, uIds)
+		if err != nil {
+			return err
+		}
+
+		res = services.PurgeResult{UserIds: uIds, PetIds: pIds, RecordIds: rIds}
+		return nil
+	})
+	if err != nil {
+		return services.PurgeResult{}, err
+	}
+
+	return res, nil
+}
+
+// RecordRevisionsUserPet returns the revisions of a record of a pet the user
+// can access, oldest first. The revisions of deleted records are included.
+func (a *application) RecordRevisionsUserPet(ctx context.Context, uId uuid.UUID, pId uuid.UUID, id uuid.UUID) ([]revision.Revision, error) {
+	_, err := a.RecordByUserPet(ctx, uId, pId, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.revisionService.RecordRevisions(ctx, id)
+}
+
+// RelayEvents delivers up to limit due events of the outbox to the bus. Events
+// whose delivery fails are retried by a later call until they are dead-lettered.
+func (a *application) RelayEvents(ctx context.Context, limit int) (services.RelayResult, error) {
+	var res services.RelayResult
+
+	msgs, err := a.outboxService.DueMessages(ctx, limit)
+	if err != nil {
+		return res, err
+	}
+
+	for _, m := range msgs {
+		err = a.relay(ctx, m)
+		if err == nil {
+			err = a.outboxService.Delivered(ctx, m.Id)
+			if err != nil {
+				return res, err
+			}
+			res.Delivered++
+			continue
+		}
+
+		m, err = a.outboxService.Failed(ctx, m, err)
+		if err != nil {
+			return res, err
+		}
+
+		if m.Dead {
+			res.DeadLettered = append(res.DeadLettered, m.Id)
+		} else {
+			res.Failed++
+		}
+	}
+
+	return res, nil
+}
+
+func (a *application) relay(ctx context.Context, m outbox.Message) error {
+	e, err := events.Decode(m.Event, []byte(m.Payload))
+	if err != nil {
+		return err
+	}
+
+	return a.bus.Publish(ctx, e)
+}
+
+// publish writes evs to the outbox. It must be called in the transaction of
+// the change, so the events are stored if and only if the change is.
+func (a *application) publish(ctx context.Context, evs ...events.Event) error {
+	return a.outboxService.Enqueue(ctx, evs...)
+}
+
+func (a *application) publishRecordCreated(ctx context.Context, r record.Record) error {
+	evs := []events.Event{events.RecordCreated{Record: r}}
+	if r.VerifiedBy != uuid.Nil {
+		evs = append(evs, events.RecordVerified{Record: r})
+	}
+
+	return a.publish(ctx, evs...)
+}
+
+// sendVerification emails a verification link to the user if email is still
+// theirs and not verified yet
+func (a *application) sendVerification(ctx context.Context, uId uuid.UUID, email string) error {
+	u, err := a.userService.User(ctx, uId)
+	if err == user.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if u.Deleted || u.EmailVerified || !strings.EqualFold(u.Email, email) {
+		return nil
+	}
+
+	token, err := a.userService.VerificationToken(u)
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, a.verificationMail(u, token))
+}
+
+// loginKeys returns the keys the logins on the account from the IP address are
+// throttled by. Logins without an IP address are only throttled per account.
+func loginKeys(email string, ip string) []string {
+	keys := []string{attemptService.AccountKey(email)}
+	if ip != "" {
+		keys = append(keys, attemptService.IPKey(ip))
+	}
+
+	return keys
+}
+
+// checkLogin fails with user.ErrAccountLocked while the account or the IP
+// address is locked out
+func (a *application) checkLogin(ctx context.Context, email string, ip string) error {
+	return a.attemptService.Check(ctx, loginKeys(email, ip)...)
+}
+
+// loginFailed counts the failed login on the account and from the IP address,
+// and returns cause. The user is notified when their account gets locked.
+// Failures are counted outside of any transaction, so that they are kept when
+// the login is rolled back.
+func (a *application) loginFailed(ctx context.Context, email string, ip string, cause error) error {
+	acc, err := a.attemptService.Failed(ctx, attemptService.AccountKey(email), attemptService.AccountPolicy)
+	if err != nil {
+		return err
+	}
+
+	if ip != "" {
+		_, err = a.attemptService.Failed(ctx, attemptService.IPKey(ip), attemptService.IPPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
+	// only notify on the failure that locked the account first
+	if acc.Failures != attemptService.AccountPolicy.Free+1 {
+		return cause
+	}
+
+	u, err := a.userService.UserByEmail(ctx, email)
+	if err == user.ErrNotFound {
+		return cause
+	}
+	if err != nil {
+		return err
+	}
+
+	err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		return a.publish(ctx, events.AccountLocked{UserId: u.Id, LockedUntil: acc.LockedUntil})
+	})
+	if err != nil {
+		return err
+	}
+
+	return cause
+}
+
+// loginSucceeded forgets the failed logins on the account once the user is
+// fully logged in, second factor included. Those from the IP address are
+// kept, so that one valid account does not hide guessing others.
+func (a *application) loginSucceeded(ctx context.Context, email string) error {
+	return a.attemptService.Reset(ctx, attemptService.AccountKey(email))
+}
+
+// sendAccountLocked tells the user their account was locked, and how to unlock
+// it, if it still is
+func (a *application) sendAccountLocked(ctx context.Context, uId uuid.UUID, until time.Time) error {
+	u, err := a.userService.User(ctx, uId)
+	if err == user.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = a.attemptService.Check(ctx, attemptService.AccountKey(u.Email))
+	if err == nil || u.Deleted {
+		return nil
+	}
+	if err != user.ErrAccountLocked {
+		return err
+	}
+
+	return a.mailer.Send(ctx, a.accountLockedMail(u, until))
+}
+
+// sendLicenseReview tells the vet how the review of their license went
+func (a *application) sendLicenseReview(ctx context.Context, uId uuid.UUID, approved bool, note string) error {
+	v, err := a.userService.User(ctx, uId)
+	if err == user.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if v.Deleted {
+		return nil
+	}
+
+	return a.mailer.Send(ctx, a.licenseReviewMail(v, approved, note))
+}
+
+// checkVerifier checks that the user can verify records, which takes a vet
+// with an approved license
+func (a *application) checkVerifier(ctx context.Context, vetId uuid.UUID) error {
+	v, err := a.UserByType(ctx, vetId, user.Vet, true)
+	if err == user.ErrNotFound {
+		return record.ErrNotValidVerifier
+	}
+	if err != nil {
+		return err
+	}
+
+	if !v.LicenseApproved() {
+		return user.ErrVetNotApproved
+	}
+
+	return nil
+}
+
+// checkAssignable checks that the vet can be assigned to pets
+func (a *application) checkAssignable(ctx context.Context, vetId uuid.UUID) error {
+	v, err := a.UserByType(ctx, vetId, user.Vet, false)
+	if err != nil {
+		return err
+	}
+
+	if a.requireVerifiedVets && !v.EmailVerified {
+		return user.ErrVetNotVerified
+	}
+
+	return nil
+}
+
+// newSession starts a session of the user on the device and issues its tokens
+func (a *application) newSession(ctx context.Context, u user.User, opts services.SessionOptions) (services.Tokens, error) {
+	if u.Deleted {
+		return services.Tokens{}, user.ErrUserDeleted
+	}
+
+	if u.Disabled {
+		return services.Tokens{}, user.ErrUserDisabled
+	}
+
+	s, err := a.sessionService.CreateSession(ctx, u.Id, opts)
+	if err != nil {
+		return services.Tokens{}, err
+	}
+
+	return a.tokenService.Issue(ctx, u, s.Id)
+}
+
+// revokeSession revokes the session along with its refresh tokens
+func (a *application) revokeSession(ctx context.Context, id uuid.UUID) error {
+	return a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := a.sessionService.RevokeSession(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return a.tokenService.RevokeFamily(ctx, id)
+	})
+}
+
+func (a *application) revokeSessions(ctx context.Context, uId uuid.UUID, except uuid.UUID) error {
+	sessions, err := a.sessionService.UserSessions(ctx, uId)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if s.Id == except {
+			continue
+		}
+
+		err = a.revokeSession(ctx, s.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restorableSince returns the earliest deletion time that can still be restored
+func (a *application) restorableSince() time.Time {
+	return time.Now().Add(-a.restoreGracePeriod)
 }
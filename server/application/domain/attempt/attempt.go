@@ -0,0 +1,15 @@
+package attempt
+
+import (
+	"time"
+)
+
+// Attempt counts the failed logins on a key, e.g. an account or an IP address
+type Attempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+var Nil = Attempt{}
@@ -0,0 +1,10 @@
+package attempt
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned when no login failed on a key
+	ErrNotFound = errors.New("attempt not found")
+)
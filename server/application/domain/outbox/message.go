@@ -0,0 +1,23 @@
+package outbox
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Message is an event waiting in the outbox to be delivered to the subscribers
+type Message struct {
+	Id        uuid.UUID
+	CreatedAt time.Time
+	// Event is the name of the event and Payload its JSON encoding
+	Event         string
+	Payload       string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	// Dead is set once delivery failed too many times. Dead messages are kept
+	// for inspection but not retried.
+	Dead bool
+}
+
+var Nil = Message{}
@@ -10,4 +10,7 @@ var (
 	ErrNoValidName      = errors.New("a valid name should be provided")
 	ErrNoValidBreedname = errors.New("a valid breed should be provided")
 	ErrNoValidBirthDate = errors.New("a valid birthdate should be provided")
+	ErrConflict         = errors.New("pet was modified by another request")
+	ErrNotDeleted       = errors.New("pet is not deleted")
+	ErrRestoreExpired   = errors.New("pet can no longer be restored")
 )
@@ -33,6 +33,8 @@ type Pet struct {
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	Deleted     bool
+	DeletedAt   time.Time
+	Version     int64
 	Name        string
 	Avatar      string
 	DateOfBirth time.Time
@@ -12,4 +12,7 @@ var (
 	ErrNotValidDate     = errors.New("record date not valid")
 	ErrNotValidType     = errors.New("record type not valid")
 	ErrNotValidVerifier = errors.New("record cannot be validated by this user")
+	ErrConflict         = errors.New("record was modified by another request")
+	ErrNotDeleted       = errors.New("record is not deleted")
+	ErrRestoreExpired   = errors.New("record can no longer be restored")
 )
@@ -55,6 +55,8 @@ type Record struct {
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 	Deleted        bool
+	DeletedAt      time.Time
+	Version        int64
 	PetId          uuid.UUID
 	RecordType     Type
 	Name           string
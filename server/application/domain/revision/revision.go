@@ -0,0 +1,68 @@
+package revision
+
+import (
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"strconv"
+	"time"
+)
+
+// Revision is a change made to the content of a record
+type Revision struct {
+	Id        uuid.UUID
+	CreatedAt time.Time
+	RecordId  uuid.UUID
+	PetId     uuid.UUID
+	// Version is the version of the record the change produced
+	Version int64
+	// UserId is the user that made the change
+	UserId  uuid.UUID
+	Changes []Change
+}
+
+// Change is the value of a record field before and after a revision. Values
+// are formatted the way the API returns them, dates as unix milliseconds.
+type Change struct {
+	Field string
+	Old   string
+	New   string
+}
+
+var Nil = Revision{}
+
+// Diff returns the changes of the fields a user can edit between two versions
+// of a record. Diffing against record.Nil lists every field that is set.
+func Diff(old record.Record, new record.Record) []Change {
+	var changes []Change
+	add := func(field string, o string, n string) {
+		if o != n {
+			changes = append(changes, Change{Field: field, Old: o, New: n})
+		}
+	}
+
+	add("recordType", string(old.RecordType), string(new.RecordType))
+	add("name", old.Name, new.Name)
+	add("date", formatTime(old.Date), formatTime(new.Date))
+	add("lot", old.Lot, new.Lot)
+	add("result", old.Result, new.Result)
+	add("description", old.Description, new.Description)
+	add("notes", old.Notes, new.Notes)
+	add("administeredBy", formatId(old.AdministeredBy), formatId(new.AdministeredBy))
+	add("verifiedBy", formatId(old.VerifiedBy), formatId(new.VerifiedBy))
+
+	return changes
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func formatId(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,11 @@
+package session
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned when a session is not found
+	ErrNotFound = errors.New("session not found")
+	ErrRevoked  = errors.New("session revoked")
+)
@@ -0,0 +1,20 @@
+package session
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Session is a login of a user on a device. The access and refresh tokens
+// issued to the device carry its id, so revoking it logs the device out.
+type Session struct {
+	Id         uuid.UUID
+	CreatedAt  time.Time
+	UserId     uuid.UUID
+	UserAgent  string
+	IP         string
+	LastSeenAt time.Time
+	RevokedAt  time.Time
+}
+
+var Nil = Session{}
@@ -0,0 +1,13 @@
+package token
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned when a refresh token is not found
+	ErrNotFound = errors.New("token not found")
+	ErrExpired  = errors.New("token expired")
+	ErrRevoked  = errors.New("token revoked")
+	ErrReused   = errors.New("token was already used")
+)
@@ -0,0 +1,24 @@
+package token
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// RefreshToken lets a client get new access tokens without logging in again.
+// Only the hash of the token handed to the client is stored.
+type RefreshToken struct {
+	Id        uuid.UUID
+	CreatedAt time.Time
+	UserId    uuid.UUID
+	// FamilyId is shared by the tokens rotated from the same login. It is the
+	// id of the session of the login.
+	FamilyId  uuid.UUID
+	Hash      string
+	ExpiresAt time.Time
+	// UsedAt is set once the token has been exchanged for a new one
+	UsedAt    time.Time
+	RevokedAt time.Time
+}
+
+var Nil = RefreshToken{}
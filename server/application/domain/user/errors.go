@@ -19,4 +19,22 @@ var (
 	ErrPasswordUpperCase   = errors.New("password should contain at least one upper case character")
 	ErrPasswordDigit       = errors.New("password should contain atleast one digit")
 	ErrPasswordSpecialChar = errors.New("password should contain at least one special character")
+	ErrConflict            = errors.New("user was modified by another request")
+	ErrNotDeleted          = errors.New("user is not deleted")
+	ErrRestoreExpired      = errors.New("user can no longer be restored")
+	ErrVerificationInvalid = errors.New("invalid or expired verification link")
+	ErrAlreadyVerified     = errors.New("email is already verified")
+	ErrVetNotVerified      = errors.New("vet has not verified their email yet")
+	ErrTOTPEnabled         = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrTOTPNotEnrolled     = errors.New("two-factor authentication enrollment has not been started")
+	ErrTOTPCode            = errors.New("invalid two-factor authentication code")
+	ErrChallengeInvalid    = errors.New("invalid or expired login challenge")
+	ErrAccountLocked       = errors.New("too many failed logins, try again later")
+	ErrUserDisabled        = errors.New("user has been disabled")
+	ErrDisableSelf         = errors.New("admins cannot disable themselves")
+	ErrNoValidLicense      = errors.New("a valid licenseNumber and licenseAuthority should be provided")
+	ErrVetNotApproved      = errors.New("vet license has not been approved")
+	ErrLicenseNotPending   = errors.New("vet license is not pending review")
+	ErrNoValidPage         = errors.New("a valid offset and limit should be provided")
 )
@@ -12,13 +12,26 @@ type Type string
 const (
 	Vet   Type = "vet"
 	Owner Type = "owner"
+	// Admin users manage the other users. They cannot sign up, the first one
+	// is created with the create-admin command.
+	Admin Type = "admin"
 )
 
 var types = map[Type]Type{
 	Vet:   Vet,
 	Owner: Owner,
+	Admin: Admin,
 }
 
+// LicenseStatus is where the license of a vet is in the review by the admins
+type LicenseStatus string
+
+const (
+	LicensePending  LicenseStatus = "pending"
+	LicenseApproved LicenseStatus = "approved"
+	LicenseRejected LicenseStatus = "rejected"
+)
+
 func ParseType(value string) (Type, error) {
 	value = strings.TrimSpace(strings.ToLower(value))
 	typ, ok := types[Type(value)]
@@ -29,21 +42,55 @@ func ParseType(value string) (Type, error) {
 }
 
 type User struct {
-	Id           uuid.UUID
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	Deleted      bool
-	UserType     Type
-	Email        string
-	PasswordHash string
-	Name         string
-	Surname      string
-	Phone        string
-	Address      string
-	City         string
-	State        string
-	Country      string
-	Zip          string
+	Id            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Deleted       bool
+	DeletedAt     time.Time
+	Version       int64
+	UserType      Type
+	Email         string
+	EmailVerified bool
+	PasswordHash  string
+	Name          string
+	Surname       string
+	Phone         string
+	Address       string
+	City          string
+	State         string
+	Country       string
+	Zip           string
+	// TOTPSecret is the secret of the authenticator app of the user. It is set
+	// on enrollment, but is only asked for once TOTPEnabled.
+	TOTPSecret  string
+	TOTPEnabled bool
+	// TOTPLastStep is the time step of the last code used, which cannot be
+	// used again
+	TOTPLastStep int64
+	// RecoveryCodes are the hashes of the codes that can be used once each
+	// instead of a TOTP code
+	RecoveryCodes []string
+	// Disabled users were locked out by an admin and cannot log in
+	Disabled bool
+	// The license of a vet, which an admin checks before the vet can verify
+	// records. LicenseNote is why it was rejected.
+	LicenseNumber     string
+	LicenseAuthority  string
+	LicenseStatus     LicenseStatus
+	LicenseReviewedBy uuid.UUID
+	LicenseReviewedAt time.Time
+	LicenseNote       string
 }
 
 var Nil = User{}
+
+// LicenseApproved reports whether the user is a vet whose license was approved
+func (u User) LicenseApproved() bool {
+	return u.UserType == Vet && u.LicenseStatus == LicenseApproved
+}
+
+// LicensePending reports whether the user is a vet whose license awaits review.
+// Vets that signed up before licenses were asked for are pending too.
+func (u User) LicensePending() bool {
+	return u.UserType == Vet && u.LicenseStatus != LicenseApproved && u.LicenseStatus != LicenseRejected
+}
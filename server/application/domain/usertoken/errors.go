@@ -0,0 +1,12 @@
+package usertoken
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned when a token is not found
+	ErrNotFound = errors.New("token not found")
+	ErrExpired  = errors.New("token expired")
+	ErrUsed     = errors.New("token was already used")
+)
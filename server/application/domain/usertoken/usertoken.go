@@ -0,0 +1,27 @@
+package usertoken
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Purpose is what a token lets its holder do
+type Purpose string
+
+const (
+	PasswordReset Purpose = "password_reset"
+)
+
+// Token is a one-time token sent to a user, e.g. in a password reset email.
+// Only the hash of the token is stored.
+type Token struct {
+	Id        uuid.UUID
+	CreatedAt time.Time
+	UserId    uuid.UUID
+	Purpose   Purpose
+	Hash      string
+	ExpiresAt time.Time
+	UsedAt    time.Time
+}
+
+var Nil = Token{}
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Handler handles the events a subscriber registered for. A failing handler
+// gets the event again later, along with every other subscriber, so handlers
+// must be idempotent.
+type Handler func(ctx context.Context, e Event) error
+
+// Bus delivers the published events to every subscriber. Events reach the bus
+// through the outbox relay, after the change they describe is committed.
+type Bus interface {
+	Subscribe(h Handler)
+	// Publish calls every subscriber and returns the first error any of them
+	// failed with
+	Publish(ctx context.Context, events ...Event) error
+}
+
+type bus struct {
+	mux      sync.RWMutex
+	handlers []Handler
+}
+
+func NewBus() Bus {
+	return &bus{}
+}
+
+func (b *bus) Subscribe(h Handler) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.handlers = append(b.handlers, h)
+}
+
+func (b *bus) Publish(ctx context.Context, events ...Event) error {
+	b.mux.RLock()
+	handlers := b.handlers
+	b.mux.RUnlock()
+
+	var firstErr error
+	for _, e := range events {
+		for _, h := range handlers {
+			err := deliver(ctx, h, e)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// deliver calls h, turning a panicking subscriber into a failed delivery
+func deliver(ctx context.Context, h Handler, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("subscriber panicked handling %s: %v", e.Name(), r)
+		}
+	}()
+
+	return h(ctx, e)
+}
+
+// On subscribes fn to the events of type E only
+func On[E Event](b Bus, fn func(ctx context.Context, e E) error) {
+	b.Subscribe(func(ctx context.Context, e Event) error {
+		if e, ok := e.(E); ok {
+			return fn(ctx, e)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var ErrUnknownEvent = errors.New("unknown event")
+
+var decoders = map[string]func(payload []byte) (Event, error){
+	UserRegistered{}.Name():    decode[UserRegistered],
+	UserUpdated{}.Name():       decode[UserUpdated],
+	UserDeleted{}.Name():       decode[UserDeleted],
+	UserRestored{}.Name():      decode[UserRestored],
+	PasswordChanged{}.Name():   decode[PasswordChanged],
+	EmailChanged{}.Name():      decode[EmailChanged],
+	EmailVerified{}.Name():     decode[EmailVerified],
+	TwoFactorEnabled{}.Name():  decode[TwoFactorEnabled],
+	TwoFactorDisabled{}.Name(): decode[TwoFactorDisabled],
+	UserDisabled{}.Name():      decode[UserDisabled],
+	UserEnabled{}.Name():       decode[UserEnabled],
+	LicenseApproved{}.Name():   decode[LicenseApproved],
+	LicenseRejected{}.Name():   decode[LicenseRejected],
+	AccountLocked{}.Name():     decode[AccountLocked],
+	PetCreated{}.Name():        decode[PetCreated],
+	PetUpdated{}.Name():        decode[PetUpdated],
+	PetDeleted{}.Name():        decode[PetDeleted],
+	PetRestored{}.Name():       decode[PetRestored],
+	VetAssigned{}.Name():       decode[VetAssigned],
+	VetUnassigned{}.Name():     decode[VetUnassigned],
+	RecordCreated{}.Name():     decode[RecordCreated],
+	RecordUpdated{}.Name():     decode[RecordUpdated],
+	RecordVerified{}.Name():    decode[RecordVerified],
+	RecordDeleted{}.Name():     decode[RecordDeleted],
+	RecordRestored{}.Name():    decode[RecordRestored],
+}
+
+// Encode returns the JSON payload e is stored with in the outbox
+func Encode(e Event) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Decode converts a payload written by Encode back to the event named name
+func Decode(name string, payload []byte) (Event, error) {
+	dec, ok := decoders[name]
+	if !ok {
+		return nil, ErrUnknownEvent
+	}
+
+	return dec(payload)
+}
+
+func decode[E Event](payload []byte) (Event, error) {
+	var e E
+	err := json.Unmarshal(payload, &e)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
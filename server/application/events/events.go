@@ -0,0 +1,213 @@
+package events
+
+import (
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/pet"
+	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"time"
+)
+
+// Event is something that happened in the application. Name identifies the
+// kind of event outside the process, e.g. in webhooks.
+type Event interface {
+	Name() string
+}
+
+// Profile is the part of a user that events carry. The credentials are left
+// out, as events are stored in the outbox and handed to every subscriber.
+type Profile struct {
+	Id               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Version          int64
+	UserType         user.Type
+	Email            string
+	EmailVerified    bool
+	Name             string
+	Surname          string
+	Phone            string
+	Address          string
+	City             string
+	State            string
+	Country          string
+	Zip              string
+	TOTPEnabled      bool
+	Disabled         bool
+	LicenseNumber    string
+	LicenseAuthority string
+	LicenseStatus    user.LicenseStatus
+}
+
+// ProfileOf returns the profile of u
+func ProfileOf(u user.User) Profile {
+	return Profile{
+		Id:               u.Id,
+		CreatedAt:        u.CreatedAt,
+		UpdatedAt:        u.UpdatedAt,
+		Version:          u.Version,
+		UserType:         u.UserType,
+		Email:            u.Email,
+		EmailVerified:    u.EmailVerified,
+		Name:             u.Name,
+		Surname:          u.Surname,
+		Phone:            u.Phone,
+		Address:          u.Address,
+		City:             u.City,
+		State:            u.State,
+		Country:          u.Country,
+		Zip:              u.Zip,
+		TOTPEnabled:      u.TOTPEnabled,
+		Disabled:         u.Disabled,
+		LicenseNumber:    u.LicenseNumber,
+		LicenseAuthority: u.LicenseAuthority,
+		LicenseStatus:    u.LicenseStatus,
+	}
+}
+
+type UserRegistered struct {
+	User Profile
+}
+
+type UserUpdated struct {
+	User Profile
+}
+
+type UserDeleted struct {
+	UserId uuid.UUID
+}
+
+type UserRestored struct {
+	User Profile
+}
+
+type PasswordChanged struct {
+	UserId uuid.UUID
+}
+
+// EmailChanged is published when a user changes their email, which then
+// needs to be verified again
+type EmailChanged struct {
+	UserId uuid.UUID
+	Email  string
+}
+
+type EmailVerified struct {
+	UserId uuid.UUID
+}
+
+type TwoFactorEnabled struct {
+	UserId uuid.UUID
+}
+
+type TwoFactorDisabled struct {
+	UserId uuid.UUID
+}
+
+type UserDisabled struct {
+	UserId uuid.UUID
+	// AdminId is the admin that disabled the user
+	AdminId uuid.UUID
+}
+
+type UserEnabled struct {
+	UserId uuid.UUID
+}
+
+type LicenseApproved struct {
+	UserId uuid.UUID
+	// AdminId is the admin that reviewed the license
+	AdminId uuid.UUID
+}
+
+type LicenseRejected struct {
+	UserId  uuid.UUID
+	AdminId uuid.UUID
+	Note    string
+}
+
+// AccountLocked is published when too many logins failed on the account
+type AccountLocked struct {
+	UserId      uuid.UUID
+	LockedUntil time.Time
+}
+
+type PetCreated struct {
+	Pet pet.Pet
+}
+
+type PetUpdated struct {
+	Pet pet.Pet
+}
+
+type PetDeleted struct {
+	PetId   uuid.UUID
+	OwnerId uuid.UUID
+}
+
+type PetRestored struct {
+	Pet pet.Pet
+}
+
+type VetAssigned struct {
+	PetId uuid.UUID
+	VetId uuid.UUID
+}
+
+type VetUnassigned struct {
+	PetId uuid.UUID
+	VetId uuid.UUID
+}
+
+type RecordCreated struct {
+	Record record.Record
+}
+
+type RecordUpdated struct {
+	Record record.Record
+	// UserId is the user that updated the record
+	UserId uuid.UUID
+}
+
+// RecordVerified is published when a vet verifies a record, either on creation
+// or on update
+type RecordVerified struct {
+	Record record.Record
+}
+
+type RecordDeleted struct {
+	RecordId uuid.UUID
+	PetId    uuid.UUID
+	// UserId is the user that deleted the record
+	UserId uuid.UUID
+}
+
+type RecordRestored struct {
+	Record record.Record
+}
+
+func (UserRegistered) Name() string    { return "user.registered" }
+func (UserUpdated) Name() string       { return "user.updated" }
+func (UserDeleted) Name() string       { return "user.deleted" }
+func (UserRestored) Name() string      { return "user.restored" }
+func (PasswordChanged) Name() string   { return "user.password_changed" }
+func (EmailChanged) Name() string      { return "user.email_changed" }
+func (EmailVerified) Name() string     { return "user.email_verified" }
+func (TwoFactorEnabled) Name() string  { return "user.two_factor_enabled" }
+func (TwoFactorDisabled) Name() string { return "user.two_factor_disabled" }
+func (UserDisabled) Name() string      { return "user.disabled" }
+func (UserEnabled) Name() string       { return "user.enabled" }
+func (LicenseApproved) Name() string   { return "user.license_approved" }
+func (LicenseRejected) Name() string   { return "user.license_rejected" }
+func (AccountLocked) Name() string     { return "user.account_locked" }
+func (PetCreated) Name() string        { return "pet.created" }
+func (PetUpdated) Name() string        { return "pet.updated" }
+func (PetDeleted) Name() string        { return "pet.deleted" }
+func (PetRestored) Name() string       { return "pet.restored" }
+func (VetAssigned) Name() string       { return "pet.vet_assigned" }
+func (VetUnassigned) Name() string     { return "pet.vet_unassigned" }
+func (RecordCreated) Name() string     { return "record.created" }
+func (RecordUpdated) Name() string     { return "record.updated" }
+func (RecordVerified) Name() string    { return "record.verified" }
+func (RecordDeleted) Name() string     { return "record.deleted" }
+func (RecordRestored) Name() string    { return "record.restored" }
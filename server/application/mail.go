@@ -0,0 +1,76 @@
+package application
+
+import (
+	"fmt"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/application/mailer"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// link returns the URL of the UI page with the given query
+func (a *application) link(page string, query url.Values) string {
+	return strings.TrimSuffix(a.publicURL, "/") + page + "?" + query.Encode()
+}
+
+func (a *application) passwordResetMail(u user.User, token string) mailer.Message {
+	link := a.link("/auth/reset", url.Values{"token": {token}})
+
+	return mailer.Message{
+		To:      u.Email,
+		Subject: "Reset your Pet Journal password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your Pet Journal account. If it was you, "+
+			"follow the link below to choose a new password. It expires in an hour.\n\n%s\n\n"+
+			"If it was not you, you can ignore this email.\n", u.Name, link),
+	}
+}
+
+func (a *application) verificationMail(u user.User, token string) mailer.Message {
+	link := a.link("/auth/verify", url.Values{"token": {token}})
+
+	return mailer.Message{
+		To:      u.Email,
+		Subject: "Verify your Pet Journal email",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Follow the link below to verify the email of your Pet Journal account. It expires in a week.\n\n%s\n\n"+
+			"If you did not sign up for Pet Journal, you can ignore this email.\n", u.Name, link),
+	}
+}
+
+func (a *application) accountLockedMail(u user.User, until time.Time) mailer.Message {
+	link := a.link("/auth/forgot", url.Values{"email": {u.Email}})
+
+	return mailer.Message{
+		To:      u.Email,
+		Subject: "Your Pet Journal account was locked",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"There were too many failed logins on your Pet Journal account, so logging in is blocked "+
+			"until %s. If it was not you, someone may be guessing your password. Resetting your "+
+			"password unlocks the account right away:\n\n%s\n", u.Name, until.UTC().Format(time.RFC1123), link),
+	}
+}
+
+func (a *application) licenseReviewMail(v user.User, approved bool, note string) mailer.Message {
+	if approved {
+		return mailer.Message{
+			To:      v.Email,
+			Subject: "Your Pet Journal vet license was approved",
+			Body: fmt.Sprintf("Hi %s,\n\n"+
+				"Your license was approved. The records you write are now shown as verified.\n", v.Name),
+		}
+	}
+
+	if note != "" {
+		note = "\n\n" + note
+	}
+
+	return mailer.Message{
+		To:      v.Email,
+		Subject: "Your Pet Journal vet license was rejected",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Your license could not be approved.%s\n\n"+
+			"You can submit another license from your profile.\n", v.Name, note),
+	}
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFile returns a Mailer that writes each email to an .eml file in dir, which
+// is created if needed. It is meant for local development and tests.
+func NewFile(dir string, from string) (Mailer, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileMailer{dir: dir, from: from}, nil
+}
+
+func (f fileMailer) Send(ctx context.Context, m Message) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	// the timestamp keeps the files in the order they were sent
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000"), id)
+
+	return os.WriteFile(filepath.Join(f.dir, name), format(f.from, m), 0o644)
+}
@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type logMailer struct {
+	mux  sync.Mutex
+	w    io.Writer
+	from string
+}
+
+// NewLog returns a Mailer that writes the emails to w instead of sending them.
+// It is meant for local development.
+func NewLog(w io.Writer, from string) Mailer {
+	return &logMailer{w: w, from: from}
+}
+
+func (l *logMailer) Send(ctx context.Context, m Message) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	_, err := fmt.Fprintf(l.w, "----- email -----\n%s\n-----------------\n", format(l.from, m))
+
+	return err
+}
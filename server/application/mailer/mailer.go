@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends the emails of the application, e.g. the password reset links
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// format renders the message as an RFC 5322 email from the given address
+func format(from string, m Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(m.Body)
+
+	return b.Bytes()
+}
@@ -0,0 +1,22 @@
+package mailer
+
+import (
+	"context"
+	"net/smtp"
+)
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP returns a Mailer that sends the emails through the SMTP server at
+// addr, e.g. "smtp.example.com:587". auth may be nil.
+func NewSMTP(addr string, auth smtp.Auth, from string) Mailer {
+	return smtpMailer{addr: addr, auth: auth, from: from}
+}
+
+func (s smtpMailer) Send(ctx context.Context, m Message) error {
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{m.To}, format(s.from, m))
+}
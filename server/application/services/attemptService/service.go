@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"github.com/scarlettmiss/petJournal/application/domain/attempt"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/repositories/attemptrepo"
+	"strings"
+	"time"
+)
+
+// Window is how long a failed login is remembered
+const Window = 24 * time.Hour
+
+// Policy is how many logins may fail on a key before it is locked, and for how
+// long. Every further failure doubles the lockout, up to MaxLockout.
+type Policy struct {
+	Free       int
+	Lockout    time.Duration
+	MaxLockout time.Duration
+}
+
+var (
+	AccountPolicy = Policy{Free: 5, Lockout: 30 * time.Second, MaxLockout: time.Hour}
+	// IPPolicy allows more failures, since many users may share an address
+	IPPolicy = Policy{Free: 50, Lockout: 30 * time.Second, MaxLockout: time.Hour}
+)
+
+// AccountKey returns the key the failed logins on an account are counted by.
+// It is derived from the email, so that logins on unknown accounts count too.
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// IPKey returns the key the failed logins from an IP address are counted by
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+type Service interface {
+	Check(ctx context.Context, keys ...string) error
+	Failed(ctx context.Context, key string, p Policy) (attempt.Attempt, error)
+	Reset(ctx context.Context, keys ...string) error
+	Purge(ctx context.Context) error
+}
+
+type service struct {
+	repo attemptrepo.Repository
+}
+
+func New(repo attemptrepo.Repository) (Service, error) {
+	return service{repo: repo}, nil
+}
+
+// Check fails with user.ErrAccountLocked if any of the keys is locked
+func (s service) Check(ctx context.Context, keys ...string) error {
+	now := time.Now()
+	for _, key := range keys {
+		a, err := s.repo.Attempt(ctx, key)
+		if err == attempt.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if a.LockedUntil.After(now) {
+			return user.ErrAccountLocked
+		}
+	}
+
+	return nil
+}
+
+// Failed counts a failed login on the key and locks it once the policy allows
+// no more failures
+func (s service) Failed(ctx context.Context, key string, p Policy) (attempt.Attempt, error) {
+	now := time.Now()
+	a, err := s.repo.AddFailure(ctx, key, now, now.Add(-Window))
+	if err != nil {
+		return attempt.Nil, err
+	}
+
+	if a.Failures <= p.Free {
+		return a, nil
+	}
+
+	lockout := p.Lockout
+	for i := p.Free + 1; i < a.Failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > p.MaxLockout {
+		lockout = p.MaxLockout
+	}
+
+	a.LockedUntil = now.Add(lockout)
+	err = s.repo.Lock(ctx, key, a.LockedUntil)
+	if err != nil {
+		return attempt.Nil, err
+	}
+
+	return a, nil
+}
+
+// Reset forgets the failed logins on the keys and unlocks them
+func (s service) Reset(ctx context.Context, keys ...string) error {
+	return s.repo.DeleteAttempts(ctx, keys)
+}
+
+// Purge deletes the attempts that are no longer remembered nor locked
+func (s service) Purge(ctx context.Context) error {
+	return s.repo.PurgeAttempts(ctx, time.Now().Add(-Window))
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
 	"time"
 )
 
@@ -34,6 +35,7 @@ type PetUpdateOptions struct {
 	OwnerId     uuid.UUID
 	VetId       uuid.UUID
 	Metas       map[string]string
+	Version     int64
 }
 
 type RecordCreateOptions struct {
@@ -75,11 +77,20 @@ type RecordUpdateOptions struct {
 	NextDate       time.Time
 	VerifiedBy     uuid.UUID
 	AdministeredBy uuid.UUID
+	UpdatedBy      uuid.UUID
+	Version        int64
+}
+
+// SessionOptions describe the device a user logs in from
+type SessionOptions struct {
+	UserAgent string
+	IP        string
 }
 
 type LoginOptions struct {
 	Email    string
 	Password string
+	Session  SessionOptions
 }
 
 type UserCreateOptions struct {
@@ -94,6 +105,24 @@ type UserCreateOptions struct {
 	State    string
 	Country  string
 	Zip      string
+	// The license of a vet. Both are required of vets.
+	LicenseNumber    string
+	LicenseAuthority string
+	Session          SessionOptions
+}
+
+type PasswordChangeOptions struct {
+	UserId          uuid.UUID
+	CurrentPassword string
+	Password        string
+	// SessionId is the session the password is changed from. The other
+	// sessions of the user are revoked.
+	SessionId uuid.UUID
+}
+
+type PasswordResetOptions struct {
+	Token    string
+	Password string
 }
 
 type UserUpdateOptions struct {
@@ -107,4 +136,69 @@ type UserUpdateOptions struct {
 	State   string
 	Country string
 	Zip     string
+	// LicenseNumber and LicenseAuthority replace the license of a vet when
+	// set, which is then reviewed again
+	LicenseNumber    string
+	LicenseAuthority string
+	Version          int64
+}
+
+// UserQuery filters the users an admin lists. Empty fields match every user.
+type UserQuery struct {
+	// Text is searched for in the email, name and surname, ignoring case
+	Text       string
+	Type       user.Type
+	IncludeDel bool
+	// Offset skips that many matching users and Limit caps how many are
+	// listed. A zero Limit lists them all.
+	Offset int
+	Limit  int
+}
+
+// PurgeResult lists what a purge hard-deleted
+type PurgeResult struct {
+	UserIds   []uuid.UUID
+	PetIds    []uuid.UUID
+	RecordIds []uuid.UUID
+}
+
+// RelayResult lists what a pass of the outbox relay did
+type RelayResult struct {
+	Delivered int
+	// Failed counts the messages that will be retried later
+	Failed int
+	// DeadLettered lists the messages given up on in this pass
+	DeadLettered []uuid.UUID
+}
+
+// Challenge is what a login of a user with two-factor authentication returns
+// instead of tokens. It is answered with a code to get the tokens.
+type Challenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+type ChallengeOptions struct {
+	Challenge string
+	// Code is a TOTP code or a recovery code
+	Code    string
+	Session SessionOptions
+}
+
+// TOTPEnrollment is what authenticator apps need to generate the codes of a
+// user
+type TOTPEnrollment struct {
+	Secret string
+	// URI is the otpauth URI of the secret, usually shown as a QR code
+	URI string
+}
+
+// Tokens are what a user is issued when they log in or refresh their session
+type Tokens struct {
+	AccessToken string
+	// ExpiresAt is when the access token expires
+	ExpiresAt time.Time
+	// RefreshToken is exchanged for new tokens once the access token expires.
+	// It can be used only once.
+	RefreshToken string
 }
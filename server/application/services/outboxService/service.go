@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/outbox"
+	"github.com/scarlettmiss/petJournal/application/events"
+	"github.com/scarlettmiss/petJournal/repositories/outboxrepo"
+	"time"
+)
+
+const (
+	// MaxAttempts is how many times a message is delivered before it is
+	// dead-lettered
+	MaxAttempts = 12
+	retryDelay  = time.Second
+	maxDelay    = time.Hour
+)
+
+type Service interface {
+	Enqueue(ctx context.Context, evs ...events.Event) error
+	DueMessages(ctx context.Context, limit int) ([]outbox.Message, error)
+	Delivered(ctx context.Context, id uuid.UUID) error
+	Failed(ctx context.Context, m outbox.Message, cause error) (outbox.Message, error)
+}
+
+type service struct {
+	repo outboxrepo.Repository
+}
+
+func New(repo outboxrepo.Repository) (Service, error) {
+	return service{repo: repo}, nil
+}
+
+// Enqueue stores evs to be relayed to the bus. It must run in the transaction
+// of the change the events describe.
+func (s service) Enqueue(ctx context.Context, evs ...events.Event) error {
+	now := time.Now()
+
+	msgs := make([]outbox.Message, len(evs))
+	for i, e := range evs {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return err
+		}
+
+		payload, err := events.Encode(e)
+		if err != nil {
+			return err
+		}
+
+		msgs[i] = outbox.Message{
+			Id:            id,
+			CreatedAt:     now,
+			Event:         e.Name(),
+			Payload:       string(payload),
+			NextAttemptAt: now,
+		}
+	}
+
+	return s.repo.CreateMessages(ctx, msgs)
+}
+
+func (s service) DueMessages(ctx context.Context, limit int) ([]outbox.Message, error) {
+	return s.repo.DueMessages(ctx, time.Now(), limit)
+}
+
+func (s service) Delivered(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteMessage(ctx, id)
+}
+
+// Failed schedules the message to be retried with an exponential backoff, or
+// marks it dead once it has been attempted MaxAttempts times
+func (s service) Failed(ctx context.Context, m outbox.Message, cause error) (outbox.Message, error) {
+	m.Attempts++
+	m.LastError = cause.Error()
+
+	if m.Attempts >= MaxAttempts {
+		m.Dead = true
+	} else {
+		m.NextAttemptAt = time.Now().Add(backoff(m.Attempts))
+	}
+
+	err := s.repo.UpdateMessage(ctx, m)
+	if err != nil {
+		return outbox.Nil, err
+	}
+
+	return m, nil
+}
+
+func backoff(attempts int) time.Duration {
+	delay := retryDelay << (attempts - 1)
+	if delay <= 0 || delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
@@ -1,24 +1,36 @@
 package service
 
 import (
+	"context"
 	"github.com/google/uuid"
+	"github.com/samber/lo"
 	"github.com/scarlettmiss/petJournal/application/domain/pet"
 	"github.com/scarlettmiss/petJournal/application/services"
 	"github.com/scarlettmiss/petJournal/repositories/petrepo"
 	textUtils "github.com/scarlettmiss/petJournal/utils/text"
+	"time"
 )
 
 type Service interface {
-	Pet(id uuid.UUID) (pet.Pet, error)
-	PetByUser(uid uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error)
-	Pets(includeDel bool) ([]pet.Pet, error)
-	PetsByUser(userId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error)
-	CreatePet(opts services.PetCreateOptions) (pet.Pet, error)
-	UpdatePet(opts services.PetUpdateOptions) (pet.Pet, error)
-	DeletePet(uId uuid.UUID, id uuid.UUID) error
-	removeVet(id uuid.UUID) error
-	petsByOwner(userId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error)
-	petByOwner(uid uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error)
+	Pet(ctx context.Context, id uuid.UUID) (pet.Pet, error)
+	PetByUser(ctx context.Context, uid uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error)
+	Pets(ctx context.Context, includeDel bool) ([]pet.Pet, error)
+	PetsByIds(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]pet.Pet, error)
+	PetsByUser(ctx context.Context, userId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error)
+	CreatePet(ctx context.Context, opts services.PetCreateOptions) (pet.Pet, error)
+	UpdatePet(ctx context.Context, opts services.PetUpdateOptions) (pet.Pet, error)
+	DeletePet(ctx context.Context, uId uuid.UUID, id uuid.UUID) error
+	DeletePetsByOwner(ctx context.Context, ownerId uuid.UUID) ([]uuid.UUID, error)
+	UnassignVet(ctx context.Context, vetId uuid.UUID) error
+	DeletedPet(ctx context.Context, uId uuid.UUID, id uuid.UUID, since time.Time) (pet.Pet, error)
+	DeletedPetsByOwner(ctx context.Context, ownerId uuid.UUID, since time.Time) (map[uuid.UUID]pet.Pet, error)
+	RestorePet(ctx context.Context, p pet.Pet) (pet.Pet, error)
+	RestorePetsByOwner(ctx context.Context, ownerId uuid.UUID, since time.Time) ([]uuid.UUID, error)
+	PetsToPurge(ctx context.Context, before time.Time, ownerIds []uuid.UUID) ([]uuid.UUID, error)
+	PurgePets(ctx context.Context, ids []uuid.UUID) error
+	removeVet(ctx context.Context, id uuid.UUID) error
+	petsByOwner(ctx context.Context, userId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error)
+	petByOwner(ctx context.Context, uid uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error)
 }
 
 type service struct {
@@ -29,46 +41,46 @@ func New(repo petrepo.Repository) (Service, error) {
 	return service{repo: repo}, nil
 }
 
-func (s service) Pet(id uuid.UUID) (pet.Pet, error) {
-	return s.repo.Pet(id)
+func (s service) Pet(ctx context.Context, id uuid.UUID) (pet.Pet, error) {
+	return s.repo.Pet(ctx, id)
 }
 
-func (s service) PetByUser(uId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
-	pets, err := s.PetsByUser(uId, includeDel)
-	if err != nil {
-		return pet.Nil, err
-	}
-
-	p, ok := pets[id]
-	if !ok {
-		return pet.Nil, pet.ErrNotFound
-	}
+func (s service) PetByUser(ctx context.Context, uId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
+	return s.repo.PetByUser(ctx, uId, id, includeDel)
+}
 
-	return p, nil
+func (s service) Pets(ctx context.Context, includeDel bool) ([]pet.Pet, error) {
+	return s.repo.Pets(ctx, includeDel)
 }
 
-func (s service) Pets(includeDel bool) ([]pet.Pet, error) {
-	return s.repo.Pets(includeDel)
+func (s service) PetsByIds(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]pet.Pet, error) {
+	pets, err := s.repo.PetsByIds(ctx, lo.Uniq(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.KeyBy(pets, func(p pet.Pet) uuid.UUID { return p.Id }), nil
 }
 
-func (s service) PetsByUser(uId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error) {
-	uPets := make(map[uuid.UUID]pet.Pet)
+func (s service) PetsByUser(ctx context.Context, uId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error) {
+	uPets, err := s.petsByOwner(ctx, uId, includeDel)
+	if err != nil {
+		return uPets, err
+	}
 
-	pets, err := s.Pets(includeDel)
+	pets, err := s.repo.PetsByVet(ctx, uId, includeDel)
 	if err != nil {
 		return uPets, err
 	}
 
 	for _, p := range pets {
-		if p.OwnerId == uId || p.VetId == uId {
-			uPets[p.Id] = p
-		}
+		uPets[p.Id] = p
 	}
 
 	return uPets, nil
 }
 
-func (s service) CreatePet(opts services.PetCreateOptions) (pet.Pet, error) {
+func (s service) CreatePet(ctx context.Context, opts services.PetCreateOptions) (pet.Pet, error) {
 	if textUtils.TextIsEmpty(opts.Name) {
 		return pet.Nil, pet.ErrNoValidName
 	}
@@ -99,15 +111,19 @@ func (s service) CreatePet(opts services.PetCreateOptions) (pet.Pet, error) {
 	p.VetId = opts.VetId
 	p.Metas = opts.Metas
 	p.Avatar = opts.Avatar
-	return s.repo.CreatePet(p)
+	return s.repo.CreatePet(ctx, p)
 }
 
-func (s service) UpdatePet(opts services.PetUpdateOptions) (pet.Pet, error) {
-	p, err := s.PetByUser(opts.OwnerId, opts.Id, false)
+func (s service) UpdatePet(ctx context.Context, opts services.PetUpdateOptions) (pet.Pet, error) {
+	p, err := s.PetByUser(ctx, opts.OwnerId, opts.Id, false)
 	if err != nil {
 		return pet.Nil, err
 	}
 
+	if opts.Version != 0 && opts.Version != p.Version {
+		return pet.Nil, pet.ErrConflict
+	}
+
 	if textUtils.TextIsEmpty(opts.Name) {
 		return pet.Nil, pet.ErrNoValidName
 	}
@@ -137,62 +153,181 @@ func (s service) UpdatePet(opts services.PetUpdateOptions) (pet.Pet, error) {
 	p.Metas = opts.Metas
 	p.Avatar = opts.Avatar
 
-	return s.repo.UpdatePet(p)
+	return s.repo.UpdatePet(ctx, p)
 }
 
-func (s service) DeletePet(uId uuid.UUID, id uuid.UUID) error {
-	_, err := s.petByOwner(uId, id, true)
+func (s service) DeletePet(ctx context.Context, uId uuid.UUID, id uuid.UUID) error {
+	_, err := s.petByOwner(ctx, uId, id, true)
 
 	if err != nil {
 		// if it's not the owner then check if it's the pet vet
 		// in this case we don't want to delete the pet but we
 		//want to remove the vet
 		if err == pet.ErrNotFound {
-			return s.removeVet(id)
+			return s.removeVet(ctx, id)
 		}
 		return err
 	}
 
-	return s.repo.DeletePet(id)
+	return s.repo.DeletePet(ctx, id)
 }
 
-func (s service) removeVet(id uuid.UUID) error {
-	p, err := s.Pet(id)
+func (s service) DeletePetsByOwner(ctx context.Context, ownerId uuid.UUID) ([]uuid.UUID, error) {
+	pets, err := s.repo.PetsByOwner(ctx, ownerId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(pets))
+	for _, p := range pets {
+		err = s.repo.DeletePet(ctx, p.Id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, p.Id)
+	}
+
+	return ids, nil
+}
+
+func (s service) UnassignVet(ctx context.Context, vetId uuid.UUID) error {
+	pets, err := s.repo.PetsByVet(ctx, vetId, true)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pets {
+		p.VetId = uuid.Nil
+
+		_, err = s.repo.UpdatePet(ctx, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeletedPet returns the pet of the owner if it was deleted at or after since
+func (s service) DeletedPet(ctx context.Context, uId uuid.UUID, id uuid.UUID, since time.Time) (pet.Pet, error) {
+	p, err := s.petByOwner(ctx, uId, id, true)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	if !p.Deleted {
+		return pet.Nil, pet.ErrNotDeleted
+	}
+
+	if p.DeletedAt.Before(since) {
+		return pet.Nil, pet.ErrRestoreExpired
+	}
+
+	return p, nil
+}
+
+func (s service) DeletedPetsByOwner(ctx context.Context, ownerId uuid.UUID, since time.Time) (map[uuid.UUID]pet.Pet, error) {
+	pets, err := s.petsByOwner(ctx, ownerId, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, p := range pets {
+		if !p.Deleted || p.DeletedAt.Before(since) {
+			delete(pets, id)
+		}
+	}
+
+	return pets, nil
+}
+
+func (s service) RestorePet(ctx context.Context, p pet.Pet) (pet.Pet, error) {
+	p.Deleted = false
+	p.DeletedAt = time.Time{}
+
+	return s.repo.UpdatePet(ctx, p)
+}
+
+func (s service) RestorePetsByOwner(ctx context.Context, ownerId uuid.UUID, since time.Time) ([]uuid.UUID, error) {
+	pets, err := s.DeletedPetsByOwner(ctx, ownerId, since)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(pets))
+	for _, p := range pets {
+		_, err = s.RestorePet(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, p.Id)
+	}
+
+	return ids, nil
+}
+
+// PetsToPurge returns the pets deleted before the given time along with every
+// pet of the owners, which were deleted with them.
+func (s service) PetsToPurge(ctx context.Context, before time.Time, ownerIds []uuid.UUID) ([]uuid.UUID, error) {
+	pets, err := s.repo.PetsDeletedBefore(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ownerId := range ownerIds {
+		owned, err := s.repo.PetsByOwner(ctx, ownerId, true)
+		if err != nil {
+			return nil, err
+		}
+		pets = append(pets, owned...)
+	}
+
+	ids := make(map[uuid.UUID]bool, len(pets))
+	for _, p := range pets {
+		ids[p.Id] = true
+	}
+
+	return lo.Keys(ids), nil
+}
+
+func (s service) PurgePets(ctx context.Context, ids []uuid.UUID) error {
+	return s.repo.PurgePets(ctx, ids)
+}
+
+func (s service) removeVet(ctx context.Context, id uuid.UUID) error {
+	p, err := s.Pet(ctx, id)
 
 	if err != nil {
 		return err
 	}
 	p.VetId = uuid.Nil
 
-	_, err = s.repo.UpdatePet(p)
+	_, err = s.repo.UpdatePet(ctx, p)
 	return err
 }
 
-func (s service) petsByOwner(uId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error) {
+func (s service) petsByOwner(ctx context.Context, uId uuid.UUID, includeDel bool) (map[uuid.UUID]pet.Pet, error) {
 	uPets := make(map[uuid.UUID]pet.Pet)
 
-	pets, err := s.Pets(includeDel)
+	pets, err := s.repo.PetsByOwner(ctx, uId, includeDel)
 	if err != nil {
 		return uPets, err
 	}
 
 	for _, p := range pets {
-		if p.OwnerId == uId {
-			uPets[p.Id] = p
-		}
+		uPets[p.Id] = p
 	}
 
 	return uPets, nil
 }
 
-func (s service) petByOwner(uId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
-	pets, err := s.petsByOwner(uId, includeDel)
+func (s service) petByOwner(ctx context.Context, uId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
+	p, err := s.Pet(ctx, id)
 	if err != nil {
 		return pet.Nil, err
 	}
 
-	p, ok := pets[id]
-	if !ok {
+	if p.OwnerId != uId || (p.Deleted && !includeDel) {
 		return pet.Nil, pet.ErrNotFound
 	}
 
@@ -1,8 +1,8 @@
 package service
 
 import (
+	"context"
 	"github.com/google/uuid"
-	"github.com/samber/lo"
 	"github.com/scarlettmiss/petJournal/application/domain/record"
 	"github.com/scarlettmiss/petJournal/application/services"
 	"github.com/scarlettmiss/petJournal/repositories/recordrepo"
@@ -11,14 +11,20 @@ import (
 )
 
 type Service interface {
-	record(id uuid.UUID) (record.Record, error)
-	PetsRecords(pIds []uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error)
-	PetRecords(pId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error)
-	PetRecord(pId uuid.UUID, rId uuid.UUID, includeDel bool) (record.Record, error)
-	CreateRecord(opts services.RecordCreateOptions) (record.Record, error)
-	CreateRecords(opts services.RecordsCreateOptions) (map[uuid.UUID]record.Record, error)
-	UpdateRecord(opts services.RecordUpdateOptions) (record.Record, error)
-	DeleteRecord(id uuid.UUID) error
+	Record(ctx context.Context, id uuid.UUID) (record.Record, error)
+	PetsRecords(ctx context.Context, pIds []uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error)
+	PetRecords(ctx context.Context, pId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error)
+	PetRecord(ctx context.Context, pId uuid.UUID, rId uuid.UUID, includeDel bool) (record.Record, error)
+	CreateRecord(ctx context.Context, opts services.RecordCreateOptions) (record.Record, error)
+	CreateRecords(ctx context.Context, opts services.RecordsCreateOptions) (map[uuid.UUID]record.Record, error)
+	UpdateRecord(ctx context.Context, opts services.RecordUpdateOptions) (record.Record, error)
+	DeleteRecord(ctx context.Context, id uuid.UUID) error
+	DeletePetsRecords(ctx context.Context, pIds []uuid.UUID) error
+	DeletedPetRecord(ctx context.Context, pId uuid.UUID, rId uuid.UUID, since time.Time) (record.Record, error)
+	DeletedPetsRecords(ctx context.Context, pIds []uuid.UUID, since time.Time) (map[uuid.UUID]record.Record, error)
+	RestoreRecord(ctx context.Context, r record.Record) (record.Record, error)
+	RestorePetsRecords(ctx context.Context, pIds []uuid.UUID, since time.Time) error
+	PurgeRecords(ctx context.Context, before time.Time, pIds []uuid.UUID) ([]uuid.UUID, error)
 }
 
 type service struct {
@@ -29,60 +35,48 @@ func New(repo recordrepo.Repository) (Service, error) {
 	return service{repo: repo}, nil
 }
 
-func (s service) record(tId uuid.UUID) (record.Record, error) {
-	return s.repo.Record(tId)
+func (s service) Record(ctx context.Context, tId uuid.UUID) (record.Record, error) {
+	return s.repo.Record(ctx, tId)
 }
 
-func (s service) PetsRecords(pIds []uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error) {
+func (s service) PetsRecords(ctx context.Context, pIds []uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error) {
 	petRecords := make(map[uuid.UUID]record.Record)
 
-	records, err := s.repo.Records(includeDel)
-	if err != nil {
-		return petRecords, err
-	}
-
-	for _, r := range records {
-		lo.ForEach(pIds, func(pId uuid.UUID, _ int) {
-			if r.PetId == pId {
-				petRecords[r.Id] = r
-			}
-		})
+	// an empty query would match the records of every pet
+	if len(pIds) == 0 {
+		return petRecords, nil
 	}
 
-	return petRecords, nil
-}
-
-func (s service) PetRecords(pId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error) {
-	petRecords := make(map[uuid.UUID]record.Record)
-
-	records, err := s.repo.Records(includeDel)
+	records, err := s.repo.QueryRecords(ctx, recordrepo.Query{PetIds: pIds, IncludeDel: includeDel})
 	if err != nil {
 		return petRecords, err
 	}
 
 	for _, r := range records {
-		if r.PetId == pId {
-			petRecords[r.Id] = r
-		}
+		petRecords[r.Id] = r
 	}
 
 	return petRecords, nil
 }
 
-func (s service) PetRecord(pId uuid.UUID, rId uuid.UUID, includeDel bool) (record.Record, error) {
-	petRecords, err := s.PetRecords(pId, includeDel)
+func (s service) PetRecords(ctx context.Context, pId uuid.UUID, includeDel bool) (map[uuid.UUID]record.Record, error) {
+	return s.PetsRecords(ctx, []uuid.UUID{pId}, includeDel)
+}
+
+func (s service) PetRecord(ctx context.Context, pId uuid.UUID, rId uuid.UUID, includeDel bool) (record.Record, error) {
+	r, err := s.Record(ctx, rId)
 	if err != nil {
 		return record.Nil, err
 	}
-	petRecord, ok := petRecords[rId]
-	if !ok {
+
+	if r.PetId != pId || (r.Deleted && !includeDel) {
 		return record.Nil, record.ErrNotFound
 	}
 
-	return petRecord, nil
+	return r, nil
 }
 
-func (s service) CreateRecord(opts services.RecordCreateOptions) (record.Record, error) {
+func (s service) CreateRecord(ctx context.Context, opts services.RecordCreateOptions) (record.Record, error) {
 	r := record.Nil
 
 	typ, err := record.ParseType(opts.RecordType)
@@ -121,10 +115,10 @@ func (s service) CreateRecord(opts services.RecordCreateOptions) (record.Record,
 		r.VerifiedBy = opts.VerifiedBy
 	}
 
-	return s.repo.CreateRecord(r)
+	return s.repo.CreateRecord(ctx, r)
 }
 
-func (s service) CreateRecords(opts services.RecordsCreateOptions) (map[uuid.UUID]record.Record, error) {
+func (s service) CreateRecords(ctx context.Context, opts services.RecordsCreateOptions) (map[uuid.UUID]record.Record, error) {
 	r := record.Nil
 
 	typ, err := record.ParseType(opts.RecordType)
@@ -178,7 +172,7 @@ func (s service) CreateRecords(opts services.RecordsCreateOptions) (map[uuid.UUI
 
 	recordsMap := make(map[uuid.UUID]record.Record)
 
-	records, err := s.repo.CreateRecords(recs)
+	records, err := s.repo.CreateRecords(ctx, recs)
 	if err != nil {
 		return recordsMap, err
 	}
@@ -189,7 +183,7 @@ func (s service) CreateRecords(opts services.RecordsCreateOptions) (map[uuid.UUI
 	return recordsMap, nil
 }
 
-func (s service) UpdateRecord(opts services.RecordUpdateOptions) (record.Record, error) {
+func (s service) UpdateRecord(ctx context.Context, opts services.RecordUpdateOptions) (record.Record, error) {
 	typ, err := record.ParseType(opts.RecordType)
 	if err != nil {
 		return record.Nil, record.ErrNotValidType
@@ -212,11 +206,15 @@ func (s service) UpdateRecord(opts services.RecordUpdateOptions) (record.Record,
 		return record.Nil, record.ErrNotValidDate
 	}
 
-	r, err := s.record(opts.Id)
+	r, err := s.Record(ctx, opts.Id)
 	if err != nil {
 		return record.Nil, err
 	}
 
+	if opts.Version != 0 && opts.Version != r.Version {
+		return record.Nil, record.ErrConflict
+	}
+
 	r.RecordType = typ
 	r.Name = opts.Name
 	r.Date = opts.Date
@@ -233,9 +231,99 @@ func (s service) UpdateRecord(opts services.RecordUpdateOptions) (record.Record,
 		r.VerifiedBy = uuid.Nil
 	}
 
-	return s.repo.UpdateRecord(r)
+	return s.repo.UpdateRecord(ctx, r)
+}
+
+func (s service) DeleteRecord(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteRecord(ctx, id)
+}
+
+func (s service) DeletePetsRecords(ctx context.Context, pIds []uuid.UUID) error {
+	return s.repo.DeletePetsRecords(ctx, pIds)
+}
+
+// DeletedPetRecord returns the record of the pet if it was deleted at or after since
+func (s service) DeletedPetRecord(ctx context.Context, pId uuid.UUID, rId uuid.UUID, since time.Time) (record.Record, error) {
+	r, err := s.PetRecord(ctx, pId, rId, true)
+	if err != nil {
+		return record.Nil, err
+	}
+
+	if !r.Deleted {
+		return record.Nil, record.ErrNotDeleted
+	}
+
+	if r.DeletedAt.Before(since) {
+		return record.Nil, record.ErrRestoreExpired
+	}
+
+	return r, nil
 }
 
-func (s service) DeleteRecord(id uuid.UUID) error {
-	return s.repo.DeleteRecord(id)
+func (s service) DeletedPetsRecords(ctx context.Context, pIds []uuid.UUID, since time.Time) (map[uuid.UUID]record.Record, error) {
+	records, err := s.PetsRecords(ctx, pIds, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, r := range records {
+		if !r.Deleted || r.DeletedAt.Before(since) {
+			delete(records, id)
+		}
+	}
+
+	return records, nil
+}
+
+func (s service) RestoreRecord(ctx context.Context, r record.Record) (record.Record, error) {
+	r.Deleted = false
+	r.DeletedAt = time.Time{}
+
+	return s.repo.UpdateRecord(ctx, r)
+}
+
+func (s service) RestorePetsRecords(ctx context.Context, pIds []uuid.UUID, since time.Time) error {
+	records, err := s.DeletedPetsRecords(ctx, pIds, since)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		_, err = s.RestoreRecord(ctx, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PurgeRecords hard-deletes the records deleted before the given time and every
+// record of the pets, and returns their ids.
+func (s service) PurgeRecords(ctx context.Context, before time.Time, pIds []uuid.UUID) ([]uuid.UUID, error) {
+	queries := []recordrepo.Query{{DeletedBefore: before, IncludeDel: true}}
+
+	// an empty query would match the records of every pet
+	if len(pIds) > 0 {
+		queries = append(queries, recordrepo.Query{PetIds: pIds, IncludeDel: true})
+	}
+
+	var ids []uuid.UUID
+	for _, query := range queries {
+		records, err := s.repo.QueryRecords(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range records {
+			ids = append(ids, r.Id)
+		}
+
+		_, err = s.repo.PurgeRecords(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
 }
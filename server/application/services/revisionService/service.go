@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"github.com/scarlettmiss/petJournal/application/domain/revision"
+	"github.com/scarlettmiss/petJournal/repositories/revisionrepo"
+)
+
+type Service interface {
+	CreateRevision(ctx context.Context, old record.Record, new record.Record, uId uuid.UUID) error
+	RecordRevisions(ctx context.Context, rId uuid.UUID) ([]revision.Revision, error)
+	PurgeRecordsRevisions(ctx context.Context, rIds []uuid.UUID) error
+}
+
+type service struct {
+	repo revisionrepo.Repository
+}
+
+func New(repo revisionrepo.Repository) (Service, error) {
+	return service{repo: repo}, nil
+}
+
+// CreateRevision stores the changes the user made from old to new, if any.
+// A record that was just created is diffed against record.Nil.
+func (s service) CreateRevision(ctx context.Context, old record.Record, new record.Record, uId uuid.UUID) error {
+	changes := revision.Diff(old, new)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	rev := revision.Revision{
+		RecordId: new.Id,
+		PetId:    new.PetId,
+		Version:  new.Version,
+		UserId:   uId,
+		Changes:  changes,
+	}
+
+	_, err := s.repo.CreateRevision(ctx, rev)
+
+	return err
+}
+
+func (s service) RecordRevisions(ctx context.Context, rId uuid.UUID) ([]revision.Revision, error) {
+	return s.repo.RecordRevisions(ctx, rId)
+}
+
+func (s service) PurgeRecordsRevisions(ctx context.Context, rIds []uuid.UUID) error {
+	return s.repo.PurgeRecordsRevisions(ctx, rIds)
+}
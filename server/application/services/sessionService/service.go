@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/session"
+	"github.com/scarlettmiss/petJournal/application/services"
+	"github.com/scarlettmiss/petJournal/repositories/sessionrepo"
+	"time"
+)
+
+const (
+	// MaxIdle is how long a session lasts without being used. It matches the
+	// lifetime of the refresh tokens, so an idle session cannot be resumed.
+	MaxIdle = 30 * 24 * time.Hour
+	// touchInterval is how stale the last time a session was seen may get, so
+	// that not every request writes it
+	touchInterval = time.Minute
+)
+
+type Service interface {
+	CreateSession(ctx context.Context, uId uuid.UUID, opts services.SessionOptions) (session.Session, error)
+	Session(ctx context.Context, id uuid.UUID) (session.Session, error)
+	UserSessions(ctx context.Context, uId uuid.UUID) ([]session.Session, error)
+	Touch(ctx context.Context, s session.Session) error
+	RevokeSession(ctx context.Context, id uuid.UUID) error
+	PurgeSessions(ctx context.Context, uIds []uuid.UUID) error
+}
+
+type service struct {
+	repo sessionrepo.Repository
+}
+
+func New(repo sessionrepo.Repository) (Service, error) {
+	return service{repo: repo}, nil
+}
+
+func (s service) CreateSession(ctx context.Context, uId uuid.UUID, opts services.SessionOptions) (session.Session, error) {
+	return s.repo.CreateSession(ctx, session.Session{UserId: uId, UserAgent: opts.UserAgent, IP: opts.IP})
+}
+
+// Session returns the session unless it was revoked or has been idle for too
+// long
+func (s service) Session(ctx context.Context, id uuid.UUID) (session.Session, error) {
+	sess, err := s.repo.Session(ctx, id)
+	if err != nil {
+		return session.Nil, err
+	}
+
+	if !sess.RevokedAt.IsZero() || sess.LastSeenAt.Before(time.Now().Add(-MaxIdle)) {
+		return session.Nil, session.ErrRevoked
+	}
+
+	return sess, nil
+}
+
+func (s service) UserSessions(ctx context.Context, uId uuid.UUID) ([]session.Session, error) {
+	return s.repo.UserSessions(ctx, uId, time.Now().Add(-MaxIdle))
+}
+
+// Touch records that the session was just used
+func (s service) Touch(ctx context.Context, sess session.Session) error {
+	now := time.Now()
+	if now.Sub(sess.LastSeenAt) < touchInterval {
+		return nil
+	}
+
+	return s.repo.TouchSession(ctx, sess.Id, now)
+}
+
+func (s service) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	return s.repo.RevokeSession(ctx, id, time.Now())
+}
+
+// PurgeSessions deletes the sessions of the users and the sessions that have
+// been revoked or idle for longer than MaxIdle
+func (s service) PurgeSessions(ctx context.Context, uIds []uuid.UUID) error {
+	return s.repo.PurgeSessions(ctx, uIds, time.Now().Add(-MaxIdle))
+}
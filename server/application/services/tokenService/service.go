@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/token"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/application/services"
+	"github.com/scarlettmiss/petJournal/repositories/tokenrepo"
+	authUtils "github.com/scarlettmiss/petJournal/utils/authorization"
+	jwtUtils "github.com/scarlettmiss/petJournal/utils/jwt"
+	"time"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type Service interface {
+	Issue(ctx context.Context, u user.User, familyId uuid.UUID) (services.Tokens, error)
+	Use(ctx context.Context, refreshToken string) (token.RefreshToken, error)
+	RevokeFamily(ctx context.Context, familyId uuid.UUID) error
+	PurgeTokens(ctx context.Context, userIds []uuid.UUID) error
+}
+
+type service struct {
+	repo tokenrepo.Repository
+}
+
+func New(repo tokenrepo.Repository) (Service, error) {
+	return service{repo: repo}, nil
+}
+
+// Issue issues an access token and a refresh token of the family to the user.
+// The family is the session the tokens belong to.
+func (s service) Issue(ctx context.Context, u user.User, familyId uuid.UUID) (services.Tokens, error) {
+	if u.Deleted {
+		return services.Tokens{}, user.ErrUserDeleted
+	}
+
+	refreshToken, err := authUtils.RandomToken()
+	if err != nil {
+		return services.Tokens{}, err
+	}
+
+	now := time.Now()
+	_, err = s.repo.CreateToken(ctx, token.RefreshToken{
+		UserId:    u.Id,
+		FamilyId:  familyId,
+		Hash:      authUtils.HashToken(refreshToken),
+		ExpiresAt: now.Add(RefreshTokenTTL),
+	})
+	if err != nil {
+		return services.Tokens{}, err
+	}
+
+	expiresAt := now.Add(AccessTokenTTL)
+	accessToken, err := jwtUtils.GenerateJWT(u.Id, u.UserType, familyId, expiresAt)
+	if err != nil {
+		return services.Tokens{}, err
+	}
+
+	return services.Tokens{AccessToken: accessToken, ExpiresAt: expiresAt, RefreshToken: refreshToken}, nil
+}
+
+// Use marks the refresh token as used so it cannot be exchanged again. The
+// token is returned along with token.ErrReused if it already was, so its
+// family can be revoked.
+func (s service) Use(ctx context.Context, refreshToken string) (token.RefreshToken, error) {
+	t, err := s.repo.TokenByHash(ctx, authUtils.HashToken(refreshToken))
+	if err != nil {
+		return token.Nil, err
+	}
+
+	if !t.RevokedAt.IsZero() {
+		return token.Nil, token.ErrRevoked
+	}
+
+	if !t.UsedAt.IsZero() {
+		return t, token.ErrReused
+	}
+
+	now := time.Now()
+	if !now.Before(t.ExpiresAt) {
+		return token.Nil, token.ErrExpired
+	}
+
+	err = s.repo.UseToken(ctx, t.Id, now)
+	if err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+func (s service) RevokeFamily(ctx context.Context, familyId uuid.UUID) error {
+	return s.repo.RevokeFamily(ctx, familyId, time.Now())
+}
+
+// PurgeTokens deletes the tokens of the users and the expired tokens
+func (s service) PurgeTokens(ctx context.Context, userIds []uuid.UUID) error {
+	return s.repo.PurgeTokens(ctx, userIds, time.Now())
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"github.com/google/uuid"
+	"github.com/samber/lo"
 	"github.com/scarlettmiss/petJournal/application/domain/user"
 	"github.com/scarlettmiss/petJournal/application/services"
 	"github.com/scarlettmiss/petJournal/repositories/userrepo"
@@ -9,19 +11,47 @@ import (
 	jwtUtils "github.com/scarlettmiss/petJournal/utils/jwt"
 	textUtils "github.com/scarlettmiss/petJournal/utils/text"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
+// EmailVerificationTTL is how long the email verification links can be used
+const EmailVerificationTTL = 7 * 24 * time.Hour
+
 type Service interface {
-	User(id uuid.UUID) (user.User, error)
-	Users(includeDel bool) ([]user.User, error)
-	UsersByType(t user.Type, includeDel bool) ([]user.User, error)
-	UserByType(id uuid.UUID, t user.Type, includeDel bool) (user.User, error)
-	CreateUser(user services.UserCreateOptions) (user.User, string, error)
-	UpdateUser(opts services.UserUpdateOptions, includeDel bool) (user.User, error)
-	Authenticate(email string, password string) (user.User, string, error)
-	DeleteUser(id uuid.UUID) error
-	userByEmail(email string, includeDel bool) (user.User, bool)
-	checkEmail(email string, id uuid.UUID, includeDel bool) error
+	User(ctx context.Context, id uuid.UUID) (user.User, error)
+	Users(ctx context.Context, includeDel bool) ([]user.User, error)
+	UsersByIds(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]user.User, error)
+	UsersByType(ctx context.Context, t user.Type, includeDel bool) ([]user.User, error)
+	UserByType(ctx context.Context, id uuid.UUID, t user.Type, includeDel bool) (user.User, error)
+	UserByEmail(ctx context.Context, email string) (user.User, error)
+	SearchUsers(ctx context.Context, query services.UserQuery) ([]user.User, error)
+	CreateUser(ctx context.Context, user services.UserCreateOptions) (user.User, error)
+	CreateAdmin(ctx context.Context, opts services.UserCreateOptions) (user.User, error)
+	SetDisabled(ctx context.Context, id uuid.UUID, disabled bool) (user.User, error)
+	PendingVets(ctx context.Context) ([]user.User, error)
+	ReviewLicense(ctx context.Context, adminId uuid.UUID, id uuid.UUID, approve bool, note string) (user.User, error)
+	UpdateUser(ctx context.Context, opts services.UserUpdateOptions, includeDel bool) (user.User, error)
+	Authenticate(ctx context.Context, email string, password string) (user.User, error)
+	ChangePassword(ctx context.Context, id uuid.UUID, current string, password string) (user.User, error)
+	SetPassword(ctx context.Context, u user.User, password string) (user.User, error)
+	VerificationToken(u user.User) (string, error)
+	VerifyEmail(ctx context.Context, token string) (user.User, error)
+	EnrollTOTP(ctx context.Context, id uuid.UUID) (user.User, error)
+	TOTPURI(u user.User) string
+	ConfirmTOTP(ctx context.Context, id uuid.UUID, code string) (user.User, []string, error)
+	DisableTOTP(ctx context.Context, id uuid.UUID, code string) (user.User, error)
+	CheckSecondFactor(ctx context.Context, u user.User, code string) (user.User, error)
+	Challenge(u user.User) (services.Challenge, error)
+	ChallengedUser(ctx context.Context, challenge string) (user.User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	DeletedUser(ctx context.Context, email string, password string, since time.Time) (user.User, error)
+	RestoreUser(ctx context.Context, u user.User) (user.User, error)
+	UsersDeletedBefore(ctx context.Context, before time.Time) ([]uuid.UUID, error)
+	PurgeUsers(ctx context.Context, ids []uuid.UUID) error
+	userByEmail(ctx context.Context, email string, includeDel bool) (user.User, bool)
+	checkEmail(ctx context.Context, email string, id uuid.UUID, includeDel bool) error
 }
 
 type service struct {
@@ -32,81 +62,108 @@ func New(repo userrepo.Repository) (Service, error) {
 	return service{repo: repo}, nil
 }
 
-func (s service) User(id uuid.UUID) (user.User, error) {
-	return s.repo.User(id)
+func (s service) User(ctx context.Context, id uuid.UUID) (user.User, error) {
+	return s.repo.User(ctx, id)
 }
 
-func (s service) Users(includeDel bool) ([]user.User, error) {
-	return s.repo.Users(includeDel)
+func (s service) Users(ctx context.Context, includeDel bool) ([]user.User, error) {
+	return s.repo.Users(ctx, includeDel)
 }
 
-func (s service) UsersByType(t user.Type, includeDel bool) ([]user.User, error) {
-	var users []user.User
-
-	allUsers, err := s.Users(includeDel)
+func (s service) UsersByIds(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]user.User, error) {
+	users, err := s.repo.UsersByIds(ctx, lo.Uniq(ids))
 	if err != nil {
-		return users, err
-	}
-
-	for _, u := range allUsers {
-		if u.UserType == t {
-			users = append(users, u)
-		}
+		return nil, err
 	}
 
-	return users, nil
+	return lo.KeyBy(users, func(u user.User) uuid.UUID { return u.Id }), nil
 }
 
-func (s service) UserByType(id uuid.UUID, t user.Type, includeDel bool) (user.User, error) {
-	u := user.Nil
+func (s service) UsersByType(ctx context.Context, t user.Type, includeDel bool) ([]user.User, error) {
+	return s.repo.QueryUsers(ctx, userrepo.Query{Type: t, IncludeDel: includeDel})
+}
 
-	users, err := s.UsersByType(t, includeDel)
+func (s service) UserByType(ctx context.Context, id uuid.UUID, t user.Type, includeDel bool) (user.User, error) {
+	u, err := s.repo.User(ctx, id)
 	if err != nil {
 		return user.Nil, err
 	}
-	err = user.ErrNotFound
-	for _, v := range users {
-		if v.Id == id {
-			u = v
-			err = nil
-			break
-		}
+
+	if u.UserType != t || (u.Deleted && !includeDel) {
+		return user.Nil, user.ErrNotFound
 	}
-	return u, err
+
+	return u, nil
 }
 
-func (s service) CreateUser(opts services.UserCreateOptions) (user.User, string, error) {
-	u := user.Nil
+func (s service) UserByEmail(ctx context.Context, email string) (user.User, error) {
+	return s.repo.UserByEmail(ctx, email, false)
+}
 
+// SearchUsers returns a page of the users that match the query, oldest first
+func (s service) SearchUsers(ctx context.Context, query services.UserQuery) ([]user.User, error) {
+	return s.repo.QueryUsers(ctx, userrepo.Query{
+		Type:       query.Type,
+		Text:       query.Text,
+		IncludeDel: query.IncludeDel,
+		Offset:     query.Offset,
+		Limit:      query.Limit,
+	})
+}
+
+func (s service) CreateUser(ctx context.Context, opts services.UserCreateOptions) (user.User, error) {
 	typ, err := user.ParseType(opts.UserType)
-	if err != nil {
-		return u, "", user.ErrNoValidType
+	if err != nil || typ == user.Admin {
+		return user.Nil, user.ErrNoValidType
 	}
 
-	err = s.checkEmail(opts.Email, u.Id, true)
+	return s.createUser(ctx, typ, opts)
+}
+
+// CreateAdmin creates an admin. Their email is trusted as verified, since only
+// the operators of the server can create admins.
+func (s service) CreateAdmin(ctx context.Context, opts services.UserCreateOptions) (user.User, error) {
+	return s.createUser(ctx, user.Admin, opts)
+}
+
+func (s service) createUser(ctx context.Context, typ user.Type, opts services.UserCreateOptions) (user.User, error) {
+	u := user.Nil
+
+	err := s.checkEmail(ctx, opts.Email, u.Id, true)
 	if err != nil {
-		return u, "", err
+		return u, err
 	}
 
 	err = passwordValidation(opts.Password)
 	if err != nil {
-		return u, "", err
+		return u, err
 	}
 
 	hashed, err := authUtils.HashPassword(opts.Password)
 	if err != nil {
-		return u, "", err
+		return u, err
 	}
 
 	if textUtils.TextIsEmpty(opts.Name) {
-		return u, "", user.ErrNoValidName
+		return u, user.ErrNoValidName
 	}
 
 	if textUtils.TextIsEmpty(opts.Surname) {
-		return u, "", user.ErrNoValidSurname
+		return u, user.ErrNoValidSurname
+	}
+
+	if typ == user.Vet {
+		if textUtils.TextIsEmpty(opts.LicenseNumber) || textUtils.TextIsEmpty(opts.LicenseAuthority) {
+			return u, user.ErrNoValidLicense
+		}
+
+		u.LicenseNumber = strings.TrimSpace(opts.LicenseNumber)
+		u.LicenseAuthority = strings.TrimSpace(opts.LicenseAuthority)
+		u.LicenseStatus = user.LicensePending
 	}
 
 	u.UserType = typ
+	u.EmailVerified = typ == user.Admin
 	u.Email = opts.Email
 	u.PasswordHash = hashed
 	u.Name = opts.Name
@@ -118,26 +175,20 @@ func (s service) CreateUser(opts services.UserCreateOptions) (user.User, string,
 	u.Country = opts.Country
 	u.Zip = opts.Zip
 
-	u, err = s.repo.CreateUser(u)
-	if err != nil {
-		return u, "", err
-	}
-
-	token, err := userToken(u)
-	if err != nil {
-		return u, token, err
-	}
-
-	return u, token, nil
+	return s.repo.CreateUser(ctx, u)
 }
 
-func (s service) UpdateUser(opts services.UserUpdateOptions, includeDel bool) (user.User, error) {
-	u, err := s.User(opts.Id)
+func (s service) UpdateUser(ctx context.Context, opts services.UserUpdateOptions, includeDel bool) (user.User, error) {
+	u, err := s.User(ctx, opts.Id)
 	if err != nil {
 		return u, user.ErrNotFound
 	}
 
-	err = s.checkEmail(opts.Email, u.Id, includeDel)
+	if opts.Version != 0 && opts.Version != u.Version {
+		return user.Nil, user.ErrConflict
+	}
+
+	err = s.checkEmail(ctx, opts.Email, u.Id, includeDel)
 	if err != nil {
 		return u, err
 	}
@@ -150,6 +201,14 @@ func (s service) UpdateUser(opts services.UserUpdateOptions, includeDel bool) (u
 		return u, user.ErrNoValidSurname
 	}
 
+	if !strings.EqualFold(u.Email, opts.Email) {
+		u.EmailVerified = false
+	}
+
+	if u.UserType == user.Vet {
+		u = updateLicense(u, opts.LicenseNumber, opts.LicenseAuthority)
+	}
+
 	u.Email = opts.Email
 	u.Name = opts.Name
 	u.Surname = opts.Surname
@@ -160,59 +219,215 @@ func (s service) UpdateUser(opts services.UserUpdateOptions, includeDel bool) (u
 	u.Country = opts.Country
 	u.Zip = opts.Zip
 
-	return s.repo.UpdateUser(u)
+	return s.repo.UpdateUser(ctx, u)
 }
 
-func (s service) Authenticate(email string, password string) (user.User, string, error) {
-	var u, ok = s.userByEmail(email, true)
+func (s service) Authenticate(ctx context.Context, email string, password string) (user.User, error) {
+	var u, ok = s.userByEmail(ctx, email, true)
 	if !ok {
-		return u, "", user.ErrNotFound
+		return u, user.ErrNotFound
 	}
 
 	if u.Deleted {
-		return u, "", user.ErrUserDeleted
+		return u, user.ErrUserDeleted
 	}
 
 	if !authUtils.CheckPasswordHash(password, u.PasswordHash) {
-		return u, "", user.ErrAuthentication
+		return u, user.ErrAuthentication
+	}
+
+	if u.Disabled {
+		return u, user.ErrUserDisabled
+	}
+
+	return u, nil
+}
+
+func (s service) ChangePassword(ctx context.Context, id uuid.UUID, current string, password string) (user.User, error) {
+	u, err := s.User(ctx, id)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	if !authUtils.CheckPasswordHash(current, u.PasswordHash) {
+		return user.Nil, user.ErrAuthentication
+	}
+
+	return s.SetPassword(ctx, u, password)
+}
+
+func (s service) SetPassword(ctx context.Context, u user.User, password string) (user.User, error) {
+	if u.Deleted {
+		return user.Nil, user.ErrUserDeleted
 	}
 
-	token, err := userToken(u)
+	err := passwordValidation(password)
 	if err != nil {
-		return u, token, err
+		return user.Nil, err
 	}
 
-	return u, token, nil
+	hashed, err := authUtils.HashPassword(password)
+	if err != nil {
+		return user.Nil, err
+	}
+	u.PasswordHash = hashed
+
+	return s.repo.UpdateUser(ctx, u)
 }
 
-func (s service) DeleteUser(id uuid.UUID) error {
-	return s.repo.DeleteUser(id)
+// VerificationToken returns the token of the link that verifies the current
+// email of the user
+func (s service) VerificationToken(u user.User) (string, error) {
+	return jwtUtils.GenerateVerificationJWT(u.Id, u.Email, time.Now().Add(EmailVerificationTTL))
 }
 
-func (s service) userByEmail(email string, includeDel bool) (user.User, bool) {
-	var u user.User
-	var found bool
+// VerifyEmail marks the email of the user the token was issued to as verified.
+// Tokens issued for an email the user no longer has are rejected.
+func (s service) VerifyEmail(ctx context.Context, token string) (user.User, error) {
+	id, email, err := jwtUtils.ValidateVerificationToken(token)
+	if err != nil {
+		return user.Nil, user.ErrVerificationInvalid
+	}
 
-	users, err := s.Users(includeDel)
+	u, err := s.User(ctx, id)
+	if err == user.ErrNotFound {
+		return user.Nil, user.ErrVerificationInvalid
+	}
 	if err != nil {
-		return user.Nil, false
+		return user.Nil, err
 	}
-	for _, v := range users {
-		if v.Email == email {
-			u = v
-			found = true
-			break
-		}
+
+	if u.Deleted {
+		return user.Nil, user.ErrUserDeleted
 	}
-	return u, found
+
+	if !strings.EqualFold(u.Email, email) {
+		return user.Nil, user.ErrVerificationInvalid
+	}
+
+	if u.EmailVerified {
+		return user.Nil, user.ErrAlreadyVerified
+	}
+	u.EmailVerified = true
+
+	return s.repo.UpdateUser(ctx, u)
+}
+
+func (s service) SetDisabled(ctx context.Context, id uuid.UUID, disabled bool) (user.User, error) {
+	u, err := s.User(ctx, id)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	u.Disabled = disabled
+
+	return s.repo.UpdateUser(ctx, u)
+}
+
+// PendingVets returns the vets whose license awaits review, oldest first
+func (s service) PendingVets(ctx context.Context) ([]user.User, error) {
+	vets, err := s.UsersByType(ctx, user.Vet, false)
+	if err != nil {
+		return nil, err
+	}
+
+	vets = lo.Filter(vets, func(v user.User, _ int) bool { return v.LicensePending() })
+
+	sort.Slice(vets, func(i, j int) bool {
+		return vets[i].CreatedAt.Before(vets[j].CreatedAt)
+	})
+
+	return vets, nil
+}
+
+// ReviewLicense approves or rejects the pending license of the vet. The note
+// tells the vet why it was rejected.
+func (s service) ReviewLicense(ctx context.Context, adminId uuid.UUID, id uuid.UUID, approve bool, note string) (user.User, error) {
+	v, err := s.UserByType(ctx, id, user.Vet, false)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	if !v.LicensePending() {
+		return user.Nil, user.ErrLicenseNotPending
+	}
+
+	v.LicenseStatus = user.LicenseRejected
+	if approve {
+		v.LicenseStatus = user.LicenseApproved
+	}
+	v.LicenseReviewedBy = adminId
+	v.LicenseReviewedAt = time.Now()
+	v.LicenseNote = strings.TrimSpace(note)
+
+	return s.repo.UpdateUser(ctx, v)
+}
+
+func (s service) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteUser(ctx, id)
+}
+
+// DeletedUser authenticates a user that was deleted at or after since
+func (s service) DeletedUser(ctx context.Context, email string, password string, since time.Time) (user.User, error) {
+	u, ok := s.userByEmail(ctx, email, true)
+	if !ok {
+		return user.Nil, user.ErrNotFound
+	}
+
+	if !authUtils.CheckPasswordHash(password, u.PasswordHash) {
+		return user.Nil, user.ErrAuthentication
+	}
+
+	if !u.Deleted {
+		return user.Nil, user.ErrNotDeleted
+	}
+
+	if u.DeletedAt.Before(since) {
+		return user.Nil, user.ErrRestoreExpired
+	}
+
+	return u, nil
+}
+
+func (s service) RestoreUser(ctx context.Context, u user.User) (user.User, error) {
+	u.Deleted = false
+	u.DeletedAt = time.Time{}
+
+	return s.repo.UpdateUser(ctx, u)
+}
+
+func (s service) UsersDeletedBefore(ctx context.Context, before time.Time) ([]uuid.UUID, error) {
+	users, err := s.repo.UsersDeletedBefore(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.Id)
+	}
+
+	return ids, nil
+}
+
+func (s service) PurgeUsers(ctx context.Context, ids []uuid.UUID) error {
+	return s.repo.PurgeUsers(ctx, ids)
 }
 
-func (s service) checkEmail(email string, id uuid.UUID, includeDel bool) error {
+func (s service) userByEmail(ctx context.Context, email string, includeDel bool) (user.User, bool) {
+	u, err := s.repo.UserByEmail(ctx, email, includeDel)
+	if err != nil {
+		return user.Nil, false
+	}
+	return u, true
+}
+
+func (s service) checkEmail(ctx context.Context, email string, id uuid.UUID, includeDel bool) error {
 	if !textUtils.IsEmailValid(email) {
 		return user.ErrNoValidMail
 	}
 
-	u, ok := s.userByEmail(email, includeDel)
+	u, ok := s.userByEmail(ctx, email, includeDel)
 
 	if !ok {
 		return nil
@@ -225,6 +440,35 @@ func (s service) checkEmail(email string, id uuid.UUID, includeDel bool) error {
 	return user.ErrMailExists
 }
 
+// updateLicense replaces the license of the vet with the one given, if any, and
+// puts it back in review when it changed
+func updateLicense(v user.User, number string, authority string) user.User {
+	number = strings.TrimSpace(number)
+	authority = strings.TrimSpace(authority)
+
+	if number == "" && authority == "" {
+		return v
+	}
+	if number == "" {
+		number = v.LicenseNumber
+	}
+	if authority == "" {
+		authority = v.LicenseAuthority
+	}
+	if number == v.LicenseNumber && authority == v.LicenseAuthority {
+		return v
+	}
+
+	v.LicenseNumber = number
+	v.LicenseAuthority = authority
+	v.LicenseStatus = user.LicensePending
+	v.LicenseReviewedBy = uuid.Nil
+	v.LicenseReviewedAt = time.Time{}
+	v.LicenseNote = ""
+
+	return v
+}
+
 // IsPasswordValid
 // Password should be of 8 characters long
 // Password should contain at least one lower case character
@@ -267,10 +511,3 @@ func passwordValidation(password string) error {
 
 	return nil
 }
-
-func userToken(u user.User) (string, error) {
-	if u.Deleted {
-		return "", user.ErrUserDeleted
-	}
-	return jwtUtils.GenerateJWT(u.Id, u.UserType)
-}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/application/services"
+	authUtils "github.com/scarlettmiss/petJournal/utils/authorization"
+	jwtUtils "github.com/scarlettmiss/petJournal/utils/jwt"
+	"github.com/scarlettmiss/petJournal/utils/totp"
+	"strings"
+	"time"
+)
+
+// TOTPIssuer names the accounts in the authenticator apps
+const TOTPIssuer = "Pet Journal"
+
+// ChallengeTTL is how long a user has to enter their code after their password
+const ChallengeTTL = 5 * time.Minute
+
+// recoveryCodeCount is how many recovery codes a user gets when they enable
+// two-factor authentication
+const recoveryCodeCount = 10
+
+// EnrollTOTP gives the user a new TOTP secret, which is only asked for once
+// ConfirmTOTP enables it
+func (s service) EnrollTOTP(ctx context.Context, id uuid.UUID) (user.User, error) {
+	u, err := s.User(ctx, id)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	if u.TOTPEnabled {
+		return user.Nil, user.ErrTOTPEnabled
+	}
+
+	u.TOTPSecret, err = totp.NewSecret()
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return s.repo.UpdateUser(ctx, u)
+}
+
+// TOTPURI returns the otpauth URI of the TOTP secret of the user
+func (s service) TOTPURI(u user.User) string {
+	return totp.URI(u.TOTPSecret, TOTPIssuer, u.Email)
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves they
+// enrolled the secret with a code of it, and returns their recovery codes
+func (s service) ConfirmTOTP(ctx context.Context, id uuid.UUID, code string) (user.User, []string, error) {
+	u, err := s.User(ctx, id)
+	if err != nil {
+		return user.Nil, nil, err
+	}
+
+	if u.TOTPEnabled {
+		return user.Nil, nil, user.ErrTOTPEnabled
+	}
+
+	if u.TOTPSecret == "" {
+		return user.Nil, nil, user.ErrTOTPNotEnrolled
+	}
+
+	step, ok := totp.Validate(u.TOTPSecret, code, time.Now(), 0)
+	if !ok {
+		return user.Nil, nil, user.ErrTOTPCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = recoveryCode()
+		if err != nil {
+			return user.Nil, nil, err
+		}
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	u.TOTPEnabled = true
+	u.TOTPLastStep = step
+	u.RecoveryCodes = hashes
+
+	u, err = s.repo.UpdateUser(ctx, u)
+	if err != nil {
+		return user.Nil, nil, err
+	}
+
+	return u, codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off when code is a TOTP or
+// recovery code of the user
+func (s service) DisableTOTP(ctx context.Context, id uuid.UUID, code string) (user.User, error) {
+	u, err := s.User(ctx, id)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	u, err = secondFactor(u, code)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	u.TOTPEnabled = false
+	u.TOTPSecret = ""
+	u.TOTPLastStep = 0
+	u.RecoveryCodes = nil
+
+	return s.repo.UpdateUser(ctx, u)
+}
+
+// CheckSecondFactor checks that code is a TOTP or recovery code of the user,
+// and uses it up
+func (s service) CheckSecondFactor(ctx context.Context, u user.User, code string) (user.User, error) {
+	u, err := secondFactor(u, code)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return s.repo.UpdateUser(ctx, u)
+}
+
+// Challenge returns the token the user answers with a code to finish a login
+func (s service) Challenge(u user.User) (services.Challenge, error) {
+	expiresAt := time.Now().Add(ChallengeTTL)
+
+	token, err := jwtUtils.GenerateChallengeJWT(u.Id, expiresAt)
+	if err != nil {
+		return services.Challenge{}, err
+	}
+
+	return services.Challenge{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// ChallengedUser returns the user a challenge was issued to
+func (s service) ChallengedUser(ctx context.Context, challenge string) (user.User, error) {
+	id, err := jwtUtils.ValidateChallengeToken(challenge)
+	if err != nil {
+		return user.Nil, user.ErrChallengeInvalid
+	}
+
+	u, err := s.User(ctx, id)
+	if err == user.ErrNotFound {
+		return user.Nil, user.ErrChallengeInvalid
+	}
+	if err != nil {
+		return user.Nil, err
+	}
+
+	if !u.TOTPEnabled {
+		return user.Nil, user.ErrChallengeInvalid
+	}
+
+	return u, nil
+}
+
+// secondFactor uses up code if it is a TOTP or recovery code of the user
+func secondFactor(u user.User, code string) (user.User, error) {
+	if !u.TOTPEnabled {
+		return user.Nil, user.ErrTOTPNotEnabled
+	}
+
+	step, ok := totp.Validate(u.TOTPSecret, code, time.Now(), u.TOTPLastStep)
+	if ok {
+		u.TOTPLastStep = step
+		return u, nil
+	}
+
+	hash := hashRecoveryCode(code)
+	if lo.Contains(u.RecoveryCodes, hash) {
+		u.RecoveryCodes = lo.Without(u.RecoveryCodes, hash)
+		return u, nil
+	}
+
+	return user.Nil, user.ErrTOTPCode
+}
+
+// recoveryCode returns a random code formatted as xxxxx-xxxxx
+func recoveryCode() (string, error) {
+	b := make([]byte, 7)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	c := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+
+	return c[:5] + "-" + c[5:], nil
+}
+
+// hashRecoveryCode hashes the code ignoring its case and formatting
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	return authUtils.HashToken(code)
+}
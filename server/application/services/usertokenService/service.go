@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/usertoken"
+	"github.com/scarlettmiss/petJournal/repositories/usertokenrepo"
+	authUtils "github.com/scarlettmiss/petJournal/utils/authorization"
+	"time"
+)
+
+// PasswordResetTTL is how long a password reset link can be used
+const PasswordResetTTL = time.Hour
+
+type Service interface {
+	Issue(ctx context.Context, uId uuid.UUID, purpose usertoken.Purpose, ttl time.Duration) (string, error)
+	Use(ctx context.Context, purpose usertoken.Purpose, token string) (usertoken.Token, error)
+	DeleteUserTokens(ctx context.Context, uId uuid.UUID, purpose usertoken.Purpose) error
+	PurgeTokens(ctx context.Context, uIds []uuid.UUID) error
+}
+
+type service struct {
+	repo usertokenrepo.Repository
+}
+
+func New(repo usertokenrepo.Repository) (Service, error) {
+	return service{repo: repo}, nil
+}
+
+// Issue returns a new token of the user for the purpose. The tokens issued
+// before for the same purpose can no longer be used.
+func (s service) Issue(ctx context.Context, uId uuid.UUID, purpose usertoken.Purpose, ttl time.Duration) (string, error) {
+	err := s.repo.DeleteUserTokens(ctx, uId, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := authUtils.RandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.repo.CreateToken(ctx, usertoken.Token{
+		UserId:    uId,
+		Purpose:   purpose,
+		Hash:      authUtils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Use marks the token as used so it cannot be used again
+func (s service) Use(ctx context.Context, purpose usertoken.Purpose, token string) (usertoken.Token, error) {
+	t, err := s.repo.TokenByHash(ctx, purpose, authUtils.HashToken(token))
+	if err != nil {
+		return usertoken.Nil, err
+	}
+
+	if !t.UsedAt.IsZero() {
+		return usertoken.Nil, usertoken.ErrUsed
+	}
+
+	now := time.Now()
+	if !now.Before(t.ExpiresAt) {
+		return usertoken.Nil, usertoken.ErrExpired
+	}
+
+	err = s.repo.UseToken(ctx, t.Id, now)
+	if err != nil {
+		return usertoken.Nil, err
+	}
+
+	return t, nil
+}
+
+func (s service) DeleteUserTokens(ctx context.Context, uId uuid.UUID, purpose usertoken.Purpose) error {
+	return s.repo.DeleteUserTokens(ctx, uId, purpose)
+}
+
+// PurgeTokens deletes the tokens of the users and the expired tokens
+func (s service) PurgeTokens(ctx context.Context, uIds []uuid.UUID) error {
+	return s.repo.PurgeTokens(ctx, uIds, time.Now())
+}
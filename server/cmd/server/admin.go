@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/scarlettmiss/petJournal/application"
+	"github.com/scarlettmiss/petJournal/application/services"
+	"io"
+	"os"
+	"strings"
+)
+
+// createAdmin runs the create-admin subcommand, which creates an admin with
+// the given email and name. The password is read from the ADMIN_PASSWORD
+// environment variable, or else from the first line of stdin, so that it does
+// not end up in the shell history.
+func createAdmin(ctx context.Context, app application.Application, args []string, stdin io.Reader) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "the email the admin logs in with")
+	name := flags.String("name", "", "the name of the admin")
+	surname := flags.String("surname", "", "the surname of the admin")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *email == "" || *name == "" || *surname == "" {
+		return errors.New("usage: " + os.Args[0] + " create-admin -email <email> -name <name> -surname <surname>")
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		fmt.Println("Password:")
+		password, err = bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		password = strings.TrimRight(password, "\r\n")
+	}
+
+	u, err := app.CreateAdmin(ctx, services.UserCreateOptions{
+		Email:    *email,
+		Password: password,
+		Name:     *name,
+		Surname:  *surname,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created admin %s (%s)\n", u.Email, u.Id)
+	return nil
+}
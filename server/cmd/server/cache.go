@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application"
+	"github.com/scarlettmiss/petJournal/application/domain/pet"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/repositories/cache"
+	"github.com/scarlettmiss/petJournal/repositories/petrepo"
+	"github.com/scarlettmiss/petJournal/repositories/userrepo"
+	"log"
+	"time"
+)
+
+// caches holds the caches in front of the repositories
+type caches struct {
+	users cache.Cache[uuid.UUID, user.User]
+	pets  cache.Cache[uuid.UUID, pet.Pet]
+}
+
+// withCaches puts read-through caches of size entries in front of the user and
+// pet repositories of opts
+func withCaches(opts application.Options, size int, ttl time.Duration) (application.Options, *caches) {
+	c := &caches{
+		users: cache.NewLRU[uuid.UUID, user.User](size, ttl),
+		pets:  cache.NewLRU[uuid.UUID, pet.Pet](size, ttl),
+	}
+
+	opts.UserRepo = userrepo.NewCached(opts.UserRepo, c.users)
+	opts.PetRepo = petrepo.NewCached(opts.PetRepo, c.pets)
+
+	return opts, c
+}
+
+func (c *caches) logStats() {
+	logStats("users", c.users.Stats())
+	logStats("pets", c.pets.Stats())
+}
+
+func logStats(name string, s cache.Stats) {
+	ratio := 0.0
+	if s.Hits+s.Misses > 0 {
+		ratio = float64(s.Hits) / float64(s.Hits+s.Misses)
+	}
+
+	log.Printf("cache: %s: %d hit(s), %d miss(es) (%.1f%% hits), %d eviction(s), %d entries",
+		name, s.Hits, s.Misses, 100*ratio, s.Evictions, s.Size)
+}
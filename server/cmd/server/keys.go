@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	jwtUtils "github.com/scarlettmiss/petJournal/utils/jwt"
+	"os"
+	"strings"
+)
+
+// loadKeyring returns the keyring that the tokens are signed and verified with.
+//
+// Tokens are signed with the PEM private key (Ed25519 or RSA) in the
+// signingKeyFile, or with the HS256 secret when there is none. The secret
+// keeps verifying the tokens it signed after the switch to a private key,
+// until it is unset. verifyKeyFiles is a comma separated list of PEM keys of
+// which tokens are still accepted, e.g. the signing key before a rotation, and
+// can be public keys. It fails when there is neither a secret nor a signing
+// key, rather than sign tokens with an empty secret that anyone can forge.
+func loadKeyring(secret string, signingKeyFile string, verifyKeyFiles string) (*jwtUtils.Keyring, error) {
+	if secret == "" && signingKeyFile == "" {
+		return nil, errors.New("you must set the 'SECRET_KEY' or the 'JWT_SIGNING_KEY' environment variable")
+	}
+
+	var verifying []jwtUtils.Key
+	for _, file := range strings.Split(verifyKeyFiles, ",") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+
+		k, err := readKey(file)
+		if err != nil {
+			return nil, err
+		}
+		verifying = append(verifying, k)
+	}
+
+	if signingKeyFile == "" {
+		return jwtUtils.NewKeyring(jwtUtils.NewSecretKey([]byte(secret)), verifying...)
+	}
+
+	signing, err := readKey(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret != "" {
+		verifying = append(verifying, jwtUtils.NewSecretKey([]byte(secret)))
+	}
+
+	return jwtUtils.NewKeyring(signing, verifying...)
+}
+
+func readKey(file string) (jwtUtils.Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return jwtUtils.Key{}, err
+	}
+
+	k, err := jwtUtils.ParseKey(data)
+	if err != nil {
+		return jwtUtils.Key{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return k, nil
+}
@@ -2,19 +2,32 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"github.com/scarlettmiss/petJournal/api"
 	"github.com/scarlettmiss/petJournal/api/config"
 	"github.com/scarlettmiss/petJournal/application"
+	"github.com/scarlettmiss/petJournal/repositories/attemptrepo"
+	"github.com/scarlettmiss/petJournal/repositories/migrations"
+	"github.com/scarlettmiss/petJournal/repositories/outboxrepo"
 	"github.com/scarlettmiss/petJournal/repositories/petrepo"
 	"github.com/scarlettmiss/petJournal/repositories/recordrepo"
+	"github.com/scarlettmiss/petJournal/repositories/revisionrepo"
+	"github.com/scarlettmiss/petJournal/repositories/sessionrepo"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"github.com/scarlettmiss/petJournal/repositories/tokenrepo"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
 	"github.com/scarlettmiss/petJournal/repositories/userrepo"
+	"github.com/scarlettmiss/petJournal/repositories/usertokenrepo"
+	jwtUtils "github.com/scarlettmiss/petJournal/utils/jwt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -23,57 +36,174 @@ import "embed"
 //go:embed all:public
 var ui embed.FS
 
+const (
+	// memoryURL is the DB_URL value that runs the server on in-memory repositories
+	memoryURL = "memory://"
+	// sqlitePrefix is the DB_URL prefix that runs the server on the SQLite
+	// database whose file path follows it, e.g. sqlite:///var/lib/petjournal.db
+	sqlitePrefix = "sqlite://"
+)
+
 func main() {
 	uri := os.Getenv("DB_URL")
 	if uri == "" {
-		log.Fatal("You must set your 'DB_URL' environment variable. See\n\t https://www.mongodb.com/docs/drivers/go/current/usage-examples/#environment-variable")
+		log.Fatal("You must set your 'DB_URL' environment variable (use 'memory://' to run without a database or 'sqlite://<path>' for an embedded one). See\n\t https://www.mongodb.com/docs/drivers/go/current/usage-examples/#environment-variable")
 	}
-	//init db
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
 
-	// Use the SetServerAPIOptions() method to set the Stable API version to 1
-	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI))
+	timeout, err := durationEnv("QUERY_TIMEOUT", config.QueryTimeout)
 	if err != nil {
 		panic(err)
 	}
-	defer func() {
-		if err = client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
 
-	// Send a ping to confirm a successful connection
-	var result bson.M
-	if err := client.Database("admin").RunCommand(context.TODO(), bson.D{{"ping", 1}}).Decode(&result); err != nil {
+	gracePeriod, err := durationEnv("RESTORE_GRACE_PERIOD", config.RestoreGracePeriod)
+	if err != nil {
 		panic(err)
 	}
-	fmt.Println("Pinged your deployment. You successfully connected to MongoDB!")
 
-	db := client.Database(os.Getenv("DB_NAME"))
+	retention, err := durationEnv("PURGE_RETENTION", config.PurgeRetention)
+	if err != nil {
+		panic(err)
+	}
+	if retention < gracePeriod {
+		log.Fatal("PURGE_RETENTION must not be shorter than RESTORE_GRACE_PERIOD")
+	}
 
-	//init repos
-	petsCollection := db.Collection("pets")
-	petRepo := petrepo.New(petsCollection)
+	purgeInterval, err := durationEnv("PURGE_INTERVAL", config.PurgeInterval)
+	if err != nil {
+		panic(err)
+	}
+
+	relayInterval, err := durationEnv("RELAY_INTERVAL", config.RelayInterval)
+	if err != nil {
+		panic(err)
+	}
+	if relayInterval <= 0 {
+		log.Fatal("RELAY_INTERVAL must be positive")
+	}
+
+	cacheSize, err := intEnv("CACHE_SIZE", config.CacheSize)
+	if err != nil {
+		panic(err)
+	}
+
+	cacheTTL, err := durationEnv("CACHE_TTL", config.CacheTTL)
+	if err != nil {
+		panic(err)
+	}
+
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = config.PublicURL
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = config.MailFrom
+	}
 
-	usersCollection := db.Collection("users")
-	userRepo := userrepo.New(usersCollection)
+	m, err := openMailer(os.Getenv("MAIL_URL"), mailFrom)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	requireVerifiedVets, err := boolEnv("REQUIRE_VERIFIED_VETS", config.RequireVerifiedVets)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrate(uri, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	recordsCollection := db.Collection("records")
-	recordRepo := recordrepo.New(recordsCollection)
+	keyring, err := loadKeyring(os.Getenv("SECRET_KEY"), os.Getenv("JWT_SIGNING_KEY"), os.Getenv("JWT_VERIFY_KEYS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	jwtUtils.Use(keyring)
+
+	var opts application.Options
+	if uri == memoryURL {
+		fmt.Println("Using in-memory repositories. All data will be lost when the server stops!")
+		opts = memoryOptions()
+	} else if strings.HasPrefix(uri, sqlitePrefix) {
+		db, err := sqldb.Open(strings.TrimPrefix(uri, sqlitePrefix))
+		if err != nil {
+			panic(err)
+		}
+		defer db.Close()
+
+		opts, err = sqlOptions(db)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		client, err := connectMongo(uri, timeout)
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			if err = client.Disconnect(context.TODO()); err != nil {
+				panic(err)
+			}
+		}()
+
+		opts, err = mongoOptions(context.Background(), client.Database(os.Getenv("DB_NAME")))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	opts.RestoreGracePeriod = gracePeriod
+	opts.Mailer = m
+	opts.PublicURL = publicURL
+	opts.RequireVerifiedVets = requireVerifiedVets
+
+	// the in-memory repositories are as fast as a cache
+	var c *caches
+	if cacheSize > 0 && uri != memoryURL {
+		opts, c = withCaches(opts, cacheSize, cacheTTL)
+	}
 
 	//pass services to application
-	opts := application.Options{PetRepo: petRepo, UserRepo: userRepo, RecordRepo: recordRepo}
 	app, err := application.New(opts)
 	if err != nil {
 		panic(err)
 	}
 
-	restServer := api.New(app, ui)
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		if uri == memoryURL {
+			log.Fatal("create-admin needs a database, the in-memory repositories are lost when it exits")
+		}
+
+		err = createAdmin(context.Background(), app, os.Args[2:], os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		err = purge(context.Background(), app, retention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if purgeInterval > 0 {
+		go runPurges(context.Background(), app, retention, purgeInterval)
+	}
+
+	go runRelay(context.Background(), app, relayInterval)
+
+	restServer := api.New(app, ui, timeout)
 
 	go func() { // Start listening and serving requests
-		err = restServer.Run(config.Host + ":" + config.Port)
+		err := restServer.Run(config.Host + ":" + config.Port)
 
 		if err != nil {
 			panic(err)
@@ -84,4 +214,178 @@ func main() {
 	signal.Notify(waitForInterrupt, os.Interrupt, os.Kill)
 
 	<-waitForInterrupt
+
+	if c != nil {
+		c.logStats()
+	}
+}
+
+// durationEnv returns the duration in the environment variable, e.g. "5s",
+// or def when it is not set.
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	d := os.Getenv(name)
+	if d == "" {
+		return def, nil
+	}
+
+	return time.ParseDuration(d)
+}
+
+// intEnv returns the integer in the environment variable, or def when it is
+// not set.
+func intEnv(name string, def int) (int, error) {
+	i := os.Getenv(name)
+	if i == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(i)
+}
+
+// boolEnv returns the boolean in the environment variable, e.g. "true", or def
+// when it is not set.
+func boolEnv(name string, def bool) (bool, error) {
+	b := os.Getenv(name)
+	if b == "" {
+		return def, nil
+	}
+
+	return strconv.ParseBool(b)
+}
+
+func connectMongo(uri string, timeout time.Duration) (*mongo.Client, error) {
+	//init db
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Use the SetServerAPIOptions() method to set the Stable API version to 1
+	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
+	clientOpts := options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI)
+	if timeout > 0 {
+		clientOpts.SetTimeout(timeout)
+	}
+
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send a ping to confirm a successful connection
+	var result bson.M
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Decode(&result); err != nil {
+		return nil, err
+	}
+	fmt.Println("Pinged your deployment. You successfully connected to MongoDB!")
+
+	return client, nil
+}
+
+func mongoOptions(ctx context.Context, db *mongo.Database) (application.Options, error) {
+	pending, err := migrations.New(db).Pending(ctx)
+	if err != nil {
+		return application.Options{}, err
+	}
+	if len(pending) > 0 {
+		return application.Options{}, fmt.Errorf("the database has %d pending migration(s), run '%s migrate up' first",
+			len(pending), os.Args[0])
+	}
+
+	//init repos
+	petRepo := petrepo.New(db.Collection("pets"))
+	userRepo := userrepo.New(db.Collection("users"))
+	recordRepo := recordrepo.New(db.Collection("records"))
+	revisionRepo := revisionrepo.New(db.Collection("record_revisions"))
+	outboxRepo := outboxrepo.New(db.Collection("outbox"))
+	tokenRepo := tokenrepo.New(db.Collection("refresh_tokens"))
+	sessionRepo := sessionrepo.New(db.Collection("sessions"))
+	userTokenRepo := usertokenrepo.New(db.Collection("user_tokens"))
+	attemptRepo := attemptrepo.New(db.Collection("login_attempts"))
+
+	return application.Options{
+		PetRepo:       petRepo,
+		UserRepo:      userRepo,
+		RecordRepo:    recordRepo,
+		RevisionRepo:  revisionRepo,
+		OutboxRepo:    outboxRepo,
+		TokenRepo:     tokenRepo,
+		SessionRepo:   sessionRepo,
+		UserTokenRepo: userTokenRepo,
+		AttemptRepo:   attemptRepo,
+		Transactor:    transaction.NewMongo(db.Client()),
+	}, nil
+}
+
+func sqlOptions(db *sql.DB) (application.Options, error) {
+	petRepo, err := petrepo.NewSQL(db)
+	if err != nil {
+		return application.Options{}, err
+	}
+
+	userRepo, err := userrepo.NewSQL(db)
+	if err != nil {
+		return application.Options{}, err
+	}
+
+	recordRepo, err := recordrepo.NewSQL(db)
+	if err != nil {
+		return application.Options{}, err
+	}
+
+	revisionRepo, err := revisionrepo.NewSQL(db)
+	if err != nil {
+		return application.Options{}, err
+	}
+
+	outboxRepo, err := outboxrepo.NewSQL(db)
+	if err != nil {
+		return application.Options{}, err
+	}
+
+	tokenRepo, err := tokenrepo.NewSQL(db)
+	if err != nil {
+		return application.Options{}, err
+	}
+
+	sessionRepo, err := sessionrepo.NewSQL(db)
+	if err != nil {
+		return application.Options{}, err
+	}
+
+	userTokenRepo, err := usertokenrepo.NewSQL(db)
+	if err != nil {
+		return application.Options{}, err
+	}
+
+	attemptRepo, err := attemptrepo.NewSQL(db)
+	if err != nil {
+		return application.Options{}, err
+	}
+
+	return application.Options{
+		PetRepo:       petRepo,
+		UserRepo:      userRepo,
+		RecordRepo:    recordRepo,
+		RevisionRepo:  revisionRepo,
+		OutboxRepo:    outboxRepo,
+		TokenRepo:     tokenRepo,
+		SessionRepo:   sessionRepo,
+		UserTokenRepo: userTokenRepo,
+		AttemptRepo:   attemptRepo,
+		Transactor:    transaction.NewSQL(db),
+	}, nil
+}
+
+func memoryOptions() application.Options {
+	return application.Options{
+		PetRepo:       petrepo.NewMemory(),
+		UserRepo:      userrepo.NewMemory(),
+		RecordRepo:    recordrepo.NewMemory(),
+		RevisionRepo:  revisionrepo.NewMemory(),
+		OutboxRepo:    outboxrepo.NewMemory(),
+		TokenRepo:     tokenrepo.NewMemory(),
+		SessionRepo:   sessionrepo.NewMemory(),
+		UserTokenRepo: usertokenrepo.NewMemory(),
+		AttemptRepo:   attemptrepo.NewMemory(),
+		Transactor:    transaction.NewMemory(),
+	}
 }
@@ -2,141 +2,2089 @@ package main_test
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
 	"fmt"
+	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"github.com/scarlettmiss/petJournal/application"
+	"github.com/scarlettmiss/petJournal/application/domain/pet"
+	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"github.com/scarlettmiss/petJournal/application/domain/revision"
+	"github.com/scarlettmiss/petJournal/application/domain/session"
+	"github.com/scarlettmiss/petJournal/application/domain/token"
 	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/application/domain/usertoken"
+	"github.com/scarlettmiss/petJournal/application/events"
+	"github.com/scarlettmiss/petJournal/application/mailer"
 	"github.com/scarlettmiss/petJournal/application/services"
+	attemptService "github.com/scarlettmiss/petJournal/application/services/attemptService"
+	"github.com/scarlettmiss/petJournal/repositories/attemptrepo"
+	"github.com/scarlettmiss/petJournal/repositories/cache"
+	"github.com/scarlettmiss/petJournal/repositories/migrations"
+	"github.com/scarlettmiss/petJournal/repositories/outboxrepo"
 	"github.com/scarlettmiss/petJournal/repositories/petrepo"
 	"github.com/scarlettmiss/petJournal/repositories/recordrepo"
+	"github.com/scarlettmiss/petJournal/repositories/revisionrepo"
+	"github.com/scarlettmiss/petJournal/repositories/sessionrepo"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"github.com/scarlettmiss/petJournal/repositories/tokenrepo"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
 	"github.com/scarlettmiss/petJournal/repositories/userrepo"
+	"github.com/scarlettmiss/petJournal/repositories/usertokenrepo"
+	jwtUtils "github.com/scarlettmiss/petJournal/utils/jwt"
+	"github.com/scarlettmiss/petJournal/utils/totp"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 )
 
+// forEachBackend runs test against an application built on the in-memory and
+// the SQLite repositories, with and without caches, and on the MongoDB
+// deployment in TEST_DB_URL when it is set.
+func forEachBackend(t *testing.T, test func(t *testing.T, app application.Application)) {
+	t.Run("memory", func(t *testing.T) {
+		opts := application.Options{
+			PetRepo:            petrepo.NewMemory(),
+			UserRepo:           userrepo.NewMemory(),
+			RecordRepo:         recordrepo.NewMemory(),
+			RevisionRepo:       revisionrepo.NewMemory(),
+			OutboxRepo:         outboxrepo.NewMemory(),
+			TokenRepo:          tokenrepo.NewMemory(),
+			SessionRepo:        sessionrepo.NewMemory(),
+			UserTokenRepo:      usertokenrepo.NewMemory(),
+			AttemptRepo:        attemptrepo.NewMemory(),
+			Transactor:         transaction.NewMemory(),
+			RestoreGracePeriod: time.Hour,
+		}
+		app, err := application.New(opts)
+		assert.Nil(t, err)
+
+		test(t, app)
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := sqldb.Open(":memory:")
+		assert.Nil(t, err)
+		defer db.Close()
+
+		app, err := application.New(sqliteOptions(t, db))
+		assert.Nil(t, err)
+
+		test(t, app)
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		db, err := sqldb.Open(":memory:")
+		assert.Nil(t, err)
+		defer db.Close()
+
+		opts := sqliteOptions(t, db)
+		opts.UserRepo = userrepo.NewCached(opts.UserRepo, cache.NewLRU[uuid.UUID, user.User](100, time.Minute))
+		opts.PetRepo = petrepo.NewCached(opts.PetRepo, cache.NewLRU[uuid.UUID, pet.Pet](100, time.Minute))
+		app, err := application.New(opts)
+		assert.Nil(t, err)
+
+		test(t, app)
+	})
+
+	uri := os.Getenv("TEST_DB_URL")
+	if uri == "" {
+		return
+	}
+
+	t.Run("mongo", func(t *testing.T) {
+		//init db
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+		assert.Nil(t, err)
+		defer func() {
+			if err = client.Disconnect(context.TODO()); err != nil {
+				panic(err)
+			}
+		}()
+
+		// Send a ping to confirm a successful connection
+		var result bson.M
+		err = client.Database("admin").RunCommand(context.TODO(), bson.D{{Key: "ping", Value: 1}}).Decode(&result)
+		assert.Nil(t, err)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println("Pinged your deployment. You successfully connected to MongoDB!")
+
+		db := client.Database("petjournal-test")
+		defer db.Drop(context.TODO())
+
+		_, err = migrations.New(db).Up(context.TODO())
+		assert.Nil(t, err)
+
+		//init repos
+		petRepo := petrepo.New(db.Collection("pets"))
+		userRepo := userrepo.New(db.Collection("users"))
+		recordRepo := recordrepo.New(db.Collection("records"))
+		revisionRepo := revisionrepo.New(db.Collection("record_revisions"))
+		outboxRepo := outboxrepo.New(db.Collection("outbox"))
+		tokenRepo := tokenrepo.New(db.Collection("refresh_tokens"))
+		sessionRepo := sessionrepo.New(db.Collection("sessions"))
+		userTokenRepo := usertokenrepo.New(db.Collection("user_tokens"))
+		attemptRepo := attemptrepo.New(db.Collection("login_attempts"))
+
+		//pass services to application
+		opts := application.Options{
+			PetRepo:            petRepo,
+			UserRepo:           userRepo,
+			RecordRepo:         recordRepo,
+			RevisionRepo:       revisionRepo,
+			OutboxRepo:         outboxRepo,
+			TokenRepo:          tokenRepo,
+			SessionRepo:        sessionRepo,
+			UserTokenRepo:      userTokenRepo,
+			AttemptRepo:        attemptRepo,
+			Transactor:         transaction.NewMongo(client),
+			RestoreGracePeriod: time.Hour,
+		}
+		app, err := application.New(opts)
+		assert.Nil(t, err)
+
+		test(t, app)
+	})
+}
+
+func sqliteOptions(t *testing.T, db *sql.DB) application.Options {
+	petRepo, err := petrepo.NewSQL(db)
+	assert.Nil(t, err)
+	userRepo, err := userrepo.NewSQL(db)
+	assert.Nil(t, err)
+	recordRepo, err := recordrepo.NewSQL(db)
+	assert.Nil(t, err)
+	revisionRepo, err := revisionrepo.NewSQL(db)
+	assert.Nil(t, err)
+	outboxRepo, err := outboxrepo.NewSQL(db)
+	assert.Nil(t, err)
+	tokenRepo, err := tokenrepo.NewSQL(db)
+	assert.Nil(t, err)
+	sessionRepo, err := sessionrepo.NewSQL(db)
+	assert.Nil(t, err)
+	userTokenRepo, err := usertokenrepo.NewSQL(db)
+	assert.Nil(t, err)
+	attemptRepo, err := attemptrepo.NewSQL(db)
+	assert.Nil(t, err)
+
+	return application.Options{
+		PetRepo:            petRepo,
+		UserRepo:           userRepo,
+		RecordRepo:         recordRepo,
+		RevisionRepo:       revisionRepo,
+		OutboxRepo:         outboxRepo,
+		TokenRepo:          tokenRepo,
+		SessionRepo:        sessionRepo,
+		UserTokenRepo:      userTokenRepo,
+		AttemptRepo:        attemptRepo,
+		Transactor:         transaction.NewSQL(db),
+		RestoreGracePeriod: time.Hour,
+	}
+}
+
 /*
 *
 testing suit for the User actions.
 */
 func TestUser(t *testing.T) {
-	//init db
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		createOptions := services.UserCreateOptions{}
+		_, _, err := app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrNoValidType.Error())
+
+		createOptions.UserType = "test"
+		_, _, err = app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrNoValidType.Error())
+
+		createOptions.UserType = "vet"
+		_, _, err = app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrNoValidMail.Error())
+
+		createOptions.Email = "mail@mail"
+		_, _, err = app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrNoValidMail.Error())
+
+		createOptions.Email = "mail@mail.com"
+		_, _, err = app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrPasswordLength.Error())
+
+		createOptions.Password = "12345678aA!"
+		_, _, err = app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrNoValidName.Error())
+
+		createOptions.Name = "testName"
+		_, _, err = app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrNoValidSurname.Error())
+
+		createOptions.Surname = "testSurname"
+		_, _, err = app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrNoValidLicense.Error())
+
+		createOptions.LicenseNumber = "VET-1234"
+		createOptions.LicenseAuthority = "Veterinary Board"
+		u, tokens, err := app.CreateUser(ctx, createOptions)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+
+		_, _, err = app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrMailExists.Error())
+
+		createOptions.Email = "MAIL@mail.com"
+		_, _, err = app.CreateUser(ctx, createOptions)
+		assert.EqualError(t, err, user.ErrMailExists.Error())
+
+		_, tokens, _, err = app.Authenticate(ctx, services.LoginOptions{Email: "Mail@Mail.com", Password: "12345678aA!"})
+		assert.Nil(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+
+		updateOptions := services.UserUpdateOptions{}
+		_, err = app.UpdateUser(ctx, updateOptions, false)
+		assert.EqualError(t, err, user.ErrNotFound.Error())
+
+		updateOptions.Id = u.Id
+		_, err = app.UpdateUser(ctx, updateOptions, false)
+		assert.EqualError(t, err, user.ErrNoValidMail.Error())
+
+		updateOptions.Email = "mail@mail.com"
+		_, err = app.UpdateUser(ctx, updateOptions, false)
+		assert.EqualError(t, err, user.ErrNoValidName.Error())
+
+		updateOptions.Name = "testName"
+		_, err = app.UpdateUser(ctx, updateOptions, false)
+		assert.EqualError(t, err, user.ErrNoValidSurname.Error())
+
+		updateOptions.Surname = "testSurname2"
+		u, err = app.UpdateUser(ctx, updateOptions, false)
+		assert.Nil(t, err)
+
+		u, err = app.User(ctx, u.Id)
+		assert.Nil(t, err)
+
+		_, err = app.User(ctx, uuid.Nil)
+		assert.EqualError(t, err, user.ErrNotFound.Error())
+
+		err = app.DeleteUser(ctx, u.Id)
+		assert.Nil(t, err)
+
+		u, err = app.User(ctx, u.Id)
+		assert.Nil(t, err)
+
+		u, err = app.User(ctx, u.Id)
+		assert.Nil(t, err)
+
+		u, err = app.User(ctx, u.Id)
+		assert.Nil(t, err)
+
+		_, err = app.Users(ctx, true)
+		assert.Nil(t, err)
+
+		// concurrent registrations with the same email must not both succeed
+		createOptions.Email = "race@mail.com"
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				_, _, err := app.CreateUser(ctx, createOptions)
+				errs <- err
+			}()
+		}
+		err1, err2 := <-errs, <-errs
+		assert.True(t, (err1 == nil) != (err2 == nil))
+	})
+}
+
+/*
+*
+testing suit for the Pet and Record actions.
+*/
+func TestPetRecords(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+
+		vet, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType:         "vet",
+			Email:            "vet@mail.com",
+			Password:         "12345678aA!",
+			Name:             "vetName",
+			Surname:          "vetSurname",
+			LicenseNumber:    "VET-1234",
+			LicenseAuthority: "Veterinary Board",
+		})
+		assert.Nil(t, err)
+		approveVet(t, ctx, app, vet.Id)
+
+		petOptions := services.PetCreateOptions{OwnerId: owner.Id, VetId: vet.Id}
+		_, err = app.CreatePet(ctx, petOptions)
+		assert.EqualError(t, err, pet.ErrNoValidName.Error())
+
+		petOptions.Name = "petName"
+		petOptions.DateOfBirth = time.Now().AddDate(-1, 0, 0)
+		petOptions.Gender = "F"
+		petOptions.BreedName = "breed"
+		petOptions.Colors = []string{"black"}
+		p, err := app.CreatePet(ctx, petOptions)
+		assert.Nil(t, err)
+
+		pets, err := app.PetsByUser(ctx, vet.Id, false)
+		assert.Nil(t, err)
+		assert.Contains(t, pets, p.Id)
+
+		updateOptions := services.PetUpdateOptions{
+			Id:          p.Id,
+			OwnerId:     owner.Id,
+			VetId:       vet.Id,
+			Name:        "newName",
+			DateOfBirth: p.DateOfBirth,
+			Gender:      "F",
+			BreedName:   p.BreedName,
+			Version:     p.Version,
+		}
+		updated, err := app.UpdatePet(ctx, updateOptions)
+		assert.Nil(t, err)
+		assert.Equal(t, p.Version+1, updated.Version)
+
+		// the update above was based on the same version
+		_, err = app.UpdatePet(ctx, updateOptions)
+		assert.EqualError(t, err, pet.ErrConflict.Error())
+
+		recordOptions := services.RecordCreateOptions{
+			PetId:          p.Id,
+			RecordType:     "weight",
+			Date:           time.Now(),
+			Result:         "4",
+			AdministeredBy: owner.Id,
+		}
+		r, err := app.CreateRecord(ctx, recordOptions)
+		assert.Nil(t, err)
+
+		records, err := app.RecordsByUserPet(ctx, vet.Id, p.Id, false)
+		assert.Nil(t, err)
+		assert.Contains(t, records, r.Id)
+
+		group, err := app.CreateRecords(ctx, services.RecordsCreateOptions{
+			PetId:          p.Id,
+			RecordType:     "vaccine",
+			Name:           "rabies",
+			Date:           time.Now(),
+			NextDate:       time.Now().AddDate(1, 0, 0),
+			AdministeredBy: vet.Id,
+			VerifiedBy:     vet.Id,
+		})
+		assert.Nil(t, err)
+		assert.Len(t, group, 2)
+
+		records, err = app.RecordsByUser(ctx, owner.Id, false)
+		assert.Nil(t, err)
+		assert.Len(t, records, 3)
+
+		err = app.DeleteRecordUserPet(ctx, owner.Id, p.Id, r.Id)
+		assert.Nil(t, err)
+
+		_, err = app.RecordByUserPet(ctx, owner.Id, p.Id, r.Id, false)
+		assert.EqualError(t, err, record.ErrNotFound.Error())
+
+		// a vet deleting a pet only removes themselves from it
+		err = app.DeletePet(ctx, vet.Id, p.Id)
+		assert.Nil(t, err)
+
+		_, err = app.PetByUser(ctx, vet.Id, p.Id, false)
+		assert.EqualError(t, err, pet.ErrNotFound.Error())
+
+		err = app.DeletePet(ctx, owner.Id, p.Id)
+		assert.Nil(t, err)
+
+		_, err = app.PetByUser(ctx, owner.Id, p.Id, false)
+		assert.EqualError(t, err, pet.ErrNotFound.Error())
+	})
+}
+
+func TestCascadingDeletes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+
+		vet, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType:         "vet",
+			Email:            "vet@mail.com",
+			Password:         "12345678aA!",
+			Name:             "vetName",
+			Surname:          "vetSurname",
+			LicenseNumber:    "VET-1234",
+			LicenseAuthority: "Veterinary Board",
+		})
+		assert.Nil(t, err)
+
+		p, err := app.CreatePet(ctx, services.PetCreateOptions{
+			Name:        "petName",
+			DateOfBirth: time.Now().AddDate(-1, 0, 0),
+			Gender:      "M",
+			BreedName:   "breed",
+			OwnerId:     owner.Id,
+			VetId:       vet.Id,
+		})
+		assert.Nil(t, err)
+
+		_, err = app.CreateRecord(ctx, services.RecordCreateOptions{
+			PetId:          p.Id,
+			RecordType:     "weight",
+			Date:           time.Now(),
+			Result:         "4",
+			AdministeredBy: owner.Id,
+		})
+		assert.Nil(t, err)
+
+		// deleting the vet unassigns them from the pet
+		err = app.DeleteUser(ctx, vet.Id)
+		assert.Nil(t, err)
+
+		p, err = app.Pet(ctx, p.Id)
+		assert.Nil(t, err)
+		assert.Equal(t, uuid.Nil, p.VetId)
+
+		// deleting the owner deletes their pets and the records of the pets
+		err = app.DeleteUser(ctx, owner.Id)
+		assert.Nil(t, err)
+
+		p, err = app.Pet(ctx, p.Id)
+		assert.Nil(t, err)
+		assert.True(t, p.Deleted)
+
+		records, err := app.RecordsByUser(ctx, owner.Id, true)
+		assert.Nil(t, err)
+		assert.Len(t, records, 1)
+		for _, r := range records {
+			assert.True(t, r.Deleted)
+		}
+	})
+}
+
+func TestRestore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+
+		p, err := app.CreatePet(ctx, services.PetCreateOptions{
+			Name:        "petName",
+			DateOfBirth: time.Now().AddDate(-1, 0, 0),
+			Gender:      "M",
+			BreedName:   "breed",
+			OwnerId:     owner.Id,
+		})
+		assert.Nil(t, err)
+
+		r, err := app.CreateRecord(ctx, services.RecordCreateOptions{
+			PetId:          p.Id,
+			RecordType:     "weight",
+			Date:           time.Now(),
+			Result:         "4",
+			AdministeredBy: owner.Id,
+		})
+		assert.Nil(t, err)
+
+		_, err = app.RestoreRecordUserPet(ctx, owner.Id, p.Id, r.Id)
+		assert.EqualError(t, err, record.ErrNotDeleted.Error())
+
+		err = app.DeleteRecordUserPet(ctx, owner.Id, p.Id, r.Id)
+		assert.Nil(t, err)
+
+		_, records, err := app.Trash(ctx, owner.Id)
+		assert.Nil(t, err)
+		assert.Contains(t, records, r.Id)
+
+		r, err = app.RestoreRecordUserPet(ctx, owner.Id, p.Id, r.Id)
+		assert.Nil(t, err)
+		assert.False(t, r.Deleted)
+		assert.True(t, r.DeletedAt.IsZero())
+
+		// restoring the account restores the pets and records deleted with it
+		err = app.DeleteUser(ctx, owner.Id)
+		assert.Nil(t, err)
+
+		login := services.LoginOptions{Email: owner.Email, Password: "wrongPassword1!"}
+		_, _, _, err = app.RestoreUser(ctx, login)
+		assert.EqualError(t, err, user.ErrAuthentication.Error())
+
+		login.Password = "12345678aA!"
+		owner, tokens, _, err := app.RestoreUser(ctx, login)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.False(t, owner.Deleted)
+
+		_, err = app.PetByUser(ctx, owner.Id, p.Id, false)
+		assert.Nil(t, err)
+
+		r, err = app.RecordByUserPet(ctx, owner.Id, p.Id, r.Id, false)
+		assert.Nil(t, err)
+
+		// restoring a pet restores the records deleted with it
+		err = app.DeletePet(ctx, owner.Id, p.Id)
+		assert.Nil(t, err)
+
+		pets, _, err := app.Trash(ctx, owner.Id)
+		assert.Nil(t, err)
+		assert.Contains(t, pets, p.Id)
+
+		p, err = app.RestorePet(ctx, owner.Id, p.Id)
+		assert.Nil(t, err)
+		assert.False(t, p.Deleted)
+
+		_, err = app.RecordByUserPet(ctx, owner.Id, p.Id, r.Id, false)
+		assert.Nil(t, err)
+	})
+}
+
+func TestPurge(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+
+		other, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "other@mail.com",
+			Password: "12345678aA!",
+			Name:     "otherName",
+			Surname:  "otherSurname",
+		})
+		assert.Nil(t, err)
+
+		p, err := app.CreatePet(ctx, services.PetCreateOptions{
+			Name:        "petName",
+			DateOfBirth: time.Now().AddDate(-1, 0, 0),
+			Gender:      "M",
+			BreedName:   "breed",
+			OwnerId:     owner.Id,
+		})
+		assert.Nil(t, err)
+
+		_, err = app.CreateRecord(ctx, services.RecordCreateOptions{
+			PetId:          p.Id,
+			RecordType:     "weight",
+			Date:           time.Now(),
+			Result:         "4",
+			AdministeredBy: owner.Id,
+		})
+		assert.Nil(t, err)
+
+		err = app.DeleteUser(ctx, owner.Id)
+		assert.Nil(t, err)
+
+		// nothing was deleted before the retention window
+		res, err := app.Purge(ctx, time.Now().Add(-time.Hour))
+		assert.Nil(t, err)
+		assert.Empty(t, res.UserIds)
+		assert.Empty(t, res.PetIds)
+		assert.Empty(t, res.RecordIds)
+
+		res, err = app.Purge(ctx, time.Now().Add(time.Hour))
+		assert.Nil(t, err)
+		assert.Equal(t, []uuid.UUID{owner.Id}, res.UserIds)
+		assert.Equal(t, []uuid.UUID{p.Id}, res.PetIds)
+		assert.Len(t, res.RecordIds, 1)
+
+		_, err = app.User(ctx, owner.Id)
+		assert.EqualError(t, err, user.ErrNotFound.Error())
+
+		_, err = app.Pet(ctx, p.Id)
+		assert.EqualError(t, err, pet.ErrNotFound.Error())
+
+		_, err = app.User(ctx, other.Id)
+		assert.Nil(t, err)
+	})
+}
+
+func TestRecordHistory(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+
+		vet, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType:         "vet",
+			Email:            "vet@mail.com",
+			Password:         "12345678aA!",
+			Name:             "vetName",
+			Surname:          "vetSurname",
+			LicenseNumber:    "VET-1234",
+			LicenseAuthority: "Veterinary Board",
+		})
+		assert.Nil(t, err)
+		approveVet(t, ctx, app, vet.Id)
+
+		p, err := app.CreatePet(ctx, services.PetCreateOptions{
+			Name:        "petName",
+			DateOfBirth: time.Now().AddDate(-1, 0, 0),
+			Gender:      "M",
+			BreedName:   "breed",
+			OwnerId:     owner.Id,
+			VetId:       vet.Id,
+		})
+		assert.Nil(t, err)
+
+		date := time.Now().AddDate(0, -1, 0)
+		r, err := app.CreateRecord(ctx, services.RecordCreateOptions{
+			PetId:          p.Id,
+			RecordType:     "vaccine",
+			Name:           "rabies",
+			Date:           date,
+			Lot:            "A1",
+			AdministeredBy: vet.Id,
+			VerifiedBy:     vet.Id,
+		})
+		assert.Nil(t, err)
+
+		_, err = app.UpdateRecord(ctx, services.RecordUpdateOptions{
+			Id:             r.Id,
+			RecordType:     "vaccine",
+			Name:           "rabies",
+			Date:           date,
+			Lot:            "B2",
+			AdministeredBy: owner.Id,
+			UpdatedBy:      owner.Id,
+		})
+		assert.Nil(t, err)
+
+		revisions, err := app.RecordRevisionsUserPet(ctx, owner.Id, p.Id, r.Id)
+		assert.Nil(t, err)
+		assert.Len(t, revisions, 2)
+
+		assert.Equal(t, vet.Id, revisions[0].UserId)
+		assert.Contains(t, revisions[0].Changes, revision.Change{Field: "lot", New: "A1"})
+
+		// the owner edit dropped the vet verification
+		assert.Equal(t, owner.Id, revisions[1].UserId)
+		assert.Equal(t, []revision.Change{
+			{Field: "lot", Old: "A1", New: "B2"},
+			{Field: "verifiedBy", Old: vet.Id.String()},
+		}, revisions[1].Changes)
+
+		_, err = app.RecordRevisionsUserPet(ctx, uuid.New(), p.Id, r.Id)
+		assert.EqualError(t, err, pet.ErrNotFound.Error())
+	})
+}
+
+func TestBatchLookups(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+
+		vet, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType:         "vet",
+			Email:            "vet@mail.com",
+			Password:         "12345678aA!",
+			Name:             "vetName",
+			Surname:          "vetSurname",
+			LicenseNumber:    "VET-1234",
+			LicenseAuthority: "Veterinary Board",
+		})
+		assert.Nil(t, err)
+
+		p, err := app.CreatePet(ctx, services.PetCreateOptions{
+			Name:        "petName",
+			DateOfBirth: time.Now().AddDate(-1, 0, 0),
+			Gender:      "M",
+			BreedName:   "breed",
+			OwnerId:     owner.Id,
+		})
+		assert.Nil(t, err)
+
+		err = app.DeletePet(ctx, owner.Id, p.Id)
+		assert.Nil(t, err)
+
+		// duplicates and unknown ids are fine, deleted entities are included
+		users, err := app.UsersByIds(ctx, []uuid.UUID{owner.Id, vet.Id, owner.Id, uuid.New()})
+		assert.Nil(t, err)
+		assert.Len(t, users, 2)
+		assert.Equal(t, "vet@mail.com", users[vet.Id].Email)
+
+		pets, err := app.PetsByIds(ctx, []uuid.UUID{p.Id, uuid.New()})
+		assert.Nil(t, err)
+		assert.Len(t, pets, 1)
+		assert.True(t, pets[p.Id].Deleted)
+
+		pets, err = app.PetsByIds(ctx, nil)
+		assert.Nil(t, err)
+		assert.Empty(t, pets)
+	})
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+
+	var published []string
+	bus := events.NewBus()
+	bus.Subscribe(func(ctx context.Context, e events.Event) error {
+		published = append(published, e.Name())
+		return nil
+	})
+
+	var verified []uuid.UUID
+	events.On(bus, func(ctx context.Context, e events.RecordVerified) error {
+		verified = append(verified, e.Record.Id)
+		return nil
+	})
+
+	events.On(bus, func(ctx context.Context, e events.RecordDeleted) error {
+		return fmt.Errorf("webhook unavailable")
+	})
+
+	app, err := application.New(application.Options{
+		PetRepo:       petrepo.NewMemory(),
+		UserRepo:      userrepo.NewMemory(),
+		RecordRepo:    recordrepo.NewMemory(),
+		RevisionRepo:  revisionrepo.NewMemory(),
+		OutboxRepo:    outboxrepo.NewMemory(),
+		TokenRepo:     tokenrepo.NewMemory(),
+		SessionRepo:   sessionrepo.NewMemory(),
+		UserTokenRepo: usertokenrepo.NewMemory(),
+		AttemptRepo:   attemptrepo.NewMemory(),
+		Transactor:    transaction.NewMemory(),
+		Bus:           bus,
+		Mailer:        &testMailer{},
+	})
 	assert.Nil(t, err)
-	defer func() {
-		if err = client.Disconnect(context.TODO()); err != nil {
-			panic(err)
+
+	owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType: "owner",
+		Email:    "owner@mail.com",
+		Password: "12345678aA!",
+		Name:     "ownerName",
+		Surname:  "ownerSurname",
+	})
+	assert.Nil(t, err)
+
+	vet, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType:         "vet",
+		Email:            "vet@mail.com",
+		Password:         "12345678aA!",
+		Name:             "vetName",
+		Surname:          "vetSurname",
+		LicenseNumber:    "VET-1234",
+		LicenseAuthority: "Veterinary Board",
+	})
+	assert.Nil(t, err)
+	approveVet(t, ctx, app, vet.Id)
+
+	p, err := app.CreatePet(ctx, services.PetCreateOptions{
+		Name:        "petName",
+		DateOfBirth: time.Now().AddDate(-1, 0, 0),
+		Gender:      "M",
+		BreedName:   "breed",
+		OwnerId:     owner.Id,
+		VetId:       vet.Id,
+	})
+	assert.Nil(t, err)
+
+	r, err := app.CreateRecord(ctx, services.RecordCreateOptions{
+		PetId:          p.Id,
+		RecordType:     "vaccine",
+		Name:           "rabies",
+		Date:           time.Now(),
+		AdministeredBy: vet.Id,
+		VerifiedBy:     vet.Id,
+	})
+	assert.Nil(t, err)
+
+	err = app.DeleteRecordUserPet(ctx, owner.Id, p.Id, r.Id)
+	assert.Nil(t, err)
+
+	// failed changes publish nothing
+	_, err = app.CreatePet(ctx, services.PetCreateOptions{OwnerId: owner.Id})
+	assert.NotNil(t, err)
+
+	// nothing is delivered before the relay runs
+	assert.Empty(t, published)
+
+	res, err := app.RelayEvents(ctx, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, res.Delivered)
+	assert.Equal(t, 1, res.Failed)
+
+	assert.ElementsMatch(t, []string{
+		"user.registered",
+		"user.registered",
+		"user.registered",
+		"user.license_approved",
+		"pet.created",
+		"pet.vet_assigned",
+		"record.created",
+		"record.verified",
+		"record.deleted",
+	}, published)
+	assert.Equal(t, []uuid.UUID{r.Id}, verified)
+
+	// the failed event is retried after a backoff, the delivered ones are gone
+	res, err = app.RelayEvents(ctx, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, services.RelayResult{}, res)
+}
+
+func TestEventPayloads(t *testing.T) {
+	ctx := context.Background()
+
+	outboxRepo := outboxrepo.NewMemory()
+	opts := mailOptions(&testMailer{}, false)
+	opts.OutboxRepo = outboxRepo
+	opts.RestoreGracePeriod = time.Hour
+	app, err := application.New(opts)
+	assert.Nil(t, err)
+
+	u, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType: "owner",
+		Email:    "owner@mail.com",
+		Password: "12345678aA!",
+		Name:     "ownerName",
+		Surname:  "ownerSurname",
+	})
+	assert.Nil(t, err)
+
+	enrollment, err := app.EnrollTOTP(ctx, u.Id)
+	assert.Nil(t, err)
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	assert.Nil(t, err)
+	_, err = app.ConfirmTOTP(ctx, u.Id, code)
+	assert.Nil(t, err)
+
+	u, err = app.UpdateUser(ctx, services.UserUpdateOptions{
+		Id:      u.Id,
+		Email:   u.Email,
+		Name:    "newName",
+		Surname: u.Surname,
+	}, false)
+	assert.Nil(t, err)
+
+	err = app.DeleteUser(ctx, u.Id)
+	assert.Nil(t, err)
+	_, _, _, err = app.RestoreUser(ctx, services.LoginOptions{Email: u.Email, Password: "12345678aA!"})
+	assert.Nil(t, err)
+
+	u, err = app.User(ctx, u.Id)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, u.TOTPSecret)
+	assert.NotEmpty(t, u.RecoveryCodes)
+
+	msgs, err := outboxRepo.DueMessages(ctx, time.Now(), 100)
+	assert.Nil(t, err)
+
+	var names []string
+	for _, m := range msgs {
+		e, err := events.Decode(m.Event, []byte(m.Payload))
+		assert.Nil(t, err)
+		names = append(names, e.Name())
+
+		assert.NotContains(t, m.Payload, u.PasswordHash)
+		assert.NotContains(t, m.Payload, u.TOTPSecret)
+		for _, c := range u.RecoveryCodes {
+			assert.NotContains(t, m.Payload, c)
 		}
-	}()
+	}
+	assert.Subset(t, names, []string{"user.registered", "user.updated", "user.restored"})
+}
+
+func TestCache(t *testing.T) {
+	c := cache.NewLRU[string, int](2, 50*time.Millisecond)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	// b is the least recently used entry
+	c.Set("c", 3)
+	_, ok = c.Get("b")
+	assert.False(t, ok)
 
-	// Send a ping to confirm a successful connection
-	var result bson.M
-	err = client.Database("admin").RunCommand(context.TODO(), bson.D{{"ping", 1}}).Decode(&result)
+	c.Delete("c")
+	_, ok = c.Get("c")
+	assert.False(t, ok)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+
+	assert.Equal(t, cache.Stats{Hits: 1, Misses: 3, Evictions: 1, Size: 0}, c.Stats())
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+
+	users := cache.NewLRU[uuid.UUID, user.User](100, time.Minute)
+	pets := cache.NewLRU[uuid.UUID, pet.Pet](100, time.Minute)
+	userRepo := userrepo.NewCached(userrepo.NewMemory(), users)
+	petRepo := petrepo.NewCached(petrepo.NewMemory(), pets)
+	transactor := transaction.NewMemory()
+
+	u, err := userRepo.CreateUser(ctx, user.User{Email: "user@mail.com", Name: "name"})
 	assert.Nil(t, err)
+	p, err := petRepo.CreatePet(ctx, pet.Pet{Name: "petName", OwnerId: u.Id})
+	assert.Nil(t, err)
+
+	_, err = userRepo.User(ctx, u.Id)
+	assert.Nil(t, err)
+	_, err = petRepo.PetByUser(ctx, u.Id, p.Id, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, users.Stats().Size)
+	assert.Equal(t, 1, pets.Stats().Size)
+
+	// lookups in a transaction do not touch the cache, and writes drop the
+	// entries even when the transaction is rolled back
+	err = transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		u.Name = "changed"
+		_, err := userRepo.UpdateUser(ctx, u)
+		assert.Nil(t, err)
+
+		changed, err := userRepo.User(ctx, u.Id)
+		assert.Nil(t, err)
+		assert.Equal(t, "changed", changed.Name)
+
+		err = petRepo.DeletePet(ctx, p.Id)
+		assert.Nil(t, err)
+
+		return fmt.Errorf("rollback")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, users.Stats().Size)
+	assert.Equal(t, 0, pets.Stats().Size)
+
+	rolledBack, err := userRepo.User(ctx, u.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "name", rolledBack.Name)
+
+	_, err = petRepo.PetByUser(ctx, u.Id, p.Id, false)
+	assert.Nil(t, err)
+}
+
+func TestCachedUserCopies(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := userrepo.NewCached(userrepo.NewMemory(), cache.NewLRU[uuid.UUID, user.User](100, time.Minute))
+
+	u, err := userRepo.CreateUser(ctx, user.User{Email: "user@mail.com", RecoveryCodes: []string{"a", "b"}})
+	assert.Nil(t, err)
+
+	// using up a recovery code of a returned user leaves the cached one intact
+	for i := 0; i < 2; i++ {
+		cached, err := userRepo.User(ctx, u.Id)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"a", "b"}, cached.RecoveryCodes)
+		cached.RecoveryCodes[0] = "used"
+	}
+}
+
+func TestRefreshTokens(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		u, tokens, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+		sessionId := tokenSession(t, tokens.AccessToken)
+
+		_, err = app.Refresh(ctx, "unknown")
+		assert.EqualError(t, err, token.ErrNotFound.Error())
+
+		rotated, err := app.Refresh(ctx, tokens.RefreshToken)
+		assert.Nil(t, err)
+		assert.NotEqual(t, tokens.RefreshToken, rotated.RefreshToken)
+		assert.Equal(t, sessionId, tokenSession(t, rotated.AccessToken))
+
+		// using a refresh token twice revokes the session
+		_, err = app.Refresh(ctx, tokens.RefreshToken)
+		assert.EqualError(t, err, token.ErrReused.Error())
+
+		_, err = app.Refresh(ctx, rotated.RefreshToken)
+		assert.EqualError(t, err, token.ErrRevoked.Error())
+
+		active, err := app.SessionActive(ctx, sessionId)
+		assert.Nil(t, err)
+		assert.False(t, active)
+
+		_, tokens, _, err = app.Authenticate(ctx, services.LoginOptions{Email: u.Email, Password: "12345678aA!"})
+		assert.Nil(t, err)
+		sessionId = tokenSession(t, tokens.AccessToken)
+
+		active, err = app.SessionActive(ctx, sessionId)
+		assert.Nil(t, err)
+		assert.True(t, active)
+
+		err = app.Logout(ctx, sessionId)
+		assert.Nil(t, err)
+
+		_, err = app.Refresh(ctx, tokens.RefreshToken)
+		assert.EqualError(t, err, token.ErrRevoked.Error())
+
+		_, tokens, _, err = app.Authenticate(ctx, services.LoginOptions{Email: u.Email, Password: "12345678aA!"})
+		assert.Nil(t, err)
+
+		err = app.DeleteUser(ctx, u.Id)
+		assert.Nil(t, err)
+
+		active, err = app.SessionActive(ctx, tokenSession(t, tokens.AccessToken))
+		assert.Nil(t, err)
+		assert.False(t, active)
+	})
+}
+
+func TestSessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		u, tokens, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+			Session:  services.SessionOptions{UserAgent: "laptop", IP: "10.0.0.1"},
+		})
+		assert.Nil(t, err)
+		current := tokenSession(t, tokens.AccessToken)
+
+		other, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "other@mail.com",
+			Password: "12345678aA!",
+			Name:     "otherName",
+			Surname:  "otherSurname",
+		})
+		assert.Nil(t, err)
+
+		login := services.LoginOptions{Email: u.Email, Password: "12345678aA!"}
+		for _, device := range []string{"phone", "tablet"} {
+			login.Session = services.SessionOptions{UserAgent: device, IP: "10.0.0.2"}
+			_, _, _, err = app.Authenticate(ctx, login)
+			assert.Nil(t, err)
+		}
+
+		sessions, err := app.Sessions(ctx, u.Id)
+		assert.Nil(t, err)
+		assert.Len(t, sessions, 3)
+		assert.Equal(t, current, sessions[0].Id)
+		assert.Equal(t, "laptop", sessions[0].UserAgent)
+		assert.Equal(t, "10.0.0.1", sessions[0].IP)
+
+		// users can only revoke their own sessions
+		err = app.RevokeSession(ctx, other.Id, sessions[1].Id)
+		assert.EqualError(t, err, session.ErrNotFound.Error())
+
+		err = app.RevokeSession(ctx, u.Id, sessions[1].Id)
+		assert.Nil(t, err)
+
+		active, err := app.SessionActive(ctx, sessions[1].Id)
+		assert.Nil(t, err)
+		assert.False(t, active)
+
+		err = app.RevokeSessions(ctx, u.Id, current)
+		assert.Nil(t, err)
+
+		remaining, err := app.Sessions(ctx, u.Id)
+		assert.Nil(t, err)
+		assert.Len(t, remaining, 1)
+		assert.Equal(t, current, remaining[0].Id)
+
+		active, err = app.SessionActive(ctx, sessions[2].Id)
+		assert.Nil(t, err)
+		assert.False(t, active)
+
+		active, err = app.SessionActive(ctx, current)
+		assert.Nil(t, err)
+		assert.True(t, active)
+	})
+}
+
+func tokenSession(t *testing.T, accessToken string) uuid.UUID {
+	parsed, err := jwtUtils.ValidateToken(accessToken)
+	assert.Nil(t, err)
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	assert.True(t, ok)
+
+	sessionId, err := uuid.Parse(claims["SessionId"].(string))
+	assert.Nil(t, err)
+
+	return sessionId
+}
+
+// testSecret is the secret the tests sign their tokens with
+const testSecret = "test secret"
+
+func TestMain(m *testing.M) {
+	r, err := jwtUtils.NewKeyring(jwtUtils.NewSecretKey([]byte(testSecret)))
 	if err != nil {
 		panic(err)
 	}
+	jwtUtils.Use(r)
 
-	fmt.Println("Pinged your deployment. You successfully connected to MongoDB!")
+	os.Exit(m.Run())
+}
 
-	db := client.Database("petjournal-test")
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	defer func() {
+		r, err := jwtUtils.NewKeyring(jwtUtils.NewSecretKey([]byte(testSecret)))
+		assert.Nil(t, err)
+		jwtUtils.Use(r)
+	}()
 
-	//init repos
-	petsCollection := db.Collection("pets")
-	petRepo := petrepo.New(petsCollection)
+	app, err := application.New(mailOptions(&testMailer{}, false))
+	assert.Nil(t, err)
 
-	usersCollection := db.Collection("users")
-	userRepo := userrepo.New(usersCollection)
+	// tokens signed with the secret before the keyring have no kid
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"UserId":    uuid.New().String(),
+		"SessionId": uuid.New().String(),
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("secret"))
+	assert.Nil(t, err)
 
-	recordsCollection := db.Collection("records")
-	recordRepo := recordrepo.New(recordsCollection)
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edPriv)
+	assert.Nil(t, err)
+	oldKey, err := jwtUtils.ParseKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.Nil(t, err)
 
-	//pass services to application
-	opts := application.Options{PetRepo: petRepo, UserRepo: userRepo, RecordRepo: recordRepo}
-	app, err := application.New(opts)
+	der, err = x509.MarshalPKIXPublicKey(edPriv.Public())
+	assert.Nil(t, err)
+	oldPublic, err := jwtUtils.ParseKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.Nil(t, err)
+	assert.Equal(t, oldKey.Id, oldPublic.Id)
+
+	_, err = jwtUtils.NewKeyring(oldPublic)
+	assert.NotNil(t, err)
+
+	r, err := jwtUtils.NewKeyring(oldKey, jwtUtils.NewSecretKey([]byte("secret")))
 	assert.Nil(t, err)
+	jwtUtils.Use(r)
 
-	createOptions := services.UserCreateOptions{}
-	_, _, err = app.CreateUser(createOptions)
-	assert.EqualError(t, err, user.ErrNoValidType.Error())
+	_, err = jwtUtils.ValidateToken(legacy)
+	assert.Nil(t, err)
 
-	createOptions.UserType = "test"
-	_, _, err = app.CreateUser(createOptions)
-	assert.EqualError(t, err, user.ErrNoValidType.Error())
+	u, tokens, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType: "owner",
+		Email:    "owner@mail.com",
+		Password: "12345678aA!",
+		Name:     "ownerName",
+		Surname:  "ownerSurname",
+	})
+	assert.Nil(t, err)
 
-	createOptions.UserType = "vet"
-	_, _, err = app.CreateUser(createOptions)
-	assert.EqualError(t, err, user.ErrNoValidMail.Error())
+	parsed, err := jwtUtils.ValidateToken(tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, oldKey.Id, parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Header["alg"])
 
-	createOptions.Email = "mail@mail"
-	_, _, err = app.CreateUser(createOptions)
-	assert.EqualError(t, err, user.ErrNoValidMail.Error())
+	claims := parsed.Claims.(jwt.MapClaims)
+	assert.Equal(t, u.Id.String(), claims["sub"])
+	assert.NotNil(t, claims["iat"])
+	assert.NotNil(t, claims["exp"])
 
-	createOptions.Email = "mail@mail.com"
-	_, _, err = app.CreateUser(createOptions)
-	assert.EqualError(t, err, user.ErrPasswordLength.Error())
+	// the public key cannot be used as an HMAC secret
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = oldKey.Id
+	forgedString, err := forged.SignedString([]byte(edPriv.Public().(ed25519.PublicKey)))
+	assert.Nil(t, err)
+	_, err = jwtUtils.ValidateToken(forgedString)
+	assert.NotNil(t, err)
 
-	createOptions.Password = "12345678aA!"
-	_, _, err = app.CreateUser(createOptions)
-	assert.EqualError(t, err, user.ErrNoValidName.Error())
+	// after a rotation the old key only verifies the tokens it signed
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	newKey, err := jwtUtils.ParseKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaPriv)}))
+	assert.Nil(t, err)
 
-	createOptions.Name = "testName"
-	_, _, err = app.CreateUser(createOptions)
-	assert.EqualError(t, err, user.ErrNoValidSurname.Error())
+	r, err = jwtUtils.NewKeyring(newKey, oldPublic)
+	assert.Nil(t, err)
+	jwtUtils.Use(r)
 
-	createOptions.Surname = "testSurname"
-	u, token, err := app.CreateUser(createOptions)
+	_, err = jwtUtils.ValidateToken(tokens.AccessToken)
 	assert.Nil(t, err)
-	assert.NotEqual(t, token, "")
+	_, err = jwtUtils.ValidateToken(legacy)
+	assert.NotNil(t, err)
 
-	_, _, err = app.CreateUser(createOptions)
-	assert.EqualError(t, err, user.ErrMailExists.Error())
+	_, tokens2, _, err := app.Authenticate(ctx, services.LoginOptions{Email: u.Email, Password: "12345678aA!"})
+	assert.Nil(t, err)
+	parsed, err = jwtUtils.ValidateToken(tokens2.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, newKey.Id, parsed.Header["kid"])
+	assert.Equal(t, "RS256", parsed.Header["alg"])
 
-	updateOptions := services.UserUpdateOptions{}
-	_, err = app.UpdateUser(updateOptions, false)
-	assert.EqualError(t, err, user.ErrNotFound.Error())
+	jwks := jwtUtils.PublicKeys()
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, newKey.Id, jwks.Keys[0].Kid)
+	assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+	assert.Equal(t, oldKey.Id, jwks.Keys[1].Kid)
+	assert.Equal(t, "OKP", jwks.Keys[1].Kty)
 
-	updateOptions.Id = u.Id
-	_, err = app.UpdateUser(updateOptions, false)
-	assert.EqualError(t, err, user.ErrNoValidMail.Error())
+	r, err = jwtUtils.NewKeyring(newKey)
+	assert.Nil(t, err)
+	jwtUtils.Use(r)
 
-	updateOptions.Email = "mail@mail.com"
-	_, err = app.UpdateUser(updateOptions, false)
-	assert.EqualError(t, err, user.ErrNoValidName.Error())
+	_, err = jwtUtils.ValidateToken(tokens.AccessToken)
+	assert.NotNil(t, err)
+	_, err = jwtUtils.ValidateToken(tokens2.AccessToken)
+	assert.Nil(t, err)
 
-	updateOptions.Name = "testName"
-	_, err = app.UpdateUser(updateOptions, false)
-	assert.EqualError(t, err, user.ErrNoValidSurname.Error())
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+	_, err = jwtUtils.ParseKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weak)}))
+	assert.NotNil(t, err)
+}
 
-	updateOptions.Surname = "testSurname2"
-	u, err = app.UpdateUser(updateOptions, false)
+func approveVet(t *testing.T, ctx context.Context, app application.Application, vetId uuid.UUID) {
+	admin, err := app.CreateAdmin(ctx, services.UserCreateOptions{
+		Email:    "reviewer@mail.com",
+		Password: "12345678aA!",
+		Name:     "reviewerName",
+		Surname:  "reviewerSurname",
+	})
 	assert.Nil(t, err)
 
-	u, err = app.User(u.Id)
+	_, err = app.ApproveVet(ctx, admin.Id, vetId)
 	assert.Nil(t, err)
+}
+
+func TestAdmin(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		// admins cannot sign up
+		_, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "admin",
+			Email:    "admin@mail.com",
+			Password: "12345678aA!",
+			Name:     "adminName",
+			Surname:  "adminSurname",
+		})
+		assert.EqualError(t, err, user.ErrNoValidType.Error())
+
+		admin, err := app.CreateAdmin(ctx, services.UserCreateOptions{
+			Email:    "admin@mail.com",
+			Password: "12345678aA!",
+			Name:     "adminName",
+			Surname:  "adminSurname",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, user.Admin, admin.UserType)
+		assert.True(t, admin.EmailVerified)
+
+		owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+
+		vet, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType:         "vet",
+			Email:            "vet@mail.com",
+			Password:         "12345678aA!",
+			Name:             "vetName",
+			Surname:          "vetSurname",
+			LicenseNumber:    "VET-1234",
+			LicenseAuthority: "Veterinary Board",
+		})
+		assert.Nil(t, err)
+
+		err = app.DeleteUser(ctx, vet.Id)
+		assert.Nil(t, err)
+
+		users, err := app.SearchUsers(ctx, services.UserQuery{})
+		assert.Nil(t, err)
+		assert.Len(t, users, 2)
+
+		users, err = app.SearchUsers(ctx, services.UserQuery{IncludeDel: true})
+		assert.Nil(t, err)
+		assert.Len(t, users, 3)
+
+		users, err = app.SearchUsers(ctx, services.UserQuery{Text: "OWNERname"})
+		assert.Nil(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, owner.Id, users[0].Id)
+
+		users, err = app.SearchUsers(ctx, services.UserQuery{Type: user.Vet, IncludeDel: true})
+		assert.Nil(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, vet.Id, users[0].Id)
+
+		users, err = app.SearchUsers(ctx, services.UserQuery{Text: "ownername ownersurname"})
+		assert.Nil(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, owner.Id, users[0].Id)
+
+		// the wildcards of the databases match themselves
+		users, err = app.SearchUsers(ctx, services.UserQuery{Text: "%", IncludeDel: true})
+		assert.Nil(t, err)
+		assert.Len(t, users, 0)
+
+		users, err = app.SearchUsers(ctx, services.UserQuery{IncludeDel: true, Limit: 2})
+		assert.Nil(t, err)
+		assert.Len(t, users, 2)
+		assert.Equal(t, admin.Id, users[0].Id)
+		assert.Equal(t, owner.Id, users[1].Id)
+
+		users, err = app.SearchUsers(ctx, services.UserQuery{IncludeDel: true, Offset: 1, Limit: 1})
+		assert.Nil(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, owner.Id, users[0].Id)
 
-	_, err = app.User(uuid.Nil)
+		users, err = app.SearchUsers(ctx, services.UserQuery{IncludeDel: true, Offset: 2})
+		assert.Nil(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, vet.Id, users[0].Id)
+
+		users, err = app.SearchUsers(ctx, services.UserQuery{IncludeDel: true, Offset: 3})
+		assert.Nil(t, err)
+		assert.Len(t, users, 0)
+
+		_, err = app.DisableUser(ctx, admin.Id, admin.Id)
+		assert.EqualError(t, err, user.ErrDisableSelf.Error())
+
+		_, tokens, _, err := app.Authenticate(ctx, services.LoginOptions{Email: owner.Email, Password: "12345678aA!"})
+		assert.Nil(t, err)
+
+		disabled, err := app.DisableUser(ctx, admin.Id, owner.Id)
+		assert.Nil(t, err)
+		assert.True(t, disabled.Disabled)
+
+		active, err := app.SessionActive(ctx, tokenSession(t, tokens.AccessToken))
+		assert.Nil(t, err)
+		assert.False(t, active)
+
+		_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: owner.Email, Password: "12345678aA!"})
+		assert.EqualError(t, err, user.ErrUserDisabled.Error())
+
+		enabled, err := app.EnableUser(ctx, owner.Id)
+		assert.Nil(t, err)
+		assert.False(t, enabled.Disabled)
+
+		_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: owner.Email, Password: "12345678aA!"})
+		assert.Nil(t, err)
+	})
+}
+
+func TestVetLicense(t *testing.T) {
+	ctx := context.Background()
+
+	m := &testMailer{}
+	app, err := application.New(mailOptions(m, false))
+	assert.Nil(t, err)
+
+	_, _, err = app.CreateUser(ctx, services.UserCreateOptions{
+		UserType: "vet",
+		Email:    "vet@mail.com",
+		Password: "12345678aA!",
+		Name:     "vetName",
+		Surname:  "vetSurname",
+	})
+	assert.EqualError(t, err, user.ErrNoValidLicense.Error())
+
+	vet, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType:         "vet",
+		Email:            "vet@mail.com",
+		Password:         "12345678aA!",
+		Name:             "vetName",
+		Surname:          "vetSurname",
+		LicenseNumber:    "VET-1234",
+		LicenseAuthority: "Veterinary Board",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, user.LicensePending, vet.LicenseStatus)
+
+	admin, err := app.CreateAdmin(ctx, services.UserCreateOptions{
+		Email:    "admin@mail.com",
+		Password: "12345678aA!",
+		Name:     "adminName",
+		Surname:  "adminSurname",
+	})
+	assert.Nil(t, err)
+
+	owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType: "owner",
+		Email:    "owner@mail.com",
+		Password: "12345678aA!",
+		Name:     "ownerName",
+		Surname:  "ownerSurname",
+	})
+	assert.Nil(t, err)
+
+	p, err := app.CreatePet(ctx, services.PetCreateOptions{
+		Name:        "petName",
+		DateOfBirth: time.Now().AddDate(-1, 0, 0),
+		Gender:      "M",
+		BreedName:   "breed",
+		OwnerId:     owner.Id,
+		VetId:       vet.Id,
+	})
+	assert.Nil(t, err)
+
+	// a vet in review can write records but not verify them
+	recordOpts := services.RecordCreateOptions{
+		PetId:          p.Id,
+		RecordType:     "vaccine",
+		Name:           "rabies",
+		Date:           time.Now(),
+		AdministeredBy: vet.Id,
+		VerifiedBy:     vet.Id,
+	}
+	_, err = app.CreateRecord(ctx, recordOpts)
+	assert.EqualError(t, err, user.ErrVetNotApproved.Error())
+
+	bulkOpts := services.RecordsCreateOptions{
+		PetId:          p.Id,
+		RecordType:     "vaccine",
+		Name:           "rabies",
+		Date:           time.Now(),
+		AdministeredBy: owner.Id,
+		VerifiedBy:     vet.Id,
+		NextDate:       time.Now().AddDate(1, 0, 0),
+	}
+	_, err = app.CreateRecords(ctx, bulkOpts)
+	assert.EqualError(t, err, user.ErrVetNotApproved.Error())
+
+	pending, err := app.PendingVets(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, vet.Id, pending[0].Id)
+
+	_, err = app.ApproveVet(ctx, admin.Id, owner.Id)
 	assert.EqualError(t, err, user.ErrNotFound.Error())
 
-	err = app.DeleteUser(u.Id)
+	vet, err = app.RejectVet(ctx, admin.Id, vet.Id, "  license expired ")
+	assert.Nil(t, err)
+	assert.Equal(t, user.LicenseRejected, vet.LicenseStatus)
+	assert.Equal(t, "license expired", vet.LicenseNote)
+	assert.Equal(t, admin.Id, vet.LicenseReviewedBy)
+
+	_, err = app.ApproveVet(ctx, admin.Id, vet.Id)
+	assert.EqualError(t, err, user.ErrLicenseNotPending.Error())
+
+	pending, err = app.PendingVets(ctx)
 	assert.Nil(t, err)
+	assert.Empty(t, pending)
 
-	u, err = app.User(u.Id)
+	// submitting another license puts it back in review
+	vet, err = app.UpdateUser(ctx, services.UserUpdateOptions{
+		Id:            vet.Id,
+		Email:         vet.Email,
+		Name:          vet.Name,
+		Surname:       vet.Surname,
+		LicenseNumber: "VET-5678",
+	}, false)
 	assert.Nil(t, err)
+	assert.Equal(t, user.LicensePending, vet.LicenseStatus)
+	assert.Equal(t, "Veterinary Board", vet.LicenseAuthority)
+	assert.Empty(t, vet.LicenseNote)
 
-	u, err = app.User(u.Id)
+	vet, err = app.ApproveVet(ctx, admin.Id, vet.Id)
 	assert.Nil(t, err)
+	assert.True(t, vet.LicenseApproved())
 
-	u, err = app.User(u.Id)
+	r, err := app.CreateRecord(ctx, recordOpts)
 	assert.Nil(t, err)
+	assert.Equal(t, vet.Id, r.VerifiedBy)
 
-	_, err = app.Users(true)
+	records, err := app.CreateRecords(ctx, bulkOpts)
 	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+
+	_, err = app.RelayEvents(ctx, 100)
+	assert.Nil(t, err)
+
+	var subjects []string
+	for _, msg := range m.sent {
+		if msg.To == vet.Email {
+			subjects = append(subjects, msg.Subject)
+		}
+	}
+	assert.Equal(t, []string{
+		"Verify your Pet Journal email",
+		"Your Pet Journal vet license was rejected",
+		"Your Pet Journal vet license was approved",
+	}, subjects)
+}
+
+func TestChangePassword(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		u, tokens, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+		current := tokenSession(t, tokens.AccessToken)
+
+		_, tokens, _, err = app.Authenticate(ctx, services.LoginOptions{Email: u.Email, Password: "12345678aA!"})
+		assert.Nil(t, err)
+		other := tokenSession(t, tokens.AccessToken)
+
+		opts := services.PasswordChangeOptions{
+			UserId:          u.Id,
+			CurrentPassword: "wrongPassword1!",
+			Password:        "87654321bB!",
+			SessionId:       current,
+		}
+		err = app.ChangePassword(ctx, opts)
+		assert.EqualError(t, err, user.ErrAuthentication.Error())
+
+		opts.CurrentPassword = "12345678aA!"
+		opts.Password = "short"
+		err = app.ChangePassword(ctx, opts)
+		assert.EqualError(t, err, user.ErrPasswordLength.Error())
+
+		opts.Password = "87654321bB!"
+		err = app.ChangePassword(ctx, opts)
+		assert.Nil(t, err)
+
+		_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: u.Email, Password: "12345678aA!"})
+		assert.EqualError(t, err, user.ErrAuthentication.Error())
+
+		_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: u.Email, Password: "87654321bB!"})
+		assert.Nil(t, err)
+
+		// only the session the password was changed from survives
+		active, err := app.SessionActive(ctx, current)
+		assert.Nil(t, err)
+		assert.True(t, active)
+
+		active, err = app.SessionActive(ctx, other)
+		assert.Nil(t, err)
+		assert.False(t, active)
+	})
+}
+
+func TestTwoFactor(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		u, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType:         "vet",
+			Email:            "vet@mail.com",
+			Password:         "12345678aA!",
+			Name:             "vetName",
+			Surname:          "vetSurname",
+			LicenseNumber:    "VET-1234",
+			LicenseAuthority: "Veterinary Board",
+		})
+		assert.Nil(t, err)
+		login := services.LoginOptions{Email: u.Email, Password: "12345678aA!"}
+
+		enrollment, err := app.EnrollTOTP(ctx, u.Id)
+		assert.Nil(t, err)
+		assert.Contains(t, enrollment.URI, "otpauth://totp/")
+
+		// the secret is only asked for once it is confirmed
+		_, tokens, challenge, err := app.Authenticate(ctx, login)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.Empty(t, challenge.Token)
+		accessToken := tokens.AccessToken
+
+		_, err = app.ConfirmTOTP(ctx, u.Id, "000000")
+		assert.EqualError(t, err, user.ErrTOTPCode.Error())
+
+		step := totp.Step(time.Now())
+		code, err := totp.Code(enrollment.Secret, step)
+		assert.Nil(t, err)
+
+		recoveryCodes, err := app.ConfirmTOTP(ctx, u.Id, code)
+		assert.Nil(t, err)
+		assert.Len(t, recoveryCodes, 10)
+
+		_, err = app.EnrollTOTP(ctx, u.Id)
+		assert.EqualError(t, err, user.ErrTOTPEnabled.Error())
+
+		_, tokens, challenge, err = app.Authenticate(ctx, login)
+		assert.Nil(t, err)
+		assert.Empty(t, tokens.AccessToken)
+		assert.NotEmpty(t, challenge.Token)
+
+		// access tokens are no challenges
+		_, _, err = app.CompleteLogin(ctx, services.ChallengeOptions{Challenge: accessToken, Code: code})
+		assert.EqualError(t, err, user.ErrChallengeInvalid.Error())
+
+		// codes cannot be used twice
+		_, _, err = app.CompleteLogin(ctx, services.ChallengeOptions{Challenge: challenge.Token, Code: code})
+		assert.EqualError(t, err, user.ErrTOTPCode.Error())
+
+		code, err = totp.Code(enrollment.Secret, step+1)
+		assert.Nil(t, err)
+		_, tokens, err = app.CompleteLogin(ctx, services.ChallengeOptions{Challenge: challenge.Token, Code: code})
+		assert.Nil(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+
+		_, tokens, err = app.CompleteLogin(ctx, services.ChallengeOptions{Challenge: challenge.Token, Code: recoveryCodes[0]})
+		assert.Nil(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+
+		_, _, err = app.CompleteLogin(ctx, services.ChallengeOptions{Challenge: challenge.Token, Code: recoveryCodes[0]})
+		assert.EqualError(t, err, user.ErrTOTPCode.Error())
+
+		err = app.DisableTOTP(ctx, u.Id, recoveryCodes[1])
+		assert.Nil(t, err)
+
+		_, tokens, challenge, err = app.Authenticate(ctx, login)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.Empty(t, challenge.Token)
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+
+	m := &testMailer{}
+	app, err := application.New(mailOptions(m, false))
+	assert.Nil(t, err)
+
+	u, tokens, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType: "owner",
+		Email:    "owner@mail.com",
+		Password: "12345678aA!",
+		Name:     "ownerName",
+		Surname:  "ownerSurname",
+	})
+	assert.Nil(t, err)
+
+	// unknown emails are not told apart
+	err = app.RequestPasswordReset(ctx, "unknown@mail.com")
+	assert.Nil(t, err)
+	assert.Empty(t, m.tokens("unknown@mail.com", "/auth/reset"))
+
+	err = app.RequestPasswordReset(ctx, u.Email)
+	assert.Nil(t, err)
+	err = app.RequestPasswordReset(ctx, u.Email)
+	assert.Nil(t, err)
+
+	sent := m.tokens(u.Email, "/auth/reset")
+	assert.Len(t, sent, 2)
+
+	// a new request replaces the link sent before
+	err = app.ResetPassword(ctx, services.PasswordResetOptions{Token: sent[0], Password: "87654321bB!"})
+	assert.EqualError(t, err, usertoken.ErrNotFound.Error())
+
+	err = app.ResetPassword(ctx, services.PasswordResetOptions{Token: sent[1], Password: "short"})
+	assert.EqualError(t, err, user.ErrPasswordLength.Error())
+
+	err = app.ResetPassword(ctx, services.PasswordResetOptions{Token: sent[1], Password: "87654321bB!"})
+	assert.Nil(t, err)
+
+	err = app.ResetPassword(ctx, services.PasswordResetOptions{Token: sent[1], Password: "87654321bB!"})
+	assert.NotNil(t, err)
+
+	_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: u.Email, Password: "87654321bB!"})
+	assert.Nil(t, err)
+
+	active, err := app.SessionActive(ctx, tokenSession(t, tokens.AccessToken))
+	assert.Nil(t, err)
+	assert.False(t, active)
+}
+
+func TestLoginThrottling(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		u, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+
+		session := services.SessionOptions{IP: "192.0.2.1"}
+		wrong := services.LoginOptions{Email: u.Email, Password: "wrong", Session: session}
+		right := services.LoginOptions{Email: u.Email, Password: "12345678aA!", Session: session}
+
+		// a successful login forgets the failures before it
+		for i := 0; i < attemptService.AccountPolicy.Free; i++ {
+			_, _, _, err = app.Authenticate(ctx, wrong)
+			assert.EqualError(t, err, user.ErrAuthentication.Error())
+		}
+		_, _, _, err = app.Authenticate(ctx, right)
+		assert.Nil(t, err)
+
+		for i := 0; i <= attemptService.AccountPolicy.Free; i++ {
+			_, _, _, err = app.Authenticate(ctx, wrong)
+			assert.EqualError(t, err, user.ErrAuthentication.Error())
+		}
+
+		// the right password is refused too while the account is locked,
+		// whatever the case of the email
+		_, _, _, err = app.Authenticate(ctx, right)
+		assert.EqualError(t, err, user.ErrAccountLocked.Error())
+		_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: "OWNER@mail.com", Password: "12345678aA!"})
+		assert.EqualError(t, err, user.ErrAccountLocked.Error())
+		_, _, _, err = app.RestoreUser(ctx, right)
+		assert.EqualError(t, err, user.ErrAccountLocked.Error())
+
+		// unknown accounts are locked the same way
+		for i := 0; i <= attemptService.AccountPolicy.Free; i++ {
+			_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: "unknown@mail.com", Password: "wrong"})
+			assert.EqualError(t, err, user.ErrNotFound.Error())
+		}
+		_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: "unknown@mail.com", Password: "wrong"})
+		assert.EqualError(t, err, user.ErrAccountLocked.Error())
+
+		other, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "other@mail.com",
+			Password: "12345678aA!",
+			Name:     "otherName",
+			Surname:  "otherSurname",
+		})
+		assert.Nil(t, err)
+
+		_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: other.Email, Password: "12345678aA!", Session: session})
+		assert.Nil(t, err)
+
+		// admins can unlock accounts
+		err = app.UnlockAccount(ctx, u.Id)
+		assert.Nil(t, err)
+
+		_, _, _, err = app.Authenticate(ctx, right)
+		assert.Nil(t, err)
+	})
+}
+
+func TestReauthenticationThrottling(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app application.Application) {
+		ctx := context.Background()
+
+		u, tokens, err := app.CreateUser(ctx, services.UserCreateOptions{
+			UserType: "owner",
+			Email:    "owner@mail.com",
+			Password: "12345678aA!",
+			Name:     "ownerName",
+			Surname:  "ownerSurname",
+		})
+		assert.Nil(t, err)
+		login := services.LoginOptions{Email: u.Email, Password: "12345678aA!"}
+
+		enrollment, err := app.EnrollTOTP(ctx, u.Id)
+		assert.Nil(t, err)
+		code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+		assert.Nil(t, err)
+		recoveryCodes, err := app.ConfirmTOTP(ctx, u.Id, code)
+		assert.Nil(t, err)
+
+		// a stolen access token cannot be used to guess the password
+		opts := services.PasswordChangeOptions{
+			UserId:          u.Id,
+			CurrentPassword: "wrongPassword1!",
+			Password:        "87654321bB!",
+			SessionId:       tokenSession(t, tokens.AccessToken),
+		}
+		for i := 0; i <= attemptService.AccountPolicy.Free; i++ {
+			err = app.ChangePassword(ctx, opts)
+			assert.EqualError(t, err, user.ErrAuthentication.Error())
+		}
+
+		opts.CurrentPassword = "12345678aA!"
+		err = app.ChangePassword(ctx, opts)
+		assert.EqualError(t, err, user.ErrAccountLocked.Error())
+		_, _, _, err = app.Authenticate(ctx, login)
+		assert.EqualError(t, err, user.ErrAccountLocked.Error())
+
+		err = app.UnlockAccount(ctx, u.Id)
+		assert.Nil(t, err)
+
+		// nor the codes that disable the second factor
+		for i := 0; i <= attemptService.AccountPolicy.Free; i++ {
+			err = app.DisableTOTP(ctx, u.Id, "000000")
+			assert.EqualError(t, err, user.ErrTOTPCode.Error())
+		}
+
+		err = app.DisableTOTP(ctx, u.Id, recoveryCodes[0])
+		assert.EqualError(t, err, user.ErrAccountLocked.Error())
+		_, _, _, err = app.Authenticate(ctx, login)
+		assert.EqualError(t, err, user.ErrAccountLocked.Error())
+
+		err = app.UnlockAccount(ctx, u.Id)
+		assert.Nil(t, err)
+
+		err = app.DisableTOTP(ctx, u.Id, recoveryCodes[0])
+		assert.Nil(t, err)
+	})
+}
+
+func TestAccountUnlock(t *testing.T) {
+	ctx := context.Background()
+
+	m := &testMailer{}
+	app, err := application.New(mailOptions(m, false))
+	assert.Nil(t, err)
+
+	u, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType: "owner",
+		Email:    "owner@mail.com",
+		Password: "12345678aA!",
+		Name:     "ownerName",
+		Surname:  "ownerSurname",
+	})
+	assert.Nil(t, err)
+
+	for i := 0; i <= attemptService.AccountPolicy.Free; i++ {
+		_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: u.Email, Password: "wrong"})
+		assert.EqualError(t, err, user.ErrAuthentication.Error())
+	}
+
+	_, err = app.RelayEvents(ctx, 100)
+	assert.Nil(t, err)
+	assert.Len(t, m.links(u.Email, "/auth/forgot"), 1)
+
+	// resetting the password unlocks the account
+	err = app.RequestPasswordReset(ctx, u.Email)
+	assert.Nil(t, err)
+
+	sent := m.tokens(u.Email, "/auth/reset")
+	assert.Len(t, sent, 1)
+
+	err = app.ResetPassword(ctx, services.PasswordResetOptions{Token: sent[0], Password: "87654321bB!"})
+	assert.Nil(t, err)
+
+	_, _, _, err = app.Authenticate(ctx, services.LoginOptions{Email: u.Email, Password: "87654321bB!"})
+	assert.Nil(t, err)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+
+	m := &testMailer{}
+	app, err := application.New(mailOptions(m, true))
+	assert.Nil(t, err)
+
+	owner, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType: "owner",
+		Email:    "owner@mail.com",
+		Password: "12345678aA!",
+		Name:     "ownerName",
+		Surname:  "ownerSurname",
+	})
+	assert.Nil(t, err)
+	assert.False(t, owner.EmailVerified)
+
+	vet, _, err := app.CreateUser(ctx, services.UserCreateOptions{
+		UserType:         "vet",
+		Email:            "vet@mail.com",
+		Password:         "12345678aA!",
+		Name:             "vetName",
+		Surname:          "vetSurname",
+		LicenseNumber:    "VET-1234",
+		LicenseAuthority: "Veterinary Board",
+	})
+	assert.Nil(t, err)
+
+	// the links are sent once the registrations are relayed
+	assert.Empty(t, m.tokens(vet.Email, "/auth/verify"))
+	_, err = app.RelayEvents(ctx, 100)
+	assert.Nil(t, err)
+	sent := m.tokens(vet.Email, "/auth/verify")
+	assert.Len(t, sent, 1)
+
+	vets, err := app.Vets(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, vets)
+
+	petOpts := services.PetCreateOptions{
+		Name:        "petName",
+		DateOfBirth: time.Now().AddDate(-1, 0, 0),
+		Gender:      "M",
+		BreedName:   "breed",
+		OwnerId:     owner.Id,
+		VetId:       vet.Id,
+	}
+	_, err = app.CreatePet(ctx, petOpts)
+	assert.EqualError(t, err, user.ErrVetNotVerified.Error())
+
+	_, err = app.VerifyEmail(ctx, "not a token")
+	assert.EqualError(t, err, user.ErrVerificationInvalid.Error())
+
+	vet, err = app.VerifyEmail(ctx, sent[0])
+	assert.Nil(t, err)
+	assert.True(t, vet.EmailVerified)
+
+	_, err = app.VerifyEmail(ctx, sent[0])
+	assert.EqualError(t, err, user.ErrAlreadyVerified.Error())
+
+	err = app.ResendVerification(ctx, vet.Id)
+	assert.EqualError(t, err, user.ErrAlreadyVerified.Error())
+
+	vets, err = app.Vets(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, vets, 1)
+
+	_, err = app.CreatePet(ctx, petOpts)
+	assert.Nil(t, err)
+
+	// a new email must be verified again, and the links sent to the old one
+	// no longer work
+	err = app.ResendVerification(ctx, owner.Id)
+	assert.Nil(t, err)
+	old := m.tokens(owner.Email, "/auth/verify")
+	assert.Len(t, old, 2)
+
+	owner, err = app.UpdateUser(ctx, services.UserUpdateOptions{
+		Id:      owner.Id,
+		Email:   "owner2@mail.com",
+		Name:    owner.Name,
+		Surname: owner.Surname,
+	}, false)
+	assert.Nil(t, err)
+	_, err = app.RelayEvents(ctx, 100)
+	assert.Nil(t, err)
+
+	_, err = app.VerifyEmail(ctx, old[1])
+	assert.EqualError(t, err, user.ErrVerificationInvalid.Error())
+
+	sent = m.tokens(owner.Email, "/auth/verify")
+	assert.Len(t, sent, 1)
+	owner, err = app.VerifyEmail(ctx, sent[0])
+	assert.Nil(t, err)
+	assert.True(t, owner.EmailVerified)
+}
+
+// mailOptions returns in-memory options whose emails are sent to m
+func mailOptions(m mailer.Mailer, requireVerifiedVets bool) application.Options {
+	return application.Options{
+		PetRepo:             petrepo.NewMemory(),
+		UserRepo:            userrepo.NewMemory(),
+		RecordRepo:          recordrepo.NewMemory(),
+		RevisionRepo:        revisionrepo.NewMemory(),
+		OutboxRepo:          outboxrepo.NewMemory(),
+		TokenRepo:           tokenrepo.NewMemory(),
+		SessionRepo:         sessionrepo.NewMemory(),
+		UserTokenRepo:       usertokenrepo.NewMemory(),
+		AttemptRepo:         attemptrepo.NewMemory(),
+		Transactor:          transaction.NewMemory(),
+		Mailer:              m,
+		PublicURL:           "https://petjournal.example.com",
+		RequireVerifiedVets: requireVerifiedVets,
+	}
+}
+
+// testMailer keeps the emails it is asked to send
+type testMailer struct {
+	mux  sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// tokens returns the tokens of the links to page emailed to the address, oldest
+// first
+func (m *testMailer) tokens(to string, page string) []string {
+	return m.params(to, page, "token")
+}
+
+// links returns the links to page emailed to the address, oldest first
+func (m *testMailer) links(to string, page string) []string {
+	return m.params(to, page, "")
+}
+
+// params returns the first query parameter of the links to page emailed to the
+// address, or the whole query when param is empty
+func (m *testMailer) params(to string, page string, param string) []string {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	prefix := "https://petjournal.example.com" + page + "?"
+	if param != "" {
+		prefix += param + "="
+	}
+	link := regexp.MustCompile(regexp.QuoteMeta(prefix) + `(\S+)`)
+
+	var values []string
+	for _, msg := range m.sent {
+		match := link.FindStringSubmatch(msg.Body)
+		if msg.To == to && match != nil {
+			values = append(values, match[1])
+		}
+	}
 
-	db.Drop(ctx)
+	return values
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/scarlettmiss/petJournal/repositories/migrations"
+	"os"
+	"strings"
+)
+
+// migrate runs the migrate subcommand. "migrate up" applies the pending
+// migrations and "migrate status" lists every migration and whether it has
+// been applied.
+func migrate(uri string, args []string) error {
+	if len(args) != 1 || (args[0] != "up" && args[0] != "status") {
+		return errors.New("usage: " + os.Args[0] + " migrate up|status")
+	}
+
+	if uri == memoryURL || strings.HasPrefix(uri, sqlitePrefix) {
+		fmt.Println("Migrations only apply to MongoDB, the other backends create their schema on startup.")
+		return nil
+	}
+
+	// migrations may rewrite whole collections, so they run without the query timeout
+	client, err := connectMongo(uri, 0)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.TODO())
+
+	ctx := context.Background()
+	migrator := migrations.New(client.Database(os.Getenv("DB_NAME")))
+
+	if args[0] == "status" {
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-27s  %s\n", s.Version, state, s.Description)
+		}
+		return nil
+	}
+
+	done, err := migrator.Up(ctx)
+	for _, m := range done {
+		fmt.Printf("Applied migration %d: %s\n", m.Version, m.Description)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(done) == 0 {
+		fmt.Println("The database is up to date.")
+	}
+
+	return nil
+}
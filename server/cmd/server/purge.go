@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"github.com/scarlettmiss/petJournal/application"
+	"log"
+	"time"
+)
+
+// purge hard-deletes the data deleted longer than retention ago and logs what
+// was purged
+func purge(ctx context.Context, app application.Application, retention time.Duration) error {
+	before := time.Now().Add(-retention)
+
+	res, err := app.Purge(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range res.UserIds {
+		log.Printf("purge: deleted user %s", id)
+	}
+	for _, id := range res.PetIds {
+		log.Printf("purge: deleted pet %s", id)
+	}
+	log.Printf("purge: deleted %d user(s), %d pet(s) and %d record(s) deleted before %s",
+		len(res.UserIds), len(res.PetIds), len(res.RecordIds), before.Format(time.RFC3339))
+
+	return nil
+}
+
+// runPurges purges every interval until ctx is done. A failed purge is logged
+// and retried on the next tick.
+func runPurges(ctx context.Context, app application.Application, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := purge(ctx, app, retention)
+		if err != nil {
+			log.Printf("purge: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"github.com/scarlettmiss/petJournal/api/config"
+	"github.com/scarlettmiss/petJournal/application"
+	"log"
+	"time"
+)
+
+// runRelay delivers the events of the outbox until ctx is done. It keeps going
+// while full batches are delivered and waits interval once it has caught up.
+func runRelay(ctx context.Context, app application.Application, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		res, err := app.RelayEvents(ctx, config.RelayBatchSize)
+		if err != nil {
+			log.Printf("relay: %v", err)
+		}
+		if res.Failed > 0 {
+			log.Printf("relay: %d event(s) failed and will be retried", res.Failed)
+		}
+		for _, id := range res.DeadLettered {
+			log.Printf("relay: gave up on outbox message %s", id)
+		}
+
+		if err == nil && res.Delivered+res.Failed+len(res.DeadLettered) == config.RelayBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
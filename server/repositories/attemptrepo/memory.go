@@ -0,0 +1,114 @@
+package attemptrepo
+
+import (
+	"context"
+	"github.com/scarlettmiss/petJournal/application/domain/attempt"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mux      sync.RWMutex
+	attempts map[string]attempt.Attempt
+}
+
+// NewMemory returns a thread-safe Repository that keeps every attempt in
+// memory. It is meant for local development and tests where no database is
+// available.
+func NewMemory() Repository {
+	return &memoryRepository{
+		attempts: make(map[string]attempt.Attempt),
+	}
+}
+
+func (r *memoryRepository) Attempt(ctx context.Context, key string) (attempt.Attempt, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	a, ok := r.attempts[key]
+	if !ok {
+		return attempt.Nil, attempt.ErrNotFound
+	}
+
+	return a, nil
+}
+
+func (r *memoryRepository) AddFailure(ctx context.Context, key string, at time.Time, since time.Time) (attempt.Attempt, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	a, ok := r.attempts[key]
+	if !ok {
+		a.Key = key
+	}
+
+	if a.LastFailureAt.Before(since) {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailureAt = at
+
+	r.remember(ctx, key)
+	r.attempts[key] = a
+
+	return a, nil
+}
+
+func (r *memoryRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	a, ok := r.attempts[key]
+	if !ok {
+		return attempt.ErrNotFound
+	}
+
+	a.LockedUntil = until
+	r.remember(ctx, key)
+	r.attempts[key] = a
+
+	return nil
+}
+
+func (r *memoryRepository) DeleteAttempts(ctx context.Context, keys []string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for _, key := range keys {
+		r.remember(ctx, key)
+		delete(r.attempts, key)
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) PurgeAttempts(ctx context.Context, before time.Time) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for key, a := range r.attempts {
+		if a.LastFailureAt.Before(before) && a.LockedUntil.Before(before) {
+			r.remember(ctx, key)
+			delete(r.attempts, key)
+		}
+	}
+
+	return nil
+}
+
+// remember registers the current state of the attempt to be restored if the
+// transaction in ctx is rolled back. Callers must hold the lock.
+func (r *memoryRepository) remember(ctx context.Context, key string) {
+	old, ok := r.attempts[key]
+	transaction.OnRollback(ctx, func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if ok {
+			r.attempts[key] = old
+		} else {
+			delete(r.attempts, key)
+		}
+	})
+}
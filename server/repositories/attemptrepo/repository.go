@@ -0,0 +1,122 @@
+package attemptrepo
+
+import (
+	"context"
+	"github.com/scarlettmiss/petJournal/application/domain/attempt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type AttemptDBModel struct {
+	Key           string    `bson:"_id"`
+	Failures      int       `bson:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at"`
+	LockedUntil   time.Time `bson:"locked_until,omitempty"`
+}
+
+func ConvertToAttemptDomainModel(dbAttempt AttemptDBModel) attempt.Attempt {
+	return attempt.Attempt{
+		Key:           dbAttempt.Key,
+		Failures:      dbAttempt.Failures,
+		LastFailureAt: dbAttempt.LastFailureAt,
+		LockedUntil:   dbAttempt.LockedUntil,
+	}
+}
+
+type Repository interface {
+	Attempt(ctx context.Context, key string) (attempt.Attempt, error)
+	// AddFailure counts a failed login on the key and returns the updated
+	// attempt. Failures made before since are forgotten first.
+	AddFailure(ctx context.Context, key string, at time.Time, since time.Time) (attempt.Attempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	DeleteAttempts(ctx context.Context, keys []string) error
+	// PurgeAttempts deletes the attempts that last failed and are locked until
+	// before the given time
+	PurgeAttempts(ctx context.Context, before time.Time) error
+}
+
+type repository struct {
+	attempts *mongo.Collection
+}
+
+func New(collection *mongo.Collection) Repository {
+	return &repository{
+		attempts: collection,
+	}
+}
+
+func (r *repository) Attempt(ctx context.Context, key string) (attempt.Attempt, error) {
+	var a AttemptDBModel
+
+	err := r.attempts.FindOne(ctx, bson.M{"_id": key}).Decode(&a)
+	if err == mongo.ErrNoDocuments {
+		return attempt.Nil, attempt.ErrNotFound
+	}
+	if err != nil {
+		return attempt.Nil, err
+	}
+
+	return ConvertToAttemptDomainModel(a), nil
+}
+
+func (r *repository) AddFailure(ctx context.Context, key string, at time.Time, since time.Time) (attempt.Attempt, error) {
+	// a pipeline update, so that the count restarts atomically once the last
+	// failure is too old. A missing last_failure_at compares lower than any date.
+	update := bson.A{bson.M{"$set": bson.M{
+		"failures": bson.M{"$cond": bson.A{
+			bson.M{"$gte": bson.A{"$last_failure_at", since}},
+			bson.M{"$add": bson.A{"$failures", 1}},
+			1,
+		}},
+		"last_failure_at": at,
+	}}}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var a AttemptDBModel
+	err := r.attempts.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&a)
+	if err != nil {
+		return attempt.Nil, err
+	}
+
+	return ConvertToAttemptDomainModel(a), nil
+}
+
+func (r *repository) Lock(ctx context.Context, key string, until time.Time) error {
+	res, err := r.attempts.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"locked_until": until}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return attempt.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteAttempts(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err := r.attempts.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": keys}})
+
+	return err
+}
+
+func (r *repository) PurgeAttempts(ctx context.Context, before time.Time) error {
+	filter := bson.M{
+		"last_failure_at": bson.M{"$lt": before},
+		"$or": bson.A{
+			bson.M{"locked_until": bson.M{"$exists": false}},
+			bson.M{"locked_until": bson.M{"$lt": before}},
+		},
+	}
+
+	_, err := r.attempts.DeleteMany(ctx, filter)
+
+	return err
+}
@@ -0,0 +1,114 @@
+package attemptrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/scarlettmiss/petJournal/application/domain/attempt"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"time"
+)
+
+var attemptColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"failures INTEGER NOT NULL DEFAULT 0",
+	"last_failure_at INTEGER NOT NULL",
+	"locked_until INTEGER",
+}
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Repository that stores attempts in the login_attempts table
+// of db, creating the table if needed.
+func NewSQL(db *sql.DB) (Repository, error) {
+	err := sqldb.EnsureTable(db, "login_attempts", attemptColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRepository{db: db}, nil
+}
+
+// conn returns the transaction in ctx, if any, or the database
+func (r *sqlRepository) conn(ctx context.Context) sqldb.Querier {
+	return sqldb.Conn(ctx, r.db)
+}
+
+func (r *sqlRepository) Attempt(ctx context.Context, key string) (attempt.Attempt, error) {
+	var (
+		a             attempt.Attempt
+		lastFailureAt int64
+		lockedUntil   sql.NullInt64
+	)
+
+	err := r.conn(ctx).QueryRowContext(ctx, `SELECT id, failures, last_failure_at, locked_until
+		FROM login_attempts WHERE id = ?`, key).Scan(&a.Key, &a.Failures, &lastFailureAt, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return attempt.Nil, attempt.ErrNotFound
+	}
+	if err != nil {
+		return attempt.Nil, err
+	}
+
+	a.LastFailureAt = sqldb.ParseTime(lastFailureAt)
+	a.LockedUntil = sqldb.ParseNullTime(lockedUntil)
+
+	return a, nil
+}
+
+func (r *sqlRepository) AddFailure(ctx context.Context, key string, at time.Time, since time.Time) (attempt.Attempt, error) {
+	_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO login_attempts (id, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (id) DO UPDATE SET
+		failures = CASE WHEN last_failure_at >= ? THEN failures + 1 ELSE 1 END,
+		last_failure_at = excluded.last_failure_at`,
+		key, sqldb.Time(at), sqldb.Time(since))
+	if err != nil {
+		return attempt.Nil, err
+	}
+
+	return r.Attempt(ctx, key)
+}
+
+func (r *sqlRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE login_attempts SET locked_until = ? WHERE id = ?",
+		sqldb.Time(until), key)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return attempt.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) DeleteAttempts(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+
+	_, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM login_attempts WHERE id IN ("+sqldb.Placeholders(len(keys))+")",
+		args...)
+
+	return err
+}
+
+func (r *sqlRepository) PurgeAttempts(ctx context.Context, before time.Time) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM login_attempts
+		WHERE last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)`,
+		sqldb.Time(before), sqldb.Time(before))
+
+	return err
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache stores values the repositories read, so they can be served without a
+// round trip to the database
+type Cache[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	Delete(keys ...K)
+	Stats() Stats
+}
+
+// Stats counts how a Cache was used since it was created
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+type lru[K comparable, V any] struct {
+	mux     sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[K]*list.Element
+	// order holds the entries, most recently used first
+	order *list.List
+
+	hits, misses, evictions uint64
+}
+
+// NewLRU returns a Cache that holds at most size entries, evicting the least
+// recently used one when full. Entries expire ttl after they are set. It is
+// safe for concurrent use.
+func NewLRU[K comparable, V any](size int, ttl time.Duration) Cache[K, V] {
+	return &lru[K, V]{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[K]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *lru[K, V]) Get(key K) (V, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	var zero V
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return zero, false
+	}
+
+	e := el.Value.(*entry[K, V])
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		c.misses++
+		return zero, false
+	}
+
+	c.order.MoveToFront(el)
+	c.hits++
+
+	return e.value, true
+}
+
+func (c *lru[K, V]) Set(key K, value V) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value = value
+		e.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+func (c *lru[K, V]) Delete(keys ...K) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *lru[K, V]) Stats() Stats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.order.Len(),
+	}
+}
+
+// remove deletes the entry of el. Callers must hold the lock.
+func (c *lru[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// backfillDeletedAt sets the deletion time of the documents deleted before it
+// was recorded to their last update, so that the purge can tell their age, and
+// indexes it.
+func backfillDeletedAt(ctx context.Context, db *mongo.Database) error {
+	for _, name := range []string{"users", "pets", "records"} {
+		collection := db.Collection(name)
+
+		filter := bson.M{"deleted": true, "deleted_at": bson.M{"$exists": false}}
+		update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"deleted_at": "$updated_at"}}}}
+		_, err := collection.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+
+		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "deleted_at", Value: 1}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// indexLoginAttempts creates the index the stale login attempts are purged by
+func indexLoginAttempts(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("login_attempts").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "last_failure_at", Value: 1}},
+	})
+
+	return err
+}
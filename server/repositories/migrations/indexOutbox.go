@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// indexOutbox creates the index the relay finds the due outbox messages by
+func indexOutbox(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("outbox").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "dead", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+	})
+
+	return err
+}
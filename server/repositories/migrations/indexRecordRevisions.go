@@ -0,0 +1,17 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// indexRecordRevisions creates the index the revisions of a record are
+// listed by
+func indexRecordRevisions(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("record_revisions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "record_id", Value: 1}, {Key: "version", Value: 1}},
+	})
+
+	return err
+}
@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// indexSessions creates the index the sessions of a user are listed by
+func indexSessions(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("sessions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+
+	return err
+}
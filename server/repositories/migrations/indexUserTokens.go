@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexUserTokens creates the indexes the one-time user tokens are looked up
+// and replaced by
+func indexUserTokens(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("user_tokens").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+	})
+
+	return err
+}
@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// indexUsers creates the index the admins list the users of a type by
+func indexUsers(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_type", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+
+	return err
+}
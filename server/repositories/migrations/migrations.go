@@ -0,0 +1,149 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// Migration is a single change to the schema of the mongo collections.
+// Up must be safe to run again if it fails halfway through.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// Migrations lists every migration in ascending Version order. New migrations
+// are appended, applied ones are never edited.
+var Migrations = []Migration{
+	{Version: 1, Description: "normalize field naming and create indexes", Up: normalizeNaming},
+	{Version: 2, Description: "backfill and index the deletion time", Up: backfillDeletedAt},
+	{Version: 3, Description: "index the record revisions", Up: indexRecordRevisions},
+	{Version: 4, Description: "index the outbox", Up: indexOutbox},
+	{Version: 5, Description: "index the refresh tokens", Up: indexRefreshTokens},
+	{Version: 6, Description: "index the sessions", Up: indexSessions},
+	{Version: 7, Description: "index the user tokens", Up: indexUserTokens},
+	{Version: 8, Description: "index the login attempts", Up: indexLoginAttempts},
+	{Version: 9, Description: "index the users by type", Up: indexUsers},
+}
+
+// Status tells whether a migration has been applied to the database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type migrationDBModel struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+type Migrator struct {
+	db         *mongo.Database
+	migrations *mongo.Collection
+}
+
+// New returns a Migrator that records the applied migrations of db in its
+// migrations collection.
+func New(db *mongo.Database) *Migrator {
+	return &Migrator{
+		db:         db,
+		migrations: db.Collection("migrations"),
+	}
+}
+
+// Status returns the status of every known migration
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(Migrations))
+	for _, mig := range Migrations {
+		s := Status{Migration: mig}
+		if dbMig, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = dbMig.AppliedAt
+		}
+		statuses = append(statuses, s)
+	}
+
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, mig := range Migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies the pending migrations in order and returns the ones it applied.
+// It stops at the first migration that fails.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range pending {
+		err = mig.Up(ctx, m.db)
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Description, err)
+		}
+
+		_, err = m.migrations.InsertOne(ctx, migrationDBModel{
+			Version:     mig.Version,
+			Description: mig.Description,
+			AppliedAt:   time.Now(),
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			return done, fmt.Errorf("migration %d (%s) was applied concurrently", mig.Version, mig.Description)
+		}
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]migrationDBModel, error) {
+	cursor, err := m.migrations.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	applied := make(map[int]migrationDBModel)
+	for cursor.Next(ctx) {
+		var mig migrationDBModel
+		err = cursor.Decode(&mig)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[mig.Version] = mig
+	}
+
+	return applied, cursor.Err()
+}
@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"github.com/scarlettmiss/petJournal/repositories/userrepo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// normalizeNaming renames the camelCase record fields to the snake_case used
+// by the pets and users collections and creates the indexes the repositories
+// query by.
+func normalizeNaming(ctx context.Context, db *mongo.Database) error {
+	records := db.Collection("records")
+
+	// replaced by the pet_id index below
+	err := dropIndex(ctx, records, "petId_1_date_1")
+	if err != nil {
+		return err
+	}
+
+	_, err = records.UpdateMany(ctx, bson.M{}, bson.M{"$rename": bson.M{
+		"createdAt":  "created_at",
+		"updatedAt":  "updated_at",
+		"petId":      "pet_id",
+		"recordType": "record_type",
+	}})
+	if err != nil {
+		return err
+	}
+
+	_, err = records.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "pet_id", Value: 1}, {Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "group_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("pets").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner_id", Value: 1}}},
+		{Keys: bson.D{{Key: "vet_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// fails if the collection already holds duplicate emails
+	_, err = db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true).SetCollation(userrepo.EmailCollation),
+	})
+
+	return err
+}
+
+// dropIndex drops the named index, ignoring a missing index or collection
+func dropIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	_, err := collection.Indexes().DropOne(ctx, name)
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound") {
+		return nil
+	}
+
+	return err
+}
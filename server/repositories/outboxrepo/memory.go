@@ -0,0 +1,98 @@
+package outboxrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/outbox"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mux      sync.RWMutex
+	messages map[uuid.UUID]outbox.Message
+}
+
+// NewMemory returns a thread-safe Repository that keeps the outbox in memory.
+// It is meant for local development and tests where no database is available.
+func NewMemory() Repository {
+	return &memoryRepository{
+		messages: make(map[uuid.UUID]outbox.Message),
+	}
+}
+
+func (r *memoryRepository) CreateMessages(ctx context.Context, msgs []outbox.Message) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for _, m := range msgs {
+		r.remember(ctx, m.Id)
+		r.messages[m.Id] = m
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) DueMessages(ctx context.Context, now time.Time, limit int) ([]outbox.Message, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	var msgs []outbox.Message
+	for _, m := range r.messages {
+		if !m.Dead && !m.NextAttemptAt.After(now) {
+			msgs = append(msgs, m)
+		}
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+	})
+
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+
+	return msgs, nil
+}
+
+func (r *memoryRepository) UpdateMessage(ctx context.Context, m outbox.Message) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, ok := r.messages[m.Id]; !ok {
+		return nil
+	}
+
+	r.remember(ctx, m.Id)
+	r.messages[m.Id] = m
+
+	return nil
+}
+
+func (r *memoryRepository) DeleteMessage(ctx context.Context, id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.remember(ctx, id)
+	delete(r.messages, id)
+
+	return nil
+}
+
+// remember registers the current state of the message to be restored if the
+// transaction in ctx is rolled back. Callers must hold the lock.
+func (r *memoryRepository) remember(ctx context.Context, id uuid.UUID) {
+	old, ok := r.messages[id]
+	transaction.OnRollback(ctx, func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if ok {
+			r.messages[id] = old
+		} else {
+			delete(r.messages, id)
+		}
+	})
+}
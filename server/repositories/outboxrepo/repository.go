@@ -0,0 +1,123 @@
+package outboxrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MessageDBModel struct {
+	Id            uuid.UUID `bson:"_id"`
+	CreatedAt     time.Time `bson:"created_at"`
+	Event         string    `bson:"event"`
+	Payload       string    `bson:"payload"`
+	Attempts      int       `bson:"attempts"`
+	NextAttemptAt time.Time `bson:"next_attempt_at"`
+	LastError     string    `bson:"last_error,omitempty"`
+	Dead          bool      `bson:"dead"`
+}
+
+func ConvertToMessageDBModel(m outbox.Message) MessageDBModel {
+	return MessageDBModel{
+		Id:            m.Id,
+		CreatedAt:     m.CreatedAt,
+		Event:         m.Event,
+		Payload:       m.Payload,
+		Attempts:      m.Attempts,
+		NextAttemptAt: m.NextAttemptAt,
+		LastError:     m.LastError,
+		Dead:          m.Dead,
+	}
+}
+
+func ConvertToMessageDomainModel(dbMessage MessageDBModel) outbox.Message {
+	return outbox.Message{
+		Id:            dbMessage.Id,
+		CreatedAt:     dbMessage.CreatedAt,
+		Event:         dbMessage.Event,
+		Payload:       dbMessage.Payload,
+		Attempts:      dbMessage.Attempts,
+		NextAttemptAt: dbMessage.NextAttemptAt,
+		LastError:     dbMessage.LastError,
+		Dead:          dbMessage.Dead,
+	}
+}
+
+type Repository interface {
+	CreateMessages(ctx context.Context, msgs []outbox.Message) error
+	// DueMessages returns up to limit messages that are not dead and due at
+	// now, oldest first
+	DueMessages(ctx context.Context, now time.Time, limit int) ([]outbox.Message, error)
+	UpdateMessage(ctx context.Context, m outbox.Message) error
+	DeleteMessage(ctx context.Context, id uuid.UUID) error
+}
+
+type repository struct {
+	messages *mongo.Collection
+}
+
+func New(collection *mongo.Collection) Repository {
+	return &repository{
+		messages: collection,
+	}
+}
+
+func (r *repository) CreateMessages(ctx context.Context, msgs []outbox.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	dbItems := make([]interface{}, len(msgs))
+	for i, m := range msgs {
+		dbMsg, err := bson.Marshal(ConvertToMessageDBModel(m))
+		if err != nil {
+			return err
+		}
+		dbItems[i] = dbMsg
+	}
+
+	_, err := r.messages.InsertMany(ctx, dbItems)
+
+	return err
+}
+
+func (r *repository) DueMessages(ctx context.Context, now time.Time, limit int) ([]outbox.Message, error) {
+	var msgs []outbox.Message
+
+	filter := bson.M{"dead": false, "next_attempt_at": bson.M{"$lte": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := r.messages.Find(ctx, filter, opts)
+	if err != nil {
+		return msgs, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var m MessageDBModel
+		err = cursor.Decode(&m)
+		if err != nil {
+			return msgs, err
+		}
+
+		msgs = append(msgs, ConvertToMessageDomainModel(m))
+	}
+
+	return msgs, cursor.Err()
+}
+
+func (r *repository) UpdateMessage(ctx context.Context, m outbox.Message) error {
+	_, err := r.messages.ReplaceOne(ctx, bson.M{"_id": m.Id}, ConvertToMessageDBModel(m))
+
+	return err
+}
+
+func (r *repository) DeleteMessage(ctx context.Context, id uuid.UUID) error {
+	_, err := r.messages.DeleteOne(ctx, bson.M{"_id": id})
+
+	return err
+}
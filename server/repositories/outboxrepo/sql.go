@@ -0,0 +1,103 @@
+package outboxrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/outbox"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"time"
+)
+
+var messageColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"created_at INTEGER NOT NULL",
+	"event TEXT NOT NULL",
+	"payload TEXT NOT NULL",
+	"attempts INTEGER NOT NULL DEFAULT 0",
+	"next_attempt_at INTEGER NOT NULL",
+	"last_error TEXT NOT NULL DEFAULT ''",
+	"dead INTEGER NOT NULL DEFAULT 0",
+}
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Repository that stores the outbox in the outbox table of
+// db, creating the table if needed.
+func NewSQL(db *sql.DB) (Repository, error) {
+	err := sqldb.EnsureTable(db, "outbox", messageColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "outbox", "dead", "next_attempt_at")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRepository{db: db}, nil
+}
+
+// conn returns the transaction in ctx, if any, or the database
+func (r *sqlRepository) conn(ctx context.Context) sqldb.Querier {
+	return sqldb.Conn(ctx, r.db)
+}
+
+func (r *sqlRepository) CreateMessages(ctx context.Context, msgs []outbox.Message) error {
+	for _, m := range msgs {
+		_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO outbox (id, created_at, event, payload, attempts,
+			next_attempt_at, last_error, dead) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.Id, sqldb.Time(m.CreatedAt), m.Event, m.Payload, m.Attempts, sqldb.Time(m.NextAttemptAt), m.LastError,
+			m.Dead)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) DueMessages(ctx context.Context, now time.Time, limit int) ([]outbox.Message, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT id, created_at, event, payload, attempts, next_attempt_at,
+		last_error, dead FROM outbox WHERE dead = 0 AND next_attempt_at <= ? ORDER BY created_at LIMIT ?`,
+		sqldb.Time(now), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []outbox.Message
+	for rows.Next() {
+		var (
+			m                      outbox.Message
+			createdAt, nextAttempt int64
+		)
+
+		err = rows.Scan(&m.Id, &createdAt, &m.Event, &m.Payload, &m.Attempts, &nextAttempt, &m.LastError, &m.Dead)
+		if err != nil {
+			return msgs, err
+		}
+
+		m.CreatedAt = sqldb.ParseTime(createdAt)
+		m.NextAttemptAt = sqldb.ParseTime(nextAttempt)
+
+		msgs = append(msgs, m)
+	}
+
+	return msgs, rows.Err()
+}
+
+func (r *sqlRepository) UpdateMessage(ctx context.Context, m outbox.Message) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `UPDATE outbox SET attempts = ?, next_attempt_at = ?, last_error = ?,
+		dead = ? WHERE id = ?`, m.Attempts, sqldb.Time(m.NextAttemptAt), m.LastError, m.Dead, m.Id)
+
+	return err
+}
+
+func (r *sqlRepository) DeleteMessage(ctx context.Context, id uuid.UUID) error {
+	_, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM outbox WHERE id = ?", id)
+
+	return err
+}
@@ -0,0 +1,114 @@
+package petrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/pet"
+	"github.com/scarlettmiss/petJournal/repositories/cache"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+)
+
+type cachedRepository struct {
+	Repository
+	cache cache.Cache[uuid.UUID, pet.Pet]
+}
+
+// NewCached returns a Repository that serves the lookups by id from c and
+// reads through to repo on a miss, like userrepo.NewCached does for users.
+func NewCached(repo Repository, c cache.Cache[uuid.UUID, pet.Pet]) Repository {
+	return &cachedRepository{Repository: repo, cache: c}
+}
+
+func (r *cachedRepository) Pet(ctx context.Context, id uuid.UUID) (pet.Pet, error) {
+	if transaction.InTransaction(ctx) {
+		return r.Repository.Pet(ctx, id)
+	}
+
+	if p, ok := r.cache.Get(id); ok {
+		return clonePet(p), nil
+	}
+
+	p, err := r.Repository.Pet(ctx, id)
+	if err != nil {
+		return pet.Nil, err
+	}
+	r.cache.Set(id, clonePet(p))
+
+	return p, nil
+}
+
+func (r *cachedRepository) PetsByIds(ctx context.Context, ids []uuid.UUID) ([]pet.Pet, error) {
+	if transaction.InTransaction(ctx) {
+		return r.Repository.PetsByIds(ctx, ids)
+	}
+
+	var (
+		pets    []pet.Pet
+		missing []uuid.UUID
+	)
+	for _, id := range ids {
+		if p, ok := r.cache.Get(id); ok {
+			pets = append(pets, clonePet(p))
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) == 0 {
+		return pets, nil
+	}
+
+	fetched, err := r.Repository.PetsByIds(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range fetched {
+		r.cache.Set(p.Id, clonePet(p))
+	}
+
+	return append(pets, fetched...), nil
+}
+
+func (r *cachedRepository) PetByUser(ctx context.Context, userId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
+	if transaction.InTransaction(ctx) {
+		return r.Repository.PetByUser(ctx, userId, id, includeDel)
+	}
+
+	p, err := r.Pet(ctx, id)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	if (p.OwnerId != userId && p.VetId != userId) || (!includeDel && p.Deleted) {
+		return pet.Nil, pet.ErrNotFound
+	}
+
+	return p, nil
+}
+
+func (r *cachedRepository) UpdatePet(ctx context.Context, p pet.Pet) (pet.Pet, error) {
+	defer r.invalidate(ctx, p.Id)
+
+	return r.Repository.UpdatePet(ctx, p)
+}
+
+func (r *cachedRepository) DeletePet(ctx context.Context, id uuid.UUID) error {
+	defer r.invalidate(ctx, id)
+
+	return r.Repository.DeletePet(ctx, id)
+}
+
+func (r *cachedRepository) PurgePets(ctx context.Context, ids []uuid.UUID) error {
+	defer r.invalidate(ctx, ids...)
+
+	return r.Repository.PurgePets(ctx, ids)
+}
+
+// invalidate drops the pets from the cache now and, in a transaction, once it
+// commits, in case a concurrent lookup cached them in between
+func (r *cachedRepository) invalidate(ctx context.Context, ids ...uuid.UUID) {
+	r.cache.Delete(ids...)
+	transaction.AfterCommit(ctx, func() {
+		r.cache.Delete(ids...)
+	})
+}
@@ -0,0 +1,203 @@
+package petrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/scarlettmiss/petJournal/application/domain/pet"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mux  sync.RWMutex
+	pets map[uuid.UUID]pet.Pet
+}
+
+// NewMemory returns a thread-safe Repository that keeps every pet in memory.
+// It is meant for local development and tests where no database is available.
+func NewMemory() Repository {
+	return &memoryRepository{
+		pets: make(map[uuid.UUID]pet.Pet),
+	}
+}
+
+func (r *memoryRepository) CreatePet(ctx context.Context, p pet.Pet) (pet.Pet, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return pet.Nil, err
+	}
+	p.Id = id
+
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+
+	p.Deleted = false
+	p.Version = 1
+
+	r.remember(ctx, p.Id)
+	r.pets[p.Id] = clonePet(p)
+
+	return p, nil
+}
+
+func (r *memoryRepository) Pet(ctx context.Context, id uuid.UUID) (pet.Pet, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	p, ok := r.pets[id]
+	if !ok {
+		return pet.Nil, pet.ErrNotFound
+	}
+
+	return clonePet(p), nil
+}
+
+func (r *memoryRepository) Pets(ctx context.Context, includeDel bool) ([]pet.Pet, error) {
+	return r.petsInternal(func(pet.Pet) bool { return true }, includeDel)
+}
+
+func (r *memoryRepository) PetsByIds(ctx context.Context, ids []uuid.UUID) ([]pet.Pet, error) {
+	return r.petsInternal(func(p pet.Pet) bool { return lo.Contains(ids, p.Id) }, true)
+}
+
+func (r *memoryRepository) PetsByOwner(ctx context.Context, ownerId uuid.UUID, includeDel bool) ([]pet.Pet, error) {
+	return r.petsInternal(func(p pet.Pet) bool { return p.OwnerId == ownerId }, includeDel)
+}
+
+func (r *memoryRepository) PetsByVet(ctx context.Context, vetId uuid.UUID, includeDel bool) ([]pet.Pet, error) {
+	return r.petsInternal(func(p pet.Pet) bool { return p.VetId == vetId }, includeDel)
+}
+
+func (r *memoryRepository) PetByUser(ctx context.Context, userId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	p, ok := r.pets[id]
+	if !ok || (p.OwnerId != userId && p.VetId != userId) || (!includeDel && p.Deleted) {
+		return pet.Nil, pet.ErrNotFound
+	}
+
+	return clonePet(p), nil
+}
+
+func (r *memoryRepository) petsInternal(match func(p pet.Pet) bool, includeDel bool) ([]pet.Pet, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	var pets []pet.Pet
+	for _, p := range r.pets {
+		if (!includeDel && p.Deleted) || !match(p) {
+			continue
+		}
+		pets = append(pets, clonePet(p))
+	}
+
+	// keep the insertion order the mongo repository returns
+	sort.Slice(pets, func(i, j int) bool {
+		return pets[i].CreatedAt.Before(pets[j].CreatedAt)
+	})
+
+	return pets, nil
+}
+
+func (r *memoryRepository) UpdatePet(ctx context.Context, p pet.Pet) (pet.Pet, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.updatePetInternal(ctx, p)
+}
+
+func (r *memoryRepository) updatePetInternal(ctx context.Context, p pet.Pet) (pet.Pet, error) {
+	old, ok := r.pets[p.Id]
+	if !ok {
+		return pet.Nil, pet.ErrNotFound
+	}
+	if old.Version != p.Version {
+		return pet.Nil, pet.ErrConflict
+	}
+
+	p.UpdatedAt = time.Now()
+	p.Version++
+	r.remember(ctx, p.Id)
+	r.pets[p.Id] = clonePet(p)
+
+	return p, nil
+}
+
+func (r *memoryRepository) DeletePet(ctx context.Context, id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	p, ok := r.pets[id]
+	if !ok {
+		return pet.ErrNotFound
+	}
+
+	p.Deleted = true
+	p.DeletedAt = time.Now()
+
+	_, err := r.updatePetInternal(ctx, p)
+
+	return err
+}
+
+func (r *memoryRepository) PetsDeletedBefore(ctx context.Context, before time.Time) ([]pet.Pet, error) {
+	return r.petsInternal(func(p pet.Pet) bool {
+		return p.Deleted && !p.DeletedAt.IsZero() && p.DeletedAt.Before(before)
+	}, true)
+}
+
+func (r *memoryRepository) PurgePets(ctx context.Context, ids []uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for _, id := range ids {
+		if _, ok := r.pets[id]; !ok {
+			continue
+		}
+
+		r.remember(ctx, id)
+		delete(r.pets, id)
+	}
+
+	return nil
+}
+
+// remember registers the current state of the pet to be restored if the
+// transaction in ctx is rolled back. Callers must hold the lock.
+func (r *memoryRepository) remember(ctx context.Context, id uuid.UUID) {
+	old, ok := r.pets[id]
+	transaction.OnRollback(ctx, func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if ok {
+			r.pets[id] = old
+		} else {
+			delete(r.pets, id)
+		}
+	})
+}
+
+// clonePet copies the slice and map fields so that callers cannot mutate
+// the stored pet through shared references.
+func clonePet(p pet.Pet) pet.Pet {
+	if p.Colors != nil {
+		p.Colors = append([]string(nil), p.Colors...)
+	}
+	if p.Metas != nil {
+		metas := make(map[string]string, len(p.Metas))
+		for k, v := range p.Metas {
+			metas[k] = v
+		}
+		p.Metas = metas
+	}
+	return p
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/scarlettmiss/petJournal/application/domain/pet"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"sync"
 	"time"
 )
 
@@ -15,6 +14,8 @@ type PetDBModel struct {
 	CreatedAt   time.Time         `bson:"created_at"`
 	UpdatedAt   time.Time         `bson:"updated_at"`
 	Deleted     bool              `bson:"deleted"`
+	DeletedAt   time.Time         `bson:"deleted_at,omitempty"`
+	Version     int64             `bson:"version"`
 	Name        string            `bson:"name"`
 	DateOfBirth time.Time         `bson:"date_of_birth,omitempty"`
 	Gender      string            `bson:"gender,omitempty"`
@@ -35,6 +36,8 @@ func ConvertToPetDBModel(pet pet.Pet) PetDBModel {
 		CreatedAt:   pet.CreatedAt,
 		UpdatedAt:   pet.UpdatedAt,
 		Deleted:     pet.Deleted,
+		DeletedAt:   pet.DeletedAt,
+		Version:     pet.Version,
 		Name:        pet.Name,
 		DateOfBirth: pet.DateOfBirth,
 		Gender:      string(pet.Gender),
@@ -56,6 +59,8 @@ func ConvertToPetDomainModel(dbPet PetDBModel) pet.Pet {
 		CreatedAt:   dbPet.CreatedAt,
 		UpdatedAt:   dbPet.UpdatedAt,
 		Deleted:     dbPet.Deleted,
+		DeletedAt:   dbPet.DeletedAt,
+		Version:     dbPet.Version,
 		Name:        dbPet.Name,
 		DateOfBirth: dbPet.DateOfBirth,
 		Gender:      pet.Gender(dbPet.Gender),
@@ -72,15 +77,22 @@ func ConvertToPetDomainModel(dbPet PetDBModel) pet.Pet {
 }
 
 type Repository interface {
-	CreatePet(pet pet.Pet) (pet.Pet, error)
-	Pet(id uuid.UUID) (pet.Pet, error)
-	Pets(includeDel bool) ([]pet.Pet, error)
-	UpdatePet(pet pet.Pet) (pet.Pet, error)
-	DeletePet(id uuid.UUID) error
+	CreatePet(ctx context.Context, pet pet.Pet) (pet.Pet, error)
+	Pet(ctx context.Context, id uuid.UUID) (pet.Pet, error)
+	Pets(ctx context.Context, includeDel bool) ([]pet.Pet, error)
+	// PetsByIds returns the pets with the given ids, deleted ones included.
+	// Ids without a pet are skipped.
+	PetsByIds(ctx context.Context, ids []uuid.UUID) ([]pet.Pet, error)
+	PetsByOwner(ctx context.Context, ownerId uuid.UUID, includeDel bool) ([]pet.Pet, error)
+	PetsByVet(ctx context.Context, vetId uuid.UUID, includeDel bool) ([]pet.Pet, error)
+	PetByUser(ctx context.Context, userId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error)
+	UpdatePet(ctx context.Context, pet pet.Pet) (pet.Pet, error)
+	DeletePet(ctx context.Context, id uuid.UUID) error
+	PetsDeletedBefore(ctx context.Context, before time.Time) ([]pet.Pet, error)
+	PurgePets(ctx context.Context, ids []uuid.UUID) error
 }
 
 type repository struct {
-	mux  sync.Mutex
 	pets *mongo.Collection
 }
 
@@ -90,10 +102,7 @@ func New(collection *mongo.Collection) Repository {
 	}
 }
 
-func (r *repository) CreatePet(p pet.Pet) (pet.Pet, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
+func (r *repository) CreatePet(ctx context.Context, p pet.Pet) (pet.Pet, error) {
 	id, err := uuid.NewRandom()
 	if err != nil {
 		return pet.Nil, err
@@ -105,13 +114,14 @@ func (r *repository) CreatePet(p pet.Pet) (pet.Pet, error) {
 	p.UpdatedAt = now
 
 	p.Deleted = false
+	p.Version = 1
 
 	dbPet, err := bson.Marshal(ConvertToPetDBModel(p))
 	if err != nil {
 		return pet.Nil, err
 	}
 
-	_, err = r.pets.InsertOne(context.Background(), dbPet)
+	_, err = r.pets.InsertOne(ctx, dbPet)
 	if err != nil {
 		return pet.Nil, err
 	}
@@ -119,42 +129,75 @@ func (r *repository) CreatePet(p pet.Pet) (pet.Pet, error) {
 	return p, nil
 }
 
-func (r *repository) Pet(id uuid.UUID) (pet.Pet, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
-	retrievedPet, err := r.petInternal(id)
+func (r *repository) Pet(ctx context.Context, id uuid.UUID) (pet.Pet, error) {
+	retrievedPet, err := r.petInternal(ctx, id)
 	return ConvertToPetDomainModel(retrievedPet), err
 }
 
-func (r *repository) petInternal(id uuid.UUID) (PetDBModel, error) {
+func (r *repository) petInternal(ctx context.Context, id uuid.UUID) (PetDBModel, error) {
 	var retrievedPet PetDBModel
 
 	filter := bson.M{"_id": id}
 
-	err := r.pets.FindOne(context.Background(), filter).Decode(&retrievedPet)
-	if err != nil {
+	err := r.pets.FindOne(ctx, filter).Decode(&retrievedPet)
+	if err == mongo.ErrNoDocuments {
 		return PetDBModel{}, pet.ErrNotFound
 	}
+	if err != nil {
+		return PetDBModel{}, err
+	}
 	return retrievedPet, nil
 }
 
-func (r *repository) Pets(includeDel bool) ([]pet.Pet, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
+func (r *repository) Pets(ctx context.Context, includeDel bool) ([]pet.Pet, error) {
+	// Define an empty filter to retrieve all pets
+	return r.petsInternal(ctx, bson.M{}, includeDel)
+}
 
-	var pets []pet.Pet
+func (r *repository) PetsByIds(ctx context.Context, ids []uuid.UUID) ([]pet.Pet, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
 
-	// Define an empty filter to retrieve all pets
-	var filter bson.M
+	return r.petsInternal(ctx, bson.M{"_id": bson.M{"$in": ids}}, true)
+}
 
-	if includeDel {
-		filter = bson.M{}
-	} else {
-		filter = bson.M{"deleted": false}
+func (r *repository) PetsByOwner(ctx context.Context, ownerId uuid.UUID, includeDel bool) ([]pet.Pet, error) {
+	return r.petsInternal(ctx, bson.M{"owner_id": ownerId}, includeDel)
+}
+
+func (r *repository) PetsByVet(ctx context.Context, vetId uuid.UUID, includeDel bool) ([]pet.Pet, error) {
+	return r.petsInternal(ctx, bson.M{"vet_id": vetId}, includeDel)
+}
+
+func (r *repository) PetByUser(ctx context.Context, userId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{bson.M{"owner_id": userId}, bson.M{"vet_id": userId}},
+	}
+	if !includeDel {
+		filter["deleted"] = false
+	}
+
+	var retrievedPet PetDBModel
+	err := r.pets.FindOne(ctx, filter).Decode(&retrievedPet)
+	if err == mongo.ErrNoDocuments {
+		return pet.Nil, pet.ErrNotFound
+	}
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	return ConvertToPetDomainModel(retrievedPet), nil
+}
+
+func (r *repository) petsInternal(ctx context.Context, filter bson.M, includeDel bool) ([]pet.Pet, error) {
+	var pets []pet.Pet
+
+	if !includeDel {
+		filter["deleted"] = false
 	}
 
-	ctx := context.Background()
 	// Perform the find operation
 	cursor, err := r.pets.Find(ctx, filter)
 	if err != nil {
@@ -162,7 +205,7 @@ func (r *repository) Pets(includeDel bool) ([]pet.Pet, error) {
 	}
 	defer cursor.Close(ctx)
 
-	// Iterate over the cursor and decode the users
+	// Iterate over the cursor and decode the pets
 	for cursor.Next(ctx) {
 		var p PetDBModel
 		err = cursor.Decode(&p)
@@ -183,11 +226,8 @@ func (r *repository) Pets(includeDel bool) ([]pet.Pet, error) {
 	return pets, nil
 }
 
-func (r *repository) UpdatePet(p pet.Pet) (pet.Pet, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
-	updatedPet, err := r.updatePetInternal(ConvertToPetDBModel(p))
+func (r *repository) UpdatePet(ctx context.Context, p pet.Pet) (pet.Pet, error) {
+	updatedPet, err := r.updatePetInternal(ctx, ConvertToPetDBModel(p))
 	if err != nil {
 		return pet.Nil, err
 	}
@@ -195,38 +235,68 @@ func (r *repository) UpdatePet(p pet.Pet) (pet.Pet, error) {
 	return ConvertToPetDomainModel(updatedPet), nil
 }
 
-func (r *repository) updatePetInternal(p PetDBModel) (PetDBModel, error) {
-	// Define the filter to identify the document to update
-	filter := bson.M{"_id": p.Id}
+func (r *repository) updatePetInternal(ctx context.Context, p PetDBModel) (PetDBModel, error) {
+	// Only replace the document if it was not updated since it was read.
+	// Documents written before versioning have no version field.
+	filter := bson.M{"_id": p.Id, "version": p.Version}
+	if p.Version == 0 {
+		filter["version"] = bson.M{"$exists": false}
+	}
 
-	// Define the update document using the '$set' operator
 	p.UpdatedAt = time.Now()
+	p.Version++
+
 	replacement, err := bson.Marshal(p)
 	if err != nil {
 		return PetDBModel{}, err
 	}
 
-	// Perform the update operation
-	_, err = r.pets.ReplaceOne(context.Background(), filter, replacement)
+	res, err := r.pets.ReplaceOne(ctx, filter, replacement)
 	if err != nil {
 		return PetDBModel{}, err
 	}
 
+	if res.MatchedCount == 0 {
+		// tell a missing pet apart from a stale one
+		_, err = r.petInternal(ctx, p.Id)
+		if err != nil {
+			return PetDBModel{}, err
+		}
+		return PetDBModel{}, pet.ErrConflict
+	}
+
 	return p, nil
 }
 
-func (r *repository) DeletePet(id uuid.UUID) error {
-	r.mux.Lock()
-	defer r.mux.Unlock()
+func (r *repository) DeletePet(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{"deleted": true, "deleted_at": now, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}
 
-	retrievedPet, err := r.petInternal(id)
+	res, err := r.pets.UpdateOne(ctx, bson.M{"_id": id}, update)
 	if err != nil {
 		return err
 	}
 
-	retrievedPet.Deleted = true
+	if res.MatchedCount == 0 {
+		return pet.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) PetsDeletedBefore(ctx context.Context, before time.Time) ([]pet.Pet, error) {
+	return r.petsInternal(ctx, bson.M{"deleted": true, "deleted_at": bson.M{"$lt": before}}, true)
+}
+
+func (r *repository) PurgePets(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
 
-	_, err = r.updatePetInternal(retrievedPet)
+	_, err := r.pets.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
 
 	return err
 }
@@ -0,0 +1,290 @@
+package petrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/pet"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"time"
+)
+
+var petColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"created_at INTEGER NOT NULL",
+	"updated_at INTEGER NOT NULL",
+	"deleted INTEGER NOT NULL DEFAULT 0",
+	"version INTEGER NOT NULL DEFAULT 0",
+	"name TEXT NOT NULL",
+	"date_of_birth INTEGER NOT NULL",
+	"gender TEXT NOT NULL DEFAULT ''",
+	"breed_name TEXT NOT NULL DEFAULT ''",
+	"colors TEXT",
+	"description TEXT NOT NULL DEFAULT ''",
+	"pedigree TEXT NOT NULL DEFAULT ''",
+	"microchip TEXT NOT NULL DEFAULT ''",
+	"owner_id TEXT NOT NULL",
+	"vet_id TEXT NOT NULL",
+	"metas TEXT",
+	"avatar TEXT NOT NULL DEFAULT ''",
+	"deleted_at INTEGER",
+}
+
+const petSelect = `SELECT id, created_at, updated_at, deleted, version, name, date_of_birth, gender, breed_name,
+	colors, description, pedigree, microchip, owner_id, vet_id, metas, avatar, deleted_at
+	FROM pets`
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Repository that stores pets in the pets table of db,
+// creating the table if needed.
+func NewSQL(db *sql.DB) (Repository, error) {
+	err := sqldb.EnsureTable(db, "pets", petColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "pets", "owner_id")
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "pets", "vet_id")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRepository{db: db}, nil
+}
+
+// conn returns the transaction in ctx, if any, or the database
+func (r *sqlRepository) conn(ctx context.Context) sqldb.Querier {
+	return sqldb.Conn(ctx, r.db)
+}
+
+func (r *sqlRepository) CreatePet(ctx context.Context, p pet.Pet) (pet.Pet, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return pet.Nil, err
+	}
+	p.Id = id
+
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+
+	p.Deleted = false
+	p.Version = 1
+
+	colors, err := sqldb.JSON(p.Colors)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	metas, err := sqldb.JSON(p.Metas)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	_, err = r.conn(ctx).ExecContext(ctx, `INSERT INTO pets (id, created_at, updated_at, deleted, version, name, date_of_birth, gender,
+		breed_name, colors, description, pedigree, microchip, owner_id, vet_id, metas, avatar, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Id, sqldb.Time(p.CreatedAt), sqldb.Time(p.UpdatedAt), p.Deleted, p.Version, p.Name, sqldb.Time(p.DateOfBirth),
+		string(p.Gender), p.BreedName, colors, p.Description, p.Pedigree, p.Microchip, p.OwnerId, p.VetId, metas,
+		p.Avatar, sqldb.NullTime(p.DeletedAt))
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	return p, nil
+}
+
+func (r *sqlRepository) Pet(ctx context.Context, id uuid.UUID) (pet.Pet, error) {
+	p, err := scanPet(r.conn(ctx).QueryRowContext(ctx, petSelect+" WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return pet.Nil, pet.ErrNotFound
+	}
+
+	return p, err
+}
+
+func (r *sqlRepository) Pets(ctx context.Context, includeDel bool) ([]pet.Pet, error) {
+	return r.petsInternal(ctx, "1 = 1", includeDel)
+}
+
+func (r *sqlRepository) PetsByIds(ctx context.Context, ids []uuid.UUID) ([]pet.Pet, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	return r.petsInternal(ctx, "id IN ("+sqldb.Placeholders(len(ids))+")", true, args...)
+}
+
+func (r *sqlRepository) PetsByOwner(ctx context.Context, ownerId uuid.UUID, includeDel bool) ([]pet.Pet, error) {
+	return r.petsInternal(ctx, "owner_id = ?", includeDel, ownerId)
+}
+
+func (r *sqlRepository) PetsByVet(ctx context.Context, vetId uuid.UUID, includeDel bool) ([]pet.Pet, error) {
+	return r.petsInternal(ctx, "vet_id = ?", includeDel, vetId)
+}
+
+func (r *sqlRepository) PetByUser(ctx context.Context, userId uuid.UUID, id uuid.UUID, includeDel bool) (pet.Pet, error) {
+	query := petSelect + " WHERE id = ? AND (owner_id = ? OR vet_id = ?)"
+	if !includeDel {
+		query += " AND deleted = 0"
+	}
+
+	p, err := scanPet(r.conn(ctx).QueryRowContext(ctx, query, id, userId, userId))
+	if err == sql.ErrNoRows {
+		return pet.Nil, pet.ErrNotFound
+	}
+
+	return p, err
+}
+
+func (r *sqlRepository) petsInternal(ctx context.Context, where string, includeDel bool, args ...any) ([]pet.Pet, error) {
+	query := petSelect + " WHERE " + where
+	if !includeDel {
+		query += " AND deleted = 0"
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query+" ORDER BY created_at", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pets []pet.Pet
+	for rows.Next() {
+		p, err := scanPet(rows)
+		if err != nil {
+			return pets, err
+		}
+
+		pets = append(pets, p)
+	}
+
+	return pets, rows.Err()
+}
+
+func (r *sqlRepository) UpdatePet(ctx context.Context, p pet.Pet) (pet.Pet, error) {
+	p.UpdatedAt = time.Now()
+
+	colors, err := sqldb.JSON(p.Colors)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	metas, err := sqldb.JSON(p.Metas)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	// only update the row if it was not updated since it was read
+	res, err := r.conn(ctx).ExecContext(ctx, `UPDATE pets SET created_at = ?, updated_at = ?, deleted = ?, version = version + 1,
+		name = ?, date_of_birth = ?, gender = ?, breed_name = ?, colors = ?, description = ?, pedigree = ?,
+		microchip = ?, owner_id = ?, vet_id = ?, metas = ?, avatar = ?, deleted_at = ?
+		WHERE id = ? AND version = ?`,
+		sqldb.Time(p.CreatedAt), sqldb.Time(p.UpdatedAt), p.Deleted, p.Name, sqldb.Time(p.DateOfBirth),
+		string(p.Gender), p.BreedName, colors, p.Description, p.Pedigree, p.Microchip, p.OwnerId, p.VetId, metas,
+		p.Avatar, sqldb.NullTime(p.DeletedAt), p.Id, p.Version)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return pet.Nil, err
+	}
+	if n == 0 {
+		// tell a missing pet apart from a stale one
+		_, err = r.Pet(ctx, p.Id)
+		if err != nil {
+			return pet.Nil, err
+		}
+		return pet.Nil, pet.ErrConflict
+	}
+	p.Version++
+
+	return p, nil
+}
+
+func (r *sqlRepository) DeletePet(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	res, err := r.conn(ctx).ExecContext(ctx, `UPDATE pets SET deleted = 1, deleted_at = ?, version = version + 1, updated_at = ?
+		WHERE id = ?`, sqldb.Time(now), sqldb.Time(now), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return pet.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) PetsDeletedBefore(ctx context.Context, before time.Time) ([]pet.Pet, error) {
+	return r.petsInternal(ctx, "deleted = 1 AND deleted_at < ?", true, sqldb.Time(before))
+}
+
+func (r *sqlRepository) PurgePets(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	_, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM pets WHERE id IN ("+sqldb.Placeholders(len(ids))+")", args...)
+
+	return err
+}
+
+func scanPet(row sqldb.Scanner) (pet.Pet, error) {
+	var (
+		p                           pet.Pet
+		createdAt, updatedAt, birth int64
+		gender                      string
+		colors, metas               sql.NullString
+		deletedAt                   sql.NullInt64
+	)
+
+	err := row.Scan(&p.Id, &createdAt, &updatedAt, &p.Deleted, &p.Version, &p.Name, &birth, &gender, &p.BreedName,
+		&colors, &p.Description, &p.Pedigree, &p.Microchip, &p.OwnerId, &p.VetId, &metas, &p.Avatar,
+		&deletedAt)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	p.CreatedAt = sqldb.ParseTime(createdAt)
+	p.UpdatedAt = sqldb.ParseTime(updatedAt)
+	p.DeletedAt = sqldb.ParseNullTime(deletedAt)
+	p.DateOfBirth = sqldb.ParseTime(birth)
+	p.Gender = pet.Gender(gender)
+
+	err = sqldb.ParseJSON(colors, &p.Colors)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	err = sqldb.ParseJSON(metas, &p.Metas)
+	if err != nil {
+		return pet.Nil, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,218 @@
+package recordrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mux     sync.RWMutex
+	records map[uuid.UUID]record.Record
+}
+
+// NewMemory returns a thread-safe Repository that keeps every record in memory.
+// It is meant for local development and tests where no database is available.
+func NewMemory() Repository {
+	return &memoryRepository{
+		records: make(map[uuid.UUID]record.Record),
+	}
+}
+
+func (r *memoryRepository) CreateRecord(ctx context.Context, rec record.Record) (record.Record, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return record.Nil, err
+	}
+	rec.Id = id
+
+	now := time.Now()
+	rec.CreatedAt = now
+	rec.UpdatedAt = now
+
+	rec.Deleted = false
+	rec.Version = 1
+
+	r.remember(ctx, rec.Id)
+	r.records[rec.Id] = rec
+
+	return rec, nil
+}
+
+func (r *memoryRepository) CreateRecords(ctx context.Context, recs []record.Record) ([]record.Record, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	groupId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i, rec := range recs {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return nil, err
+		}
+		rec.Id = id
+		rec.GroupId = groupId
+		rec.CreatedAt = now
+		rec.UpdatedAt = now
+
+		rec.Deleted = false
+		rec.Version = 1
+
+		recs[i] = rec
+	}
+
+	// insert only once every record is valid, like InsertMany does
+	for _, rec := range recs {
+		r.remember(ctx, rec.Id)
+		r.records[rec.Id] = rec
+	}
+
+	return recs, nil
+}
+
+func (r *memoryRepository) Record(ctx context.Context, id uuid.UUID) (record.Record, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	rec, ok := r.records[id]
+	if !ok {
+		return record.Nil, record.ErrNotFound
+	}
+
+	return rec, nil
+}
+
+func (r *memoryRepository) Records(ctx context.Context, includeDel bool) ([]record.Record, error) {
+	return r.QueryRecords(ctx, Query{IncludeDel: includeDel})
+}
+
+func (r *memoryRepository) QueryRecords(ctx context.Context, query Query) ([]record.Record, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	var records []record.Record
+	for _, rec := range r.records {
+		if query.matches(rec) {
+			records = append(records, rec)
+		}
+	}
+
+	// keep the insertion order the mongo repository returns
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	return records, nil
+}
+
+func (r *memoryRepository) UpdateRecord(ctx context.Context, rec record.Record) (record.Record, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.updateRecordInternal(ctx, rec)
+}
+
+func (r *memoryRepository) updateRecordInternal(ctx context.Context, rec record.Record) (record.Record, error) {
+	old, ok := r.records[rec.Id]
+	if !ok {
+		return record.Nil, record.ErrNotFound
+	}
+	if old.Version != rec.Version {
+		return record.Nil, record.ErrConflict
+	}
+
+	rec.UpdatedAt = time.Now()
+	rec.Version++
+	r.remember(ctx, rec.Id)
+	r.records[rec.Id] = rec
+
+	return rec, nil
+}
+
+func (r *memoryRepository) DeleteRecord(ctx context.Context, id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	rec, ok := r.records[id]
+	if !ok {
+		return record.ErrNotFound
+	}
+
+	rec.Deleted = true
+	rec.DeletedAt = time.Now()
+
+	_, err := r.updateRecordInternal(ctx, rec)
+
+	return err
+}
+
+func (r *memoryRepository) DeletePetsRecords(ctx context.Context, petIds []uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if len(petIds) == 0 {
+		return nil
+	}
+
+	query := Query{PetIds: petIds}
+	for _, rec := range r.records {
+		if !query.matches(rec) {
+			continue
+		}
+
+		rec.Deleted = true
+		rec.DeletedAt = time.Now()
+
+		_, err := r.updateRecordInternal(ctx, rec)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) PurgeRecords(ctx context.Context, query Query) (int64, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var n int64
+	for id, rec := range r.records {
+		if !query.matches(rec) {
+			continue
+		}
+
+		r.remember(ctx, id)
+		delete(r.records, id)
+		n++
+	}
+
+	return n, nil
+}
+
+// remember registers the current state of the record to be restored if the
+// transaction in ctx is rolled back. Callers must hold the lock.
+func (r *memoryRepository) remember(ctx context.Context, id uuid.UUID) {
+	old, ok := r.records[id]
+	transaction.OnRollback(ctx, func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if ok {
+			r.records[id] = old
+		} else {
+			delete(r.records, id)
+		}
+	})
+}
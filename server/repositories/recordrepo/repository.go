@@ -3,20 +3,22 @@ package recordrepo
 import (
 	"context"
 	"github.com/google/uuid"
+	"github.com/samber/lo"
 	"github.com/scarlettmiss/petJournal/application/domain/record"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"sync"
 	"time"
 )
 
 type RecordDBModel struct {
 	Id             uuid.UUID   `bson:"_id"`
-	CreatedAt      time.Time   `bson:"createdAt"`
-	UpdatedAt      time.Time   `bson:"updatedAt"`
+	CreatedAt      time.Time   `bson:"created_at"`
+	UpdatedAt      time.Time   `bson:"updated_at"`
 	Deleted        bool        `bson:"deleted"`
-	PetId          uuid.UUID   `bson:"petId"`
-	RecordType     record.Type `bson:"recordType"`
+	DeletedAt      time.Time   `bson:"deleted_at,omitempty"`
+	Version        int64       `bson:"version"`
+	PetId          uuid.UUID   `bson:"pet_id"`
+	RecordType     record.Type `bson:"record_type"`
 	Name           string      `bson:"name,omitempty"`
 	Date           time.Time   `bson:"date"`
 	Lot            string      `bson:"lot,omitempty"`
@@ -34,6 +36,8 @@ func ConvertToRecordDBModel(r record.Record) RecordDBModel {
 		CreatedAt:      r.CreatedAt,
 		UpdatedAt:      r.UpdatedAt,
 		Deleted:        r.Deleted,
+		DeletedAt:      r.DeletedAt,
+		Version:        r.Version,
 		PetId:          r.PetId,
 		RecordType:     r.RecordType,
 		Name:           r.Name,
@@ -54,6 +58,8 @@ func ConvertToRecordDomainModel(dbRecord RecordDBModel) record.Record {
 		CreatedAt:      dbRecord.CreatedAt,
 		UpdatedAt:      dbRecord.UpdatedAt,
 		Deleted:        dbRecord.Deleted,
+		DeletedAt:      dbRecord.DeletedAt,
+		Version:        dbRecord.Version,
 		PetId:          dbRecord.PetId,
 		RecordType:     dbRecord.RecordType,
 		Name:           dbRecord.Name,
@@ -68,17 +74,100 @@ func ConvertToRecordDomainModel(dbRecord RecordDBModel) record.Record {
 	}
 }
 
+// Query selects records. Zero-valued fields do not restrict the result.
+type Query struct {
+	// PetIds matches records of any of these pets
+	PetIds     []uuid.UUID
+	RecordType record.Type
+	// From is the inclusive lower bound of the record date
+	From time.Time
+	// To is the exclusive upper bound of the record date
+	To         time.Time
+	GroupId    uuid.UUID
+	IncludeDel bool
+	// DeletedBefore matches records deleted before this time. It needs
+	// IncludeDel to match anything.
+	DeletedBefore time.Time
+}
+
+func (q Query) filter() bson.M {
+	filter := bson.M{}
+
+	if len(q.PetIds) > 0 {
+		filter["pet_id"] = bson.M{"$in": q.PetIds}
+	}
+
+	if q.RecordType != "" {
+		filter["record_type"] = q.RecordType
+	}
+
+	date := bson.M{}
+	if !q.From.IsZero() {
+		date["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		date["$lt"] = q.To
+	}
+	if len(date) > 0 {
+		filter["date"] = date
+	}
+
+	if q.GroupId != uuid.Nil {
+		filter["group_id"] = q.GroupId
+	}
+
+	if !q.IncludeDel {
+		filter["deleted"] = false
+	}
+
+	if !q.DeletedBefore.IsZero() {
+		filter["deleted_at"] = bson.M{"$lt": q.DeletedBefore}
+	}
+
+	return filter
+}
+
+func (q Query) matches(rec record.Record) bool {
+	if len(q.PetIds) > 0 && !lo.Contains(q.PetIds, rec.PetId) {
+		return false
+	}
+
+	if q.RecordType != "" && rec.RecordType != q.RecordType {
+		return false
+	}
+
+	if !q.From.IsZero() && rec.Date.Before(q.From) {
+		return false
+	}
+
+	if !q.To.IsZero() && !rec.Date.Before(q.To) {
+		return false
+	}
+
+	if q.GroupId != uuid.Nil && rec.GroupId != q.GroupId {
+		return false
+	}
+
+	if !q.DeletedBefore.IsZero() && (rec.DeletedAt.IsZero() || !rec.DeletedAt.Before(q.DeletedBefore)) {
+		return false
+	}
+
+	return q.IncludeDel || !rec.Deleted
+}
+
 type Repository interface {
-	CreateRecord(record record.Record) (record.Record, error)
-	CreateRecords(records []record.Record) ([]record.Record, error)
-	Record(id uuid.UUID) (record.Record, error)
-	Records(includeDel bool) ([]record.Record, error)
-	UpdateRecord(record record.Record) (record.Record, error)
-	DeleteRecord(id uuid.UUID) error
+	CreateRecord(ctx context.Context, record record.Record) (record.Record, error)
+	CreateRecords(ctx context.Context, records []record.Record) ([]record.Record, error)
+	Record(ctx context.Context, id uuid.UUID) (record.Record, error)
+	Records(ctx context.Context, includeDel bool) ([]record.Record, error)
+	QueryRecords(ctx context.Context, query Query) ([]record.Record, error)
+	UpdateRecord(ctx context.Context, record record.Record) (record.Record, error)
+	DeleteRecord(ctx context.Context, id uuid.UUID) error
+	DeletePetsRecords(ctx context.Context, petIds []uuid.UUID) error
+	PurgeRecords(ctx context.Context, query Query) (int64, error)
 }
 
 type repository struct {
-	mux        sync.Mutex
 	recordsCol *mongo.Collection
 }
 
@@ -88,9 +177,7 @@ func New(collection *mongo.Collection) Repository {
 	}
 }
 
-func (r *repository) CreateRecord(rec record.Record) (record.Record, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
+func (r *repository) CreateRecord(ctx context.Context, rec record.Record) (record.Record, error) {
 	id, err := uuid.NewRandom()
 	if err != nil {
 		return record.Nil, err
@@ -102,13 +189,14 @@ func (r *repository) CreateRecord(rec record.Record) (record.Record, error) {
 	rec.UpdatedAt = now
 
 	rec.Deleted = false
+	rec.Version = 1
 
 	dbRec, err := bson.Marshal(ConvertToRecordDBModel(rec))
 	if err != nil {
 		return record.Nil, err
 	}
 
-	_, err = r.recordsCol.InsertOne(context.Background(), dbRec)
+	_, err = r.recordsCol.InsertOne(ctx, dbRec)
 	if err != nil {
 		return record.Nil, err
 	}
@@ -116,10 +204,7 @@ func (r *repository) CreateRecord(rec record.Record) (record.Record, error) {
 	return rec, nil
 }
 
-func (r *repository) CreateRecords(recs []record.Record) ([]record.Record, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
+func (r *repository) CreateRecords(ctx context.Context, recs []record.Record) ([]record.Record, error) {
 	groupId, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -139,6 +224,7 @@ func (r *repository) CreateRecords(recs []record.Record) ([]record.Record, error
 		rec.UpdatedAt = now
 
 		rec.Deleted = false
+		rec.Version = 1
 
 		var dbRec []byte
 		dbRec, err = bson.Marshal(ConvertToRecordDBModel(rec))
@@ -154,7 +240,7 @@ func (r *repository) CreateRecords(recs []record.Record) ([]record.Record, error
 		return nil, err
 	}
 
-	_, err = r.recordsCol.InsertMany(context.Background(), dbItems)
+	_, err = r.recordsCol.InsertMany(ctx, dbItems)
 	if err != nil {
 		return nil, err
 	}
@@ -162,54 +248,49 @@ func (r *repository) CreateRecords(recs []record.Record) ([]record.Record, error
 	return recs, nil
 }
 
-func (r *repository) Record(id uuid.UUID) (record.Record, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
-	retrievedRecord, err := r.recordInternal(id)
+func (r *repository) Record(ctx context.Context, id uuid.UUID) (record.Record, error) {
+	retrievedRecord, err := r.recordInternal(ctx, id)
 
 	return ConvertToRecordDomainModel(retrievedRecord), err
 
 }
 
-func (r *repository) recordInternal(id uuid.UUID) (RecordDBModel, error) {
+func (r *repository) recordInternal(ctx context.Context, id uuid.UUID) (RecordDBModel, error) {
 	var retrievedRecord RecordDBModel
 
 	filter := bson.M{"_id": id}
 
-	err := r.recordsCol.FindOne(context.Background(), filter).Decode(&retrievedRecord)
-	if err != nil {
+	err := r.recordsCol.FindOne(ctx, filter).Decode(&retrievedRecord)
+	if err == mongo.ErrNoDocuments {
 		return RecordDBModel{}, record.ErrNotFound
 	}
+	if err != nil {
+		return RecordDBModel{}, err
+	}
 
 	return retrievedRecord, nil
 
 }
 
-func (r *repository) Records(includeDel bool) ([]record.Record, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
-	var records []record.Record
+func (r *repository) Records(ctx context.Context, includeDel bool) ([]record.Record, error) {
+	return r.recordsInternal(ctx, Query{IncludeDel: includeDel})
+}
 
-	var filter bson.M
+func (r *repository) QueryRecords(ctx context.Context, query Query) ([]record.Record, error) {
+	return r.recordsInternal(ctx, query)
+}
 
-	if includeDel {
-		// Define an empty filter to retrieve all users
-		filter = bson.M{}
-	} else {
-		filter = bson.M{"deleted": false}
-	}
+func (r *repository) recordsInternal(ctx context.Context, query Query) ([]record.Record, error) {
+	var records []record.Record
 
-	ctx := context.Background()
 	// Perform the find operation
-	cursor, err := r.recordsCol.Find(ctx, filter)
+	cursor, err := r.recordsCol.Find(ctx, query.filter())
 	if err != nil {
 		return records, err
 	}
 	defer cursor.Close(ctx)
 
-	// Iterate over the cursor and decode the users
+	// Iterate over the cursor and decode the records
 	for cursor.Next(ctx) {
 		var u RecordDBModel
 		err = cursor.Decode(&u)
@@ -230,11 +311,8 @@ func (r *repository) Records(includeDel bool) ([]record.Record, error) {
 	return records, nil
 }
 
-func (r *repository) UpdateRecord(rec record.Record) (record.Record, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
-	updatedRec, err := r.updateRecordInternal(ConvertToRecordDBModel(rec))
+func (r *repository) UpdateRecord(ctx context.Context, rec record.Record) (record.Record, error) {
+	updatedRec, err := r.updateRecordInternal(ctx, ConvertToRecordDBModel(rec))
 	if err != nil {
 		return record.Nil, err
 	}
@@ -242,39 +320,80 @@ func (r *repository) UpdateRecord(rec record.Record) (record.Record, error) {
 	return ConvertToRecordDomainModel(updatedRec), nil
 }
 
-func (r *repository) updateRecordInternal(rec RecordDBModel) (RecordDBModel, error) {
-	// Define the filter to identify the document to update
-	filter := bson.M{"_id": rec.Id}
+func (r *repository) updateRecordInternal(ctx context.Context, rec RecordDBModel) (RecordDBModel, error) {
+	// Only replace the document if it was not updated since it was read.
+	// Documents written before versioning have no version field.
+	filter := bson.M{"_id": rec.Id, "version": rec.Version}
+	if rec.Version == 0 {
+		filter["version"] = bson.M{"$exists": false}
+	}
 
 	rec.UpdatedAt = time.Now()
+	rec.Version++
 
-	// Define the update document using the '$set' operator
 	replacement, err := bson.Marshal(rec)
 	if err != nil {
 		return RecordDBModel{}, err
 	}
 
-	// Perform the update operation
-	_, err = r.recordsCol.ReplaceOne(context.Background(), filter, replacement)
+	res, err := r.recordsCol.ReplaceOne(ctx, filter, replacement)
 	if err != nil {
 		return RecordDBModel{}, err
 	}
 
+	if res.MatchedCount == 0 {
+		// tell a missing record apart from a stale one
+		_, err = r.recordInternal(ctx, rec.Id)
+		if err != nil {
+			return RecordDBModel{}, err
+		}
+		return RecordDBModel{}, record.ErrConflict
+	}
+
 	return rec, nil
 }
 
-func (r *repository) DeleteRecord(id uuid.UUID) error {
-	r.mux.Lock()
-	defer r.mux.Unlock()
+func (r *repository) DeleteRecord(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{"deleted": true, "deleted_at": now, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}
 
-	retrievedRecord, err := r.recordInternal(id)
+	res, err := r.recordsCol.UpdateOne(ctx, bson.M{"_id": id}, update)
 	if err != nil {
 		return err
 	}
 
-	retrievedRecord.Deleted = true
+	if res.MatchedCount == 0 {
+		return record.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) DeletePetsRecords(ctx context.Context, petIds []uuid.UUID) error {
+	if len(petIds) == 0 {
+		return nil
+	}
+
+	filter := Query{PetIds: petIds}.filter()
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{"deleted": true, "deleted_at": now, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}
 
-	_, err = r.updateRecordInternal(retrievedRecord)
+	_, err := r.recordsCol.UpdateMany(ctx, filter, update)
 
 	return err
 }
+
+func (r *repository) PurgeRecords(ctx context.Context, query Query) (int64, error) {
+	res, err := r.recordsCol.DeleteMany(ctx, query.filter())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
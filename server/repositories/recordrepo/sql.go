@@ -0,0 +1,322 @@
+package recordrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/record"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"strings"
+	"time"
+)
+
+var recordColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"created_at INTEGER NOT NULL",
+	"updated_at INTEGER NOT NULL",
+	"deleted INTEGER NOT NULL DEFAULT 0",
+	"version INTEGER NOT NULL DEFAULT 0",
+	"pet_id TEXT NOT NULL",
+	"record_type TEXT NOT NULL",
+	"name TEXT NOT NULL DEFAULT ''",
+	"date INTEGER NOT NULL",
+	"lot TEXT NOT NULL DEFAULT ''",
+	"result TEXT NOT NULL DEFAULT ''",
+	"description TEXT NOT NULL DEFAULT ''",
+	"notes TEXT NOT NULL DEFAULT ''",
+	"administered_by TEXT NOT NULL",
+	"verified_by TEXT NOT NULL",
+	"group_id TEXT NOT NULL",
+	"deleted_at INTEGER",
+}
+
+const recordSelect = `SELECT id, created_at, updated_at, deleted, version, pet_id, record_type, name, date, lot,
+	result, description, notes, administered_by, verified_by, group_id, deleted_at
+	FROM records`
+
+const recordInsert = `INSERT INTO records (id, created_at, updated_at, deleted, version, pet_id, record_type, name, date,
+	lot, result, description, notes, administered_by, verified_by, group_id, deleted_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Repository that stores records in the records table of db,
+// creating the table if needed.
+func NewSQL(db *sql.DB) (Repository, error) {
+	err := sqldb.EnsureTable(db, "records", recordColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "records", "pet_id", "date")
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "records", "date")
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "records", "group_id")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRepository{db: db}, nil
+}
+
+// conn returns the transaction in ctx, if any, or the database
+func (r *sqlRepository) conn(ctx context.Context) sqldb.Querier {
+	return sqldb.Conn(ctx, r.db)
+}
+
+func (r *sqlRepository) CreateRecord(ctx context.Context, rec record.Record) (record.Record, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return record.Nil, err
+	}
+	rec.Id = id
+
+	now := time.Now()
+	rec.CreatedAt = now
+	rec.UpdatedAt = now
+
+	rec.Deleted = false
+	rec.Version = 1
+
+	_, err = r.conn(ctx).ExecContext(ctx, recordInsert, recordArgs(rec)...)
+	if err != nil {
+		return record.Nil, err
+	}
+
+	return rec, nil
+}
+
+func (r *sqlRepository) CreateRecords(ctx context.Context, recs []record.Record) ([]record.Record, error) {
+	groupId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.WithTx(ctx, r.db, func(ctx context.Context) error {
+		now := time.Now()
+		for i, rec := range recs {
+			id, err := uuid.NewRandom()
+			if err != nil {
+				return err
+			}
+			rec.Id = id
+			rec.GroupId = groupId
+			rec.CreatedAt = now
+			rec.UpdatedAt = now
+
+			rec.Deleted = false
+			rec.Version = 1
+
+			_, err = r.conn(ctx).ExecContext(ctx, recordInsert, recordArgs(rec)...)
+			if err != nil {
+				return err
+			}
+			recs[i] = rec
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recs, nil
+}
+
+func (r *sqlRepository) Record(ctx context.Context, id uuid.UUID) (record.Record, error) {
+	rec, err := scanRecord(r.conn(ctx).QueryRowContext(ctx, recordSelect+" WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return record.Nil, record.ErrNotFound
+	}
+
+	return rec, err
+}
+
+func (r *sqlRepository) Records(ctx context.Context, includeDel bool) ([]record.Record, error) {
+	return r.QueryRecords(ctx, Query{IncludeDel: includeDel})
+}
+
+func (r *sqlRepository) QueryRecords(ctx context.Context, query Query) ([]record.Record, error) {
+	where, args := query.where()
+
+	rows, err := r.conn(ctx).QueryContext(ctx, recordSelect+where+" ORDER BY created_at", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []record.Record
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return records, err
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, rows.Err()
+}
+
+func (r *sqlRepository) UpdateRecord(ctx context.Context, rec record.Record) (record.Record, error) {
+	rec.UpdatedAt = time.Now()
+
+	// only update the row if it was not updated since it was read
+	res, err := r.conn(ctx).ExecContext(ctx, `UPDATE records SET created_at = ?, updated_at = ?, deleted = ?, version = ? + 1,
+		pet_id = ?, record_type = ?, name = ?, date = ?, lot = ?, result = ?, description = ?, notes = ?,
+		administered_by = ?, verified_by = ?, group_id = ?, deleted_at = ? WHERE id = ? AND version = ?`,
+		append(recordArgs(rec)[1:], rec.Id, rec.Version)...)
+	if err != nil {
+		return record.Nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return record.Nil, err
+	}
+	if n == 0 {
+		// tell a missing record apart from a stale one
+		_, err = r.Record(ctx, rec.Id)
+		if err != nil {
+			return record.Nil, err
+		}
+		return record.Nil, record.ErrConflict
+	}
+	rec.Version++
+
+	return rec, nil
+}
+
+func (r *sqlRepository) DeleteRecord(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	res, err := r.conn(ctx).ExecContext(ctx, `UPDATE records SET deleted = 1, deleted_at = ?, version = version + 1,
+		updated_at = ? WHERE id = ?`, sqldb.Time(now), sqldb.Time(now), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return record.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) DeletePetsRecords(ctx context.Context, petIds []uuid.UUID) error {
+	if len(petIds) == 0 {
+		return nil
+	}
+
+	where, args := Query{PetIds: petIds}.where()
+
+	now := time.Now()
+	_, err := r.conn(ctx).ExecContext(ctx,
+		"UPDATE records SET deleted = 1, deleted_at = ?, version = version + 1, updated_at = ?"+where,
+		append([]any{sqldb.Time(now), sqldb.Time(now)}, args...)...)
+
+	return err
+}
+
+func (r *sqlRepository) PurgeRecords(ctx context.Context, query Query) (int64, error) {
+	where, args := query.where()
+
+	res, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM records"+where, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// where returns the WHERE clause of the query and its bind parameters
+func (q Query) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	if len(q.PetIds) > 0 {
+		conditions = append(conditions, "pet_id IN ("+sqldb.Placeholders(len(q.PetIds))+")")
+		for _, id := range q.PetIds {
+			args = append(args, id)
+		}
+	}
+
+	if q.RecordType != "" {
+		conditions = append(conditions, "record_type = ?")
+		args = append(args, string(q.RecordType))
+	}
+
+	if !q.From.IsZero() {
+		conditions = append(conditions, "date >= ?")
+		args = append(args, sqldb.Time(q.From))
+	}
+
+	if !q.To.IsZero() {
+		conditions = append(conditions, "date < ?")
+		args = append(args, sqldb.Time(q.To))
+	}
+
+	if q.GroupId != uuid.Nil {
+		conditions = append(conditions, "group_id = ?")
+		args = append(args, q.GroupId)
+	}
+
+	if !q.IncludeDel {
+		conditions = append(conditions, "deleted = 0")
+	}
+
+	if !q.DeletedBefore.IsZero() {
+		conditions = append(conditions, "deleted_at < ?")
+		args = append(args, sqldb.Time(q.DeletedBefore))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// recordArgs returns the column values of rec in recordInsert order
+func recordArgs(rec record.Record) []any {
+	return []any{
+		rec.Id, sqldb.Time(rec.CreatedAt), sqldb.Time(rec.UpdatedAt), rec.Deleted, rec.Version, rec.PetId,
+		string(rec.RecordType), rec.Name, sqldb.Time(rec.Date), rec.Lot, rec.Result, rec.Description, rec.Notes, rec.AdministeredBy,
+		rec.VerifiedBy, rec.GroupId, sqldb.NullTime(rec.DeletedAt),
+	}
+}
+
+func scanRecord(row sqldb.Scanner) (record.Record, error) {
+	var (
+		rec                        record.Record
+		createdAt, updatedAt, date int64
+		recordType                 string
+		deletedAt                  sql.NullInt64
+	)
+
+	err := row.Scan(&rec.Id, &createdAt, &updatedAt, &rec.Deleted, &rec.Version, &rec.PetId, &recordType, &rec.Name,
+		&date, &rec.Lot, &rec.Result, &rec.Description, &rec.Notes, &rec.AdministeredBy, &rec.VerifiedBy, &rec.GroupId,
+		&deletedAt)
+	if err != nil {
+		return record.Nil, err
+	}
+
+	rec.CreatedAt = sqldb.ParseTime(createdAt)
+	rec.UpdatedAt = sqldb.ParseTime(updatedAt)
+	rec.DeletedAt = sqldb.ParseNullTime(deletedAt)
+	rec.Date = sqldb.ParseTime(date)
+	rec.RecordType = record.Type(recordType)
+
+	return rec, nil
+}
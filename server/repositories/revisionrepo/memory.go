@@ -0,0 +1,95 @@
+package revisionrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/scarlettmiss/petJournal/application/domain/revision"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mux       sync.RWMutex
+	revisions map[uuid.UUID]revision.Revision
+}
+
+// NewMemory returns a thread-safe Repository that keeps every revision in
+// memory. It is meant for local development and tests where no database is
+// available.
+func NewMemory() Repository {
+	return &memoryRepository{
+		revisions: make(map[uuid.UUID]revision.Revision),
+	}
+}
+
+func (r *memoryRepository) CreateRevision(ctx context.Context, rev revision.Revision) (revision.Revision, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return revision.Nil, err
+	}
+	rev.Id = id
+	rev.CreatedAt = time.Now()
+	rev.Changes = append([]revision.Change(nil), rev.Changes...)
+
+	r.remember(ctx, rev.Id)
+	r.revisions[rev.Id] = rev
+
+	return rev, nil
+}
+
+func (r *memoryRepository) RecordRevisions(ctx context.Context, recordId uuid.UUID) ([]revision.Revision, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	var revisions []revision.Revision
+	for _, rev := range r.revisions {
+		if rev.RecordId == recordId {
+			rev.Changes = append([]revision.Change(nil), rev.Changes...)
+			revisions = append(revisions, rev)
+		}
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Version < revisions[j].Version
+	})
+
+	return revisions, nil
+}
+
+func (r *memoryRepository) PurgeRecordsRevisions(ctx context.Context, recordIds []uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for id, rev := range r.revisions {
+		if !lo.Contains(recordIds, rev.RecordId) {
+			continue
+		}
+
+		r.remember(ctx, id)
+		delete(r.revisions, id)
+	}
+
+	return nil
+}
+
+// remember registers the current state of the revision to be restored if the
+// transaction in ctx is rolled back. Callers must hold the lock.
+func (r *memoryRepository) remember(ctx context.Context, id uuid.UUID) {
+	old, ok := r.revisions[id]
+	transaction.OnRollback(ctx, func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if ok {
+			r.revisions[id] = old
+		} else {
+			delete(r.revisions, id)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package revisionrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/revision"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type RevisionDBModel struct {
+	Id        uuid.UUID       `bson:"_id"`
+	CreatedAt time.Time       `bson:"created_at"`
+	RecordId  uuid.UUID       `bson:"record_id"`
+	PetId     uuid.UUID       `bson:"pet_id"`
+	Version   int64           `bson:"version"`
+	UserId    uuid.UUID       `bson:"user_id"`
+	Changes   []ChangeDBModel `bson:"changes"`
+}
+
+type ChangeDBModel struct {
+	Field string `bson:"field"`
+	Old   string `bson:"old,omitempty"`
+	New   string `bson:"new,omitempty"`
+}
+
+func ConvertToRevisionDBModel(r revision.Revision) RevisionDBModel {
+	changes := make([]ChangeDBModel, len(r.Changes))
+	for i, c := range r.Changes {
+		changes[i] = ChangeDBModel{Field: c.Field, Old: c.Old, New: c.New}
+	}
+
+	return RevisionDBModel{
+		Id:        r.Id,
+		CreatedAt: r.CreatedAt,
+		RecordId:  r.RecordId,
+		PetId:     r.PetId,
+		Version:   r.Version,
+		UserId:    r.UserId,
+		Changes:   changes,
+	}
+}
+
+func ConvertToRevisionDomainModel(dbRevision RevisionDBModel) revision.Revision {
+	changes := make([]revision.Change, len(dbRevision.Changes))
+	for i, c := range dbRevision.Changes {
+		changes[i] = revision.Change{Field: c.Field, Old: c.Old, New: c.New}
+	}
+
+	return revision.Revision{
+		Id:        dbRevision.Id,
+		CreatedAt: dbRevision.CreatedAt,
+		RecordId:  dbRevision.RecordId,
+		PetId:     dbRevision.PetId,
+		Version:   dbRevision.Version,
+		UserId:    dbRevision.UserId,
+		Changes:   changes,
+	}
+}
+
+type Repository interface {
+	CreateRevision(ctx context.Context, r revision.Revision) (revision.Revision, error)
+	RecordRevisions(ctx context.Context, recordId uuid.UUID) ([]revision.Revision, error)
+	PurgeRecordsRevisions(ctx context.Context, recordIds []uuid.UUID) error
+}
+
+type repository struct {
+	revisions *mongo.Collection
+}
+
+func New(collection *mongo.Collection) Repository {
+	return &repository{
+		revisions: collection,
+	}
+}
+
+func (r *repository) CreateRevision(ctx context.Context, rev revision.Revision) (revision.Revision, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return revision.Nil, err
+	}
+	rev.Id = id
+	rev.CreatedAt = time.Now()
+
+	dbRev, err := bson.Marshal(ConvertToRevisionDBModel(rev))
+	if err != nil {
+		return revision.Nil, err
+	}
+
+	_, err = r.revisions.InsertOne(ctx, dbRev)
+	if err != nil {
+		return revision.Nil, err
+	}
+
+	return rev, nil
+}
+
+func (r *repository) RecordRevisions(ctx context.Context, recordId uuid.UUID) ([]revision.Revision, error) {
+	var revisions []revision.Revision
+
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+	cursor, err := r.revisions.Find(ctx, bson.M{"record_id": recordId}, opts)
+	if err != nil {
+		return revisions, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var rev RevisionDBModel
+		err = cursor.Decode(&rev)
+		if err != nil {
+			return revisions, err
+		}
+
+		revisions = append(revisions, ConvertToRevisionDomainModel(rev))
+	}
+
+	return revisions, cursor.Err()
+}
+
+func (r *repository) PurgeRecordsRevisions(ctx context.Context, recordIds []uuid.UUID) error {
+	if len(recordIds) == 0 {
+		return nil
+	}
+
+	_, err := r.revisions.DeleteMany(ctx, bson.M{"record_id": bson.M{"$in": recordIds}})
+
+	return err
+}
@@ -0,0 +1,118 @@
+package revisionrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/revision"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"time"
+)
+
+var revisionColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"created_at INTEGER NOT NULL",
+	"record_id TEXT NOT NULL",
+	"pet_id TEXT NOT NULL",
+	"version INTEGER NOT NULL",
+	"user_id TEXT NOT NULL",
+	"changes TEXT",
+}
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Repository that stores revisions in the record_revisions
+// table of db, creating the table if needed.
+func NewSQL(db *sql.DB) (Repository, error) {
+	err := sqldb.EnsureTable(db, "record_revisions", revisionColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "record_revisions", "record_id")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRepository{db: db}, nil
+}
+
+// conn returns the transaction in ctx, if any, or the database
+func (r *sqlRepository) conn(ctx context.Context) sqldb.Querier {
+	return sqldb.Conn(ctx, r.db)
+}
+
+func (r *sqlRepository) CreateRevision(ctx context.Context, rev revision.Revision) (revision.Revision, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return revision.Nil, err
+	}
+	rev.Id = id
+	rev.CreatedAt = time.Now()
+
+	changes, err := sqldb.JSON(rev.Changes)
+	if err != nil {
+		return revision.Nil, err
+	}
+
+	_, err = r.conn(ctx).ExecContext(ctx, `INSERT INTO record_revisions (id, created_at, record_id, pet_id, version,
+		user_id, changes) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rev.Id, sqldb.Time(rev.CreatedAt), rev.RecordId, rev.PetId, rev.Version, rev.UserId, changes)
+	if err != nil {
+		return revision.Nil, err
+	}
+
+	return rev, nil
+}
+
+func (r *sqlRepository) RecordRevisions(ctx context.Context, recordId uuid.UUID) ([]revision.Revision, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT id, created_at, record_id, pet_id, version, user_id, changes
+		FROM record_revisions WHERE record_id = ? ORDER BY version`, recordId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []revision.Revision
+	for rows.Next() {
+		var (
+			rev       revision.Revision
+			createdAt int64
+			changes   sql.NullString
+		)
+
+		err = rows.Scan(&rev.Id, &createdAt, &rev.RecordId, &rev.PetId, &rev.Version, &rev.UserId, &changes)
+		if err != nil {
+			return revisions, err
+		}
+
+		rev.CreatedAt = sqldb.ParseTime(createdAt)
+
+		err = sqldb.ParseJSON(changes, &rev.Changes)
+		if err != nil {
+			return revisions, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (r *sqlRepository) PurgeRecordsRevisions(ctx context.Context, recordIds []uuid.UUID) error {
+	if len(recordIds) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(recordIds))
+	for i, id := range recordIds {
+		args[i] = id
+	}
+
+	_, err := r.conn(ctx).ExecContext(ctx,
+		"DELETE FROM record_revisions WHERE record_id IN ("+sqldb.Placeholders(len(recordIds))+")", args...)
+
+	return err
+}
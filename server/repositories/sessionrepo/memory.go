@@ -0,0 +1,139 @@
+package sessionrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/scarlettmiss/petJournal/application/domain/session"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mux      sync.RWMutex
+	sessions map[uuid.UUID]session.Session
+}
+
+// NewMemory returns a thread-safe Repository that keeps every session in
+// memory. It is meant for local development and tests where no database is
+// available.
+func NewMemory() Repository {
+	return &memoryRepository{
+		sessions: make(map[uuid.UUID]session.Session),
+	}
+}
+
+func (r *memoryRepository) CreateSession(ctx context.Context, s session.Session) (session.Session, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return session.Nil, err
+	}
+	s.Id = id
+
+	now := time.Now()
+	s.CreatedAt = now
+	s.LastSeenAt = now
+
+	r.remember(ctx, s.Id)
+	r.sessions[s.Id] = s
+
+	return s, nil
+}
+
+func (r *memoryRepository) Session(ctx context.Context, id uuid.UUID) (session.Session, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return session.Nil, session.ErrNotFound
+	}
+
+	return s, nil
+}
+
+func (r *memoryRepository) UserSessions(ctx context.Context, userId uuid.UUID, since time.Time) ([]session.Session, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	var sessions []session.Session
+	for _, s := range r.sessions {
+		if s.UserId == userId && s.RevokedAt.IsZero() && !s.LastSeenAt.Before(since) {
+			sessions = append(sessions, s)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+func (r *memoryRepository) TouchSession(ctx context.Context, id uuid.UUID, at time.Time) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok || !at.After(s.LastSeenAt) {
+		return nil
+	}
+
+	s.LastSeenAt = at
+	r.remember(ctx, id)
+	r.sessions[id] = s
+
+	return nil
+}
+
+func (r *memoryRepository) RevokeSession(ctx context.Context, id uuid.UUID, at time.Time) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok || !s.RevokedAt.IsZero() {
+		return nil
+	}
+
+	s.RevokedAt = at
+	r.remember(ctx, id)
+	r.sessions[id] = s
+
+	return nil
+}
+
+func (r *memoryRepository) PurgeSessions(ctx context.Context, userIds []uuid.UUID, before time.Time) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for id, s := range r.sessions {
+		revoked := !s.RevokedAt.IsZero() && s.RevokedAt.Before(before)
+		if lo.Contains(userIds, s.UserId) || revoked || s.LastSeenAt.Before(before) {
+			r.remember(ctx, id)
+			delete(r.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+// remember registers the current state of the session to be restored if the
+// transaction in ctx is rolled back. Callers must hold the lock.
+func (r *memoryRepository) remember(ctx context.Context, id uuid.UUID) {
+	old, ok := r.sessions[id]
+	transaction.OnRollback(ctx, func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if ok {
+			r.sessions[id] = old
+		} else {
+			delete(r.sessions, id)
+		}
+	})
+}
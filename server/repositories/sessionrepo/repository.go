@@ -0,0 +1,161 @@
+package sessionrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/session"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type SessionDBModel struct {
+	Id         uuid.UUID `bson:"_id"`
+	CreatedAt  time.Time `bson:"created_at"`
+	UserId     uuid.UUID `bson:"user_id"`
+	UserAgent  string    `bson:"user_agent,omitempty"`
+	IP         string    `bson:"ip,omitempty"`
+	LastSeenAt time.Time `bson:"last_seen_at"`
+	RevokedAt  time.Time `bson:"revoked_at,omitempty"`
+}
+
+func ConvertToSessionDBModel(s session.Session) SessionDBModel {
+	return SessionDBModel{
+		Id:         s.Id,
+		CreatedAt:  s.CreatedAt,
+		UserId:     s.UserId,
+		UserAgent:  s.UserAgent,
+		IP:         s.IP,
+		LastSeenAt: s.LastSeenAt,
+		RevokedAt:  s.RevokedAt,
+	}
+}
+
+func ConvertToSessionDomainModel(dbSession SessionDBModel) session.Session {
+	return session.Session{
+		Id:         dbSession.Id,
+		CreatedAt:  dbSession.CreatedAt,
+		UserId:     dbSession.UserId,
+		UserAgent:  dbSession.UserAgent,
+		IP:         dbSession.IP,
+		LastSeenAt: dbSession.LastSeenAt,
+		RevokedAt:  dbSession.RevokedAt,
+	}
+}
+
+type Repository interface {
+	CreateSession(ctx context.Context, s session.Session) (session.Session, error)
+	Session(ctx context.Context, id uuid.UUID) (session.Session, error)
+	// UserSessions returns the sessions of the user that were not revoked and
+	// were last seen at or after since, oldest first
+	UserSessions(ctx context.Context, userId uuid.UUID, since time.Time) ([]session.Session, error)
+	TouchSession(ctx context.Context, id uuid.UUID, at time.Time) error
+	RevokeSession(ctx context.Context, id uuid.UUID, at time.Time) error
+	// PurgeSessions deletes the sessions of the users and the sessions that
+	// were revoked or last seen before the given time
+	PurgeSessions(ctx context.Context, userIds []uuid.UUID, before time.Time) error
+}
+
+type repository struct {
+	sessions *mongo.Collection
+}
+
+func New(collection *mongo.Collection) Repository {
+	return &repository{
+		sessions: collection,
+	}
+}
+
+func (r *repository) CreateSession(ctx context.Context, s session.Session) (session.Session, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return session.Nil, err
+	}
+	s.Id = id
+
+	now := time.Now()
+	s.CreatedAt = now
+	s.LastSeenAt = now
+
+	dbSession, err := bson.Marshal(ConvertToSessionDBModel(s))
+	if err != nil {
+		return session.Nil, err
+	}
+
+	_, err = r.sessions.InsertOne(ctx, dbSession)
+	if err != nil {
+		return session.Nil, err
+	}
+
+	return s, nil
+}
+
+func (r *repository) Session(ctx context.Context, id uuid.UUID) (session.Session, error) {
+	var s SessionDBModel
+
+	err := r.sessions.FindOne(ctx, bson.M{"_id": id}).Decode(&s)
+	if err == mongo.ErrNoDocuments {
+		return session.Nil, session.ErrNotFound
+	}
+	if err != nil {
+		return session.Nil, err
+	}
+
+	return ConvertToSessionDomainModel(s), nil
+}
+
+func (r *repository) UserSessions(ctx context.Context, userId uuid.UUID, since time.Time) ([]session.Session, error) {
+	var sessions []session.Session
+
+	filter := bson.M{
+		"user_id":      userId,
+		"revoked_at":   bson.M{"$exists": false},
+		"last_seen_at": bson.M{"$gte": since},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.sessions.Find(ctx, filter, opts)
+	if err != nil {
+		return sessions, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var s SessionDBModel
+		err = cursor.Decode(&s)
+		if err != nil {
+			return sessions, err
+		}
+
+		sessions = append(sessions, ConvertToSessionDomainModel(s))
+	}
+
+	return sessions, cursor.Err()
+}
+
+func (r *repository) TouchSession(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.sessions.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$max": bson.M{"last_seen_at": at}})
+
+	return err
+}
+
+func (r *repository) RevokeSession(ctx context.Context, id uuid.UUID, at time.Time) error {
+	filter := bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}}
+
+	_, err := r.sessions.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": at}})
+
+	return err
+}
+
+func (r *repository) PurgeSessions(ctx context.Context, userIds []uuid.UUID, before time.Time) error {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"user_id": bson.M{"$in": userIds}},
+		bson.M{"revoked_at": bson.M{"$lt": before}},
+		bson.M{"last_seen_at": bson.M{"$lt": before}},
+	}}
+
+	_, err := r.sessions.DeleteMany(ctx, filter)
+
+	return err
+}
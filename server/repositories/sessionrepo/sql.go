@@ -0,0 +1,147 @@
+package sessionrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/session"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"time"
+)
+
+var sessionColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"created_at INTEGER NOT NULL",
+	"user_id TEXT NOT NULL",
+	"user_agent TEXT NOT NULL DEFAULT ''",
+	"ip TEXT NOT NULL DEFAULT ''",
+	"last_seen_at INTEGER NOT NULL",
+	"revoked_at INTEGER",
+}
+
+const sessionSelect = `SELECT id, created_at, user_id, user_agent, ip, last_seen_at, revoked_at FROM sessions`
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Repository that stores sessions in the sessions table of
+// db, creating the table if needed.
+func NewSQL(db *sql.DB) (Repository, error) {
+	err := sqldb.EnsureTable(db, "sessions", sessionColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "sessions", "user_id")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRepository{db: db}, nil
+}
+
+// conn returns the transaction in ctx, if any, or the database
+func (r *sqlRepository) conn(ctx context.Context) sqldb.Querier {
+	return sqldb.Conn(ctx, r.db)
+}
+
+func (r *sqlRepository) CreateSession(ctx context.Context, s session.Session) (session.Session, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return session.Nil, err
+	}
+	s.Id = id
+
+	now := time.Now()
+	s.CreatedAt = now
+	s.LastSeenAt = now
+
+	_, err = r.conn(ctx).ExecContext(ctx, `INSERT INTO sessions (id, created_at, user_id, user_agent, ip,
+		last_seen_at, revoked_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		s.Id, sqldb.Time(s.CreatedAt), s.UserId, s.UserAgent, s.IP, sqldb.Time(s.LastSeenAt),
+		sqldb.NullTime(s.RevokedAt))
+	if err != nil {
+		return session.Nil, err
+	}
+
+	return s, nil
+}
+
+func (r *sqlRepository) Session(ctx context.Context, id uuid.UUID) (session.Session, error) {
+	s, err := scanSession(r.conn(ctx).QueryRowContext(ctx, sessionSelect+" WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return session.Nil, session.ErrNotFound
+	}
+
+	return s, err
+}
+
+func (r *sqlRepository) UserSessions(ctx context.Context, userId uuid.UUID, since time.Time) ([]session.Session, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, sessionSelect+` WHERE user_id = ? AND revoked_at IS NULL
+		AND last_seen_at >= ? ORDER BY created_at`, userId, sqldb.Time(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []session.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return sessions, err
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (r *sqlRepository) TouchSession(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.conn(ctx).ExecContext(ctx, "UPDATE sessions SET last_seen_at = ? WHERE id = ? AND last_seen_at < ?",
+		sqldb.Time(at), id, sqldb.Time(at))
+
+	return err
+}
+
+func (r *sqlRepository) RevokeSession(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.conn(ctx).ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		sqldb.Time(at), id)
+
+	return err
+}
+
+func (r *sqlRepository) PurgeSessions(ctx context.Context, userIds []uuid.UUID, before time.Time) error {
+	args := []any{sqldb.Time(before), sqldb.Time(before)}
+	query := "DELETE FROM sessions WHERE revoked_at < ? OR last_seen_at < ?"
+	if len(userIds) > 0 {
+		for _, id := range userIds {
+			args = append(args, id)
+		}
+		query += " OR user_id IN (" + sqldb.Placeholders(len(userIds)) + ")"
+	}
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, args...)
+
+	return err
+}
+
+func scanSession(row sqldb.Scanner) (session.Session, error) {
+	var (
+		s                     session.Session
+		createdAt, lastSeenAt int64
+		revokedAt             sql.NullInt64
+	)
+
+	err := row.Scan(&s.Id, &createdAt, &s.UserId, &s.UserAgent, &s.IP, &lastSeenAt, &revokedAt)
+	if err != nil {
+		return session.Nil, err
+	}
+
+	s.CreatedAt = sqldb.ParseTime(createdAt)
+	s.LastSeenAt = sqldb.ParseTime(lastSeenAt)
+	s.RevokedAt = sqldb.ParseNullTime(revokedAt)
+
+	return s, nil
+}
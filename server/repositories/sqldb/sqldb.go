@@ -0,0 +1,200 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strings"
+	"time"
+)
+
+// Scanner is implemented by both *sql.Row and *sql.Rows
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+// Querier is implemented by both *sql.DB and *sql.Tx
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
+// Conn returns the transaction WithTx stored in ctx, or db outside of one
+func Conn(ctx context.Context, db *sql.DB) Querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// WithTx runs fn in a transaction that the repositories pick up through Conn.
+// It joins the transaction already stored in ctx, if any, and rolls back if
+// fn fails.
+func WithTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(context.WithValue(ctx, txKey{}, tx))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Open opens the SQLite database described by dsn using the pure-Go driver,
+// so no cgo toolchain is needed to build the server.
+func Open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, and every connection to ":memory:" opens
+	// a brand-new database, so the pool is limited to one connection.
+	db.SetMaxOpenConns(1)
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// EnsureTable creates the table if it does not exist and adds any column of
+// columns that an older schema is missing. Every column is a full SQLite column
+// definition whose first word is the column name, e.g. "name TEXT NOT NULL".
+func EnsureTable(db *sql.DB, table string, columns []string) error {
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(columns, ", "))
+	_, err := db.Exec(query)
+	if err != nil {
+		return err
+	}
+
+	existing, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range columns {
+		name := strings.Fields(c)[0]
+		if existing[name] {
+			continue
+		}
+
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, c))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnsureIndex creates an index on the columns of table if it does not exist
+func EnsureIndex(db *sql.DB, table string, columns ...string) error {
+	name := fmt.Sprintf("%s_%s_idx", table, strings.Join(columns, "_"))
+	_, err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", name, table, strings.Join(columns, ", ")))
+	return err
+}
+
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			typ       string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		err = rows.Scan(&cid, &name, &typ, &notNull, &dfltValue, &pk)
+		if err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+
+	return columns, rows.Err()
+}
+
+// Time converts t to the unix milliseconds stored in the database, the same
+// precision a BSON datetime has.
+func Time(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+// ParseTime converts unix milliseconds read from the database back to a time.
+func ParseTime(ms int64) time.Time {
+	if ms == (time.Time{}).UnixMilli() {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// NullTime converts t like Time, storing the zero time as NULL
+func NullTime(t time.Time) sql.NullInt64 {
+	return sql.NullInt64{Int64: Time(t), Valid: !t.IsZero()}
+}
+
+// ParseNullTime converts a value stored by NullTime back to a time
+func ParseNullTime(ms sql.NullInt64) time.Time {
+	if !ms.Valid {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms.Int64)
+}
+
+// JSON encodes v to be stored in a TEXT column. nil values are stored as NULL.
+func JSON(v any) (sql.NullString, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	if string(b) == "null" {
+		return sql.NullString{}, nil
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// ParseJSON decodes a TEXT column written by JSON into v.
+func ParseJSON(s sql.NullString, v any) error {
+	if !s.Valid {
+		return nil
+	}
+	return json.Unmarshal([]byte(s.String), v)
+}
+
+// Placeholders returns n comma separated bind parameters for an IN clause
+func Placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// IsUniqueViolation reports whether err was caused by a UNIQUE constraint
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
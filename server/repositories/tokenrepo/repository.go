@@ -0,0 +1,138 @@
+package tokenrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/token"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type TokenDBModel struct {
+	Id        uuid.UUID `bson:"_id"`
+	CreatedAt time.Time `bson:"created_at"`
+	UserId    uuid.UUID `bson:"user_id"`
+	FamilyId  uuid.UUID `bson:"family_id"`
+	Hash      string    `bson:"hash"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	UsedAt    time.Time `bson:"used_at,omitempty"`
+	RevokedAt time.Time `bson:"revoked_at,omitempty"`
+}
+
+func ConvertToTokenDBModel(t token.RefreshToken) TokenDBModel {
+	return TokenDBModel{
+		Id:        t.Id,
+		CreatedAt: t.CreatedAt,
+		UserId:    t.UserId,
+		FamilyId:  t.FamilyId,
+		Hash:      t.Hash,
+		ExpiresAt: t.ExpiresAt,
+		UsedAt:    t.UsedAt,
+		RevokedAt: t.RevokedAt,
+	}
+}
+
+func ConvertToTokenDomainModel(dbToken TokenDBModel) token.RefreshToken {
+	return token.RefreshToken{
+		Id:        dbToken.Id,
+		CreatedAt: dbToken.CreatedAt,
+		UserId:    dbToken.UserId,
+		FamilyId:  dbToken.FamilyId,
+		Hash:      dbToken.Hash,
+		ExpiresAt: dbToken.ExpiresAt,
+		UsedAt:    dbToken.UsedAt,
+		RevokedAt: dbToken.RevokedAt,
+	}
+}
+
+type Repository interface {
+	CreateToken(ctx context.Context, t token.RefreshToken) (token.RefreshToken, error)
+	TokenByHash(ctx context.Context, hash string) (token.RefreshToken, error)
+	// UseToken marks the token as used. It fails with token.ErrReused if it
+	// already was, so a token can only be exchanged once.
+	UseToken(ctx context.Context, id uuid.UUID, at time.Time) error
+	RevokeFamily(ctx context.Context, familyId uuid.UUID, at time.Time) error
+	// PurgeTokens deletes the tokens of the users and the tokens that expired
+	// before the given time
+	PurgeTokens(ctx context.Context, userIds []uuid.UUID, expiredBefore time.Time) error
+}
+
+type repository struct {
+	tokens *mongo.Collection
+}
+
+func New(collection *mongo.Collection) Repository {
+	return &repository{
+		tokens: collection,
+	}
+}
+
+func (r *repository) CreateToken(ctx context.Context, t token.RefreshToken) (token.RefreshToken, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return token.Nil, err
+	}
+	t.Id = id
+	t.CreatedAt = time.Now()
+
+	dbToken, err := bson.Marshal(ConvertToTokenDBModel(t))
+	if err != nil {
+		return token.Nil, err
+	}
+
+	_, err = r.tokens.InsertOne(ctx, dbToken)
+	if err != nil {
+		return token.Nil, err
+	}
+
+	return t, nil
+}
+
+func (r *repository) TokenByHash(ctx context.Context, hash string) (token.RefreshToken, error) {
+	var t TokenDBModel
+
+	err := r.tokens.FindOne(ctx, bson.M{"hash": hash}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return token.Nil, token.ErrNotFound
+	}
+	if err != nil {
+		return token.Nil, err
+	}
+
+	return ConvertToTokenDomainModel(t), nil
+}
+
+func (r *repository) UseToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	filter := bson.M{"_id": id, "used_at": bson.M{"$exists": false}}
+
+	res, err := r.tokens.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used_at": at}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return token.ErrReused
+	}
+
+	return nil
+}
+
+func (r *repository) RevokeFamily(ctx context.Context, familyId uuid.UUID, at time.Time) error {
+	filter := bson.M{"family_id": familyId, "revoked_at": bson.M{"$exists": false}}
+
+	_, err := r.tokens.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": at}})
+
+	return err
+}
+
+func (r *repository) PurgeTokens(ctx context.Context, userIds []uuid.UUID, expiredBefore time.Time) error {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"user_id": bson.M{"$in": userIds}},
+		bson.M{"expires_at": bson.M{"$lt": expiredBefore}},
+	}}
+
+	_, err := r.tokens.DeleteMany(ctx, filter)
+
+	return err
+}
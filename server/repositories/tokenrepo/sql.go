@@ -0,0 +1,137 @@
+package tokenrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/token"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"time"
+)
+
+var tokenColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"created_at INTEGER NOT NULL",
+	"user_id TEXT NOT NULL",
+	"family_id TEXT NOT NULL",
+	"hash TEXT NOT NULL UNIQUE",
+	"expires_at INTEGER NOT NULL",
+	"used_at INTEGER",
+	"revoked_at INTEGER",
+}
+
+const tokenSelect = `SELECT id, created_at, user_id, family_id, hash, expires_at, used_at, revoked_at
+	FROM refresh_tokens`
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Repository that stores refresh tokens in the refresh_tokens
+// table of db, creating the table if needed.
+func NewSQL(db *sql.DB) (Repository, error) {
+	err := sqldb.EnsureTable(db, "refresh_tokens", tokenColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "refresh_tokens", "family_id")
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "refresh_tokens", "user_id")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRepository{db: db}, nil
+}
+
+// conn returns the transaction in ctx, if any, or the database
+func (r *sqlRepository) conn(ctx context.Context) sqldb.Querier {
+	return sqldb.Conn(ctx, r.db)
+}
+
+func (r *sqlRepository) CreateToken(ctx context.Context, t token.RefreshToken) (token.RefreshToken, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return token.Nil, err
+	}
+	t.Id = id
+	t.CreatedAt = time.Now()
+
+	_, err = r.conn(ctx).ExecContext(ctx, `INSERT INTO refresh_tokens (id, created_at, user_id, family_id, hash,
+		expires_at, used_at, revoked_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Id, sqldb.Time(t.CreatedAt), t.UserId, t.FamilyId, t.Hash, sqldb.Time(t.ExpiresAt),
+		sqldb.NullTime(t.UsedAt), sqldb.NullTime(t.RevokedAt))
+	if err != nil {
+		return token.Nil, err
+	}
+
+	return t, nil
+}
+
+func (r *sqlRepository) TokenByHash(ctx context.Context, hash string) (token.RefreshToken, error) {
+	var (
+		t                    token.RefreshToken
+		createdAt, expiresAt int64
+		usedAt, revokedAt    sql.NullInt64
+	)
+
+	err := r.conn(ctx).QueryRowContext(ctx, tokenSelect+" WHERE hash = ?", hash).Scan(&t.Id, &createdAt,
+		&t.UserId, &t.FamilyId, &t.Hash, &expiresAt, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return token.Nil, token.ErrNotFound
+	}
+	if err != nil {
+		return token.Nil, err
+	}
+
+	t.CreatedAt = sqldb.ParseTime(createdAt)
+	t.ExpiresAt = sqldb.ParseTime(expiresAt)
+	t.UsedAt = sqldb.ParseNullTime(usedAt)
+	t.RevokedAt = sqldb.ParseNullTime(revokedAt)
+
+	return t, nil
+}
+
+func (r *sqlRepository) UseToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL",
+		sqldb.Time(at), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return token.ErrReused
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) RevokeFamily(ctx context.Context, familyId uuid.UUID, at time.Time) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = ?
+		WHERE family_id = ? AND revoked_at IS NULL`, sqldb.Time(at), familyId)
+
+	return err
+}
+
+func (r *sqlRepository) PurgeTokens(ctx context.Context, userIds []uuid.UUID, expiredBefore time.Time) error {
+	args := []any{sqldb.Time(expiredBefore)}
+	query := "DELETE FROM refresh_tokens WHERE expires_at < ?"
+	if len(userIds) > 0 {
+		for _, id := range userIds {
+			args = append(args, id)
+		}
+		query += " OR user_id IN (" + sqldb.Placeholders(len(userIds)) + ")"
+	}
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, args...)
+
+	return err
+}
@@ -0,0 +1,63 @@
+package transaction
+
+import (
+	"context"
+	"sync"
+)
+
+type journalKey struct{}
+
+// journal collects the undo functions of the writes made in a memory transaction
+type journal struct {
+	mux  sync.Mutex
+	undo []func()
+}
+
+type memoryTransactor struct {
+	mux sync.Mutex
+}
+
+// NewMemory returns a Transactor for the in-memory repositories. They record
+// how to undo each write with OnRollback, and the writes are undone in reverse
+// order if fn fails. Transactions run one at a time, but the writes made
+// outside of one are not isolated from them.
+func NewMemory() Transactor {
+	return &memoryTransactor{}
+}
+
+func (t *memoryTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(journalKey{}).(*journal); ok {
+		return fn(ctx)
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	j := &journal{}
+	txCtx, h := begin(ctx)
+	err := fn(context.WithValue(txCtx, journalKey{}, j))
+	if err != nil {
+		for i := len(j.undo) - 1; i >= 0; i-- {
+			j.undo[i]()
+		}
+		return err
+	}
+
+	h.committed()
+
+	return nil
+}
+
+// OnRollback registers undo to be called if the memory transaction in ctx
+// fails. Outside of a transaction it does nothing.
+func OnRollback(ctx context.Context, undo func()) {
+	j, ok := ctx.Value(journalKey{}).(*journal)
+	if !ok {
+		return
+	}
+
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	j.undo = append(j.undo, undo)
+}
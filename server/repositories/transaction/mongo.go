@@ -0,0 +1,44 @@
+package transaction
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoTransactor struct {
+	client *mongo.Client
+}
+
+// NewMongo returns a Transactor that runs fn in a mongo session transaction.
+// Transactions need the deployment to be a replica set or a sharded cluster.
+func NewMongo(client *mongo.Client) Transactor {
+	return mongoTransactor{client: client}
+}
+
+func (t mongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	// the callback is retried on transient errors, so only the hooks of the
+	// attempt that committed are run
+	var h *hooks
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var txCtx context.Context
+		txCtx, h = begin(sc)
+		return nil, fn(mongo.NewSessionContext(txCtx, sc))
+	})
+	if err != nil {
+		return err
+	}
+
+	h.committed()
+
+	return nil
+}
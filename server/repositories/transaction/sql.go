@@ -0,0 +1,32 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+)
+
+type sqlTransactor struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Transactor that runs fn in a database transaction
+func NewSQL(db *sql.DB) Transactor {
+	return sqlTransactor{db: db}
+}
+
+func (t sqlTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if InTransaction(ctx) {
+		return sqldb.WithTx(ctx, t.db, fn)
+	}
+
+	txCtx, h := begin(ctx)
+	err := sqldb.WithTx(txCtx, t.db, fn)
+	if err != nil {
+		return err
+	}
+
+	h.committed()
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package transaction
+
+import (
+	"context"
+	"sync"
+)
+
+// Transactor runs a group of repository calls atomically. The repositories
+// take part in the transaction through the context handed to fn, so every
+// call made inside fn must use it. Either all the writes fn makes take effect
+// or, if fn returns an error, none of them does.
+//
+// Nested calls join the transaction already in progress.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type hooksKey struct{}
+
+// hooks collects the functions to run once a transaction commits
+type hooks struct {
+	mux         sync.Mutex
+	afterCommit []func()
+}
+
+// begin returns ctx marked as running in a transaction, and the hooks to run
+// once it commits
+func begin(ctx context.Context) (context.Context, *hooks) {
+	h := &hooks{}
+	return context.WithValue(ctx, hooksKey{}, h), h
+}
+
+func (h *hooks) committed() {
+	for _, fn := range h.afterCommit {
+		fn()
+	}
+}
+
+// InTransaction reports whether ctx belongs to a transaction of a Transactor
+func InTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(hooksKey{}).(*hooks)
+	return ok
+}
+
+// AfterCommit registers fn to be called once the transaction in ctx commits.
+// It is not called if the transaction fails. Outside of a transaction fn is
+// called right away.
+func AfterCommit(ctx context.Context, fn func()) {
+	h, ok := ctx.Value(hooksKey{}).(*hooks)
+	if !ok {
+		fn()
+		return
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.afterCommit = append(h.afterCommit, fn)
+}
@@ -0,0 +1,99 @@
+package userrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/repositories/cache"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+)
+
+type cachedRepository struct {
+	Repository
+	cache cache.Cache[uuid.UUID, user.User]
+}
+
+// NewCached returns a Repository that serves the lookups by id from c and
+// reads through to repo on a miss. Users are dropped from c when they are
+// updated, deleted or purged. Lookups made in a transaction bypass c, so
+// uncommitted users never end up in it.
+func NewCached(repo Repository, c cache.Cache[uuid.UUID, user.User]) Repository {
+	return &cachedRepository{Repository: repo, cache: c}
+}
+
+func (r *cachedRepository) User(ctx context.Context, id uuid.UUID) (user.User, error) {
+	if transaction.InTransaction(ctx) {
+		return r.Repository.User(ctx, id)
+	}
+
+	if u, ok := r.cache.Get(id); ok {
+		return cloneUser(u), nil
+	}
+
+	u, err := r.Repository.User(ctx, id)
+	if err != nil {
+		return user.Nil, err
+	}
+	r.cache.Set(id, cloneUser(u))
+
+	return u, nil
+}
+
+func (r *cachedRepository) UsersByIds(ctx context.Context, ids []uuid.UUID) ([]user.User, error) {
+	if transaction.InTransaction(ctx) {
+		return r.Repository.UsersByIds(ctx, ids)
+	}
+
+	var (
+		users   []user.User
+		missing []uuid.UUID
+	)
+	for _, id := range ids {
+		if u, ok := r.cache.Get(id); ok {
+			users = append(users, cloneUser(u))
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) == 0 {
+		return users, nil
+	}
+
+	fetched, err := r.Repository.UsersByIds(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range fetched {
+		r.cache.Set(u.Id, cloneUser(u))
+	}
+
+	return append(users, fetched...), nil
+}
+
+func (r *cachedRepository) UpdateUser(ctx context.Context, u user.User) (user.User, error) {
+	defer r.invalidate(ctx, u.Id)
+
+	return r.Repository.UpdateUser(ctx, u)
+}
+
+func (r *cachedRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	defer r.invalidate(ctx, id)
+
+	return r.Repository.DeleteUser(ctx, id)
+}
+
+func (r *cachedRepository) PurgeUsers(ctx context.Context, ids []uuid.UUID) error {
+	defer r.invalidate(ctx, ids...)
+
+	return r.Repository.PurgeUsers(ctx, ids)
+}
+
+// invalidate drops the users from the cache now and, in a transaction, once
+// it commits, in case a concurrent lookup cached them in between
+func (r *cachedRepository) invalidate(ctx context.Context, ids ...uuid.UUID) {
+	r.cache.Delete(ids...)
+	transaction.AfterCommit(ctx, func() {
+		r.cache.Delete(ids...)
+	})
+}
@@ -0,0 +1,237 @@
+package userrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mux   sync.RWMutex
+	users map[uuid.UUID]user.User
+	// emails indexes the users by their lower-cased email
+	emails map[string]uuid.UUID
+}
+
+// NewMemory returns a thread-safe Repository that keeps every user in memory.
+// It is meant for local development and tests where no database is available.
+func NewMemory() Repository {
+	return &memoryRepository{
+		users:  make(map[uuid.UUID]user.User),
+		emails: make(map[string]uuid.UUID),
+	}
+}
+
+func (r *memoryRepository) CreateUser(ctx context.Context, u user.User) (user.User, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return user.Nil, err
+	}
+	u.Id = id
+
+	now := time.Now()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+
+	u.Deleted = false
+	u.Version = 1
+
+	key := strings.ToLower(u.Email)
+	if _, ok := r.emails[key]; ok {
+		return user.Nil, user.ErrMailExists
+	}
+
+	r.remember(ctx, u.Id)
+	r.users[u.Id] = cloneUser(u)
+	r.emails[key] = u.Id
+
+	return u, nil
+}
+
+func (r *memoryRepository) User(ctx context.Context, id uuid.UUID) (user.User, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return user.Nil, user.ErrNotFound
+	}
+
+	return cloneUser(u), nil
+}
+
+func (r *memoryRepository) UserByEmail(ctx context.Context, email string, includeDel bool) (user.User, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	id, ok := r.emails[strings.ToLower(email)]
+	if !ok {
+		return user.Nil, user.ErrNotFound
+	}
+
+	u := r.users[id]
+	if !includeDel && u.Deleted {
+		return user.Nil, user.ErrNotFound
+	}
+
+	return cloneUser(u), nil
+}
+
+func (r *memoryRepository) Users(ctx context.Context, includeDel bool) ([]user.User, error) {
+	return r.usersInternal(func(u user.User) bool { return includeDel || !u.Deleted })
+}
+
+func (r *memoryRepository) QueryUsers(ctx context.Context, query Query) ([]user.User, error) {
+	users, err := r.usersInternal(query.matches)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Offset >= len(users) {
+		return nil, nil
+	}
+	users = users[query.Offset:]
+
+	if query.Limit > 0 && query.Limit < len(users) {
+		users = users[:query.Limit]
+	}
+
+	return users, nil
+}
+
+func (r *memoryRepository) UsersByIds(ctx context.Context, ids []uuid.UUID) ([]user.User, error) {
+	return r.usersInternal(func(u user.User) bool { return lo.Contains(ids, u.Id) })
+}
+
+func (r *memoryRepository) UsersDeletedBefore(ctx context.Context, before time.Time) ([]user.User, error) {
+	return r.usersInternal(func(u user.User) bool {
+		return u.Deleted && !u.DeletedAt.IsZero() && u.DeletedAt.Before(before)
+	})
+}
+
+func (r *memoryRepository) usersInternal(match func(u user.User) bool) ([]user.User, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	var users []user.User
+	for _, u := range r.users {
+		if match(u) {
+			users = append(users, cloneUser(u))
+		}
+	}
+
+	// keep the order the mongo and sql repositories return, so that the
+	// pages of QueryUsers neither overlap nor skip users
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.Before(users[j].CreatedAt)
+		}
+		return users[i].Id.String() < users[j].Id.String()
+	})
+
+	return users, nil
+}
+
+func (r *memoryRepository) UpdateUser(ctx context.Context, u user.User) (user.User, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.updateUserInternal(ctx, u)
+}
+
+func (r *memoryRepository) updateUserInternal(ctx context.Context, u user.User) (user.User, error) {
+	old, ok := r.users[u.Id]
+	if !ok {
+		return user.Nil, user.ErrNotFound
+	}
+	if old.Version != u.Version {
+		return user.Nil, user.ErrConflict
+	}
+
+	key := strings.ToLower(u.Email)
+	if id, ok := r.emails[key]; ok && id != u.Id {
+		return user.Nil, user.ErrMailExists
+	}
+
+	u.UpdatedAt = time.Now()
+	u.Version++
+
+	r.remember(ctx, u.Id)
+	delete(r.emails, strings.ToLower(old.Email))
+	r.emails[key] = u.Id
+	r.users[u.Id] = cloneUser(u)
+
+	return u, nil
+}
+
+func (r *memoryRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return user.ErrNotFound
+	}
+
+	u.Deleted = true
+	u.DeletedAt = time.Now()
+
+	_, err := r.updateUserInternal(ctx, u)
+
+	return err
+}
+
+func (r *memoryRepository) PurgeUsers(ctx context.Context, ids []uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for _, id := range ids {
+		u, ok := r.users[id]
+		if !ok {
+			continue
+		}
+
+		r.remember(ctx, id)
+		delete(r.emails, strings.ToLower(u.Email))
+		delete(r.users, id)
+	}
+
+	return nil
+}
+
+// remember registers the current state of the user to be restored if the
+// transaction in ctx is rolled back. Callers must hold the lock.
+func (r *memoryRepository) remember(ctx context.Context, id uuid.UUID) {
+	old, ok := r.users[id]
+	transaction.OnRollback(ctx, func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if u, exists := r.users[id]; exists {
+			delete(r.emails, strings.ToLower(u.Email))
+			delete(r.users, id)
+		}
+		if ok {
+			r.users[id] = old
+			r.emails[strings.ToLower(old.Email)] = id
+		}
+	})
+}
+
+// cloneUser copies the slice fields so that callers cannot mutate the stored
+// user through shared references.
+func cloneUser(u user.User) user.User {
+	if u.RecoveryCodes != nil {
+		u.RecoveryCodes = append([]string(nil), u.RecoveryCodes...)
+	}
+	return u
+}
@@ -6,91 +6,198 @@ import (
 	"github.com/scarlettmiss/petJournal/application/domain/user"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"sync"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"strings"
 	"time"
 )
 
 type UserDBModel struct {
-	Id           uuid.UUID `bson:"_id"`
-	CreatedAt    time.Time `bson:"created_at"`
-	UpdatedAt    time.Time `bson:"updated_at"`
-	Deleted      bool      `bson:"deleted"`
-	UserType     user.Type `bson:"user_type"`
-	Email        string    `bson:"email"`
-	PasswordHash string    `bson:"password_hash"`
-	Name         string    `bson:"name"`
-	Surname      string    `bson:"surname"`
-	Phone        string    `bson:"phone,omitempty"`
-	Address      string    `bson:"address,omitempty"`
-	City         string    `bson:"city,omitempty"`
-	State        string    `bson:"state,omitempty"`
-	Country      string    `bson:"country,omitempty"`
-	Zip          string    `bson:"zip,omitempty"`
+	Id            uuid.UUID `bson:"_id"`
+	CreatedAt     time.Time `bson:"created_at"`
+	UpdatedAt     time.Time `bson:"updated_at"`
+	Deleted       bool      `bson:"deleted"`
+	DeletedAt     time.Time `bson:"deleted_at,omitempty"`
+	Version       int64     `bson:"version"`
+	UserType      user.Type `bson:"user_type"`
+	Email         string    `bson:"email"`
+	EmailVerified bool      `bson:"email_verified"`
+	PasswordHash  string    `bson:"password_hash"`
+	Name          string    `bson:"name"`
+	Surname       string    `bson:"surname"`
+	Phone         string    `bson:"phone,omitempty"`
+	Address       string    `bson:"address,omitempty"`
+	City          string    `bson:"city,omitempty"`
+	State         string    `bson:"state,omitempty"`
+	Country       string    `bson:"country,omitempty"`
+	Zip           string    `bson:"zip,omitempty"`
+	TOTPSecret    string    `bson:"totp_secret,omitempty"`
+	TOTPEnabled   bool      `bson:"totp_enabled,omitempty"`
+	TOTPLastStep  int64     `bson:"totp_last_step,omitempty"`
+	RecoveryCodes []string  `bson:"recovery_codes,omitempty"`
+	Disabled      bool      `bson:"disabled,omitempty"`
+
+	LicenseNumber     string             `bson:"license_number,omitempty"`
+	LicenseAuthority  string             `bson:"license_authority,omitempty"`
+	LicenseStatus     user.LicenseStatus `bson:"license_status,omitempty"`
+	LicenseReviewedBy uuid.UUID          `bson:"license_reviewed_by,omitempty"`
+	LicenseReviewedAt time.Time          `bson:"license_reviewed_at,omitempty"`
+	LicenseNote       string             `bson:"license_note,omitempty"`
 }
 
 func ConvertToUserDBModel(user user.User) UserDBModel {
 	return UserDBModel{
-		Id:           user.Id,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Deleted:      user.Deleted,
-		UserType:     user.UserType,
-		Email:        user.Email,
-		PasswordHash: user.PasswordHash,
-		Name:         user.Name,
-		Surname:      user.Surname,
-		Phone:        user.Phone,
-		Address:      user.Address,
-		City:         user.City,
-		State:        user.State,
-		Country:      user.Country,
-		Zip:          user.Zip,
+		Id:            user.Id,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Deleted:       user.Deleted,
+		DeletedAt:     user.DeletedAt,
+		Version:       user.Version,
+		UserType:      user.UserType,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		PasswordHash:  user.PasswordHash,
+		Name:          user.Name,
+		Surname:       user.Surname,
+		Phone:         user.Phone,
+		Address:       user.Address,
+		City:          user.City,
+		State:         user.State,
+		Country:       user.Country,
+		Zip:           user.Zip,
+		TOTPSecret:    user.TOTPSecret,
+		TOTPEnabled:   user.TOTPEnabled,
+		TOTPLastStep:  user.TOTPLastStep,
+		RecoveryCodes: user.RecoveryCodes,
+		Disabled:      user.Disabled,
+
+		LicenseNumber:     user.LicenseNumber,
+		LicenseAuthority:  user.LicenseAuthority,
+		LicenseStatus:     user.LicenseStatus,
+		LicenseReviewedBy: user.LicenseReviewedBy,
+		LicenseReviewedAt: user.LicenseReviewedAt,
+		LicenseNote:       user.LicenseNote,
 	}
 }
 
 func ConvertToUserDomainModel(dbUser UserDBModel) user.User {
 	return user.User{
-		Id:           dbUser.Id,
-		CreatedAt:    dbUser.CreatedAt,
-		UpdatedAt:    dbUser.UpdatedAt,
-		Deleted:      dbUser.Deleted,
-		UserType:     dbUser.UserType,
-		Email:        dbUser.Email,
-		PasswordHash: dbUser.PasswordHash,
-		Name:         dbUser.Name,
-		Surname:      dbUser.Surname,
-		Phone:        dbUser.Phone,
-		Address:      dbUser.Address,
-		City:         dbUser.City,
-		State:        dbUser.State,
-		Country:      dbUser.Country,
-		Zip:          dbUser.Zip,
+		Id:            dbUser.Id,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Deleted:       dbUser.Deleted,
+		DeletedAt:     dbUser.DeletedAt,
+		Version:       dbUser.Version,
+		UserType:      dbUser.UserType,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerified,
+		PasswordHash:  dbUser.PasswordHash,
+		Name:          dbUser.Name,
+		Surname:       dbUser.Surname,
+		Phone:         dbUser.Phone,
+		Address:       dbUser.Address,
+		City:          dbUser.City,
+		State:         dbUser.State,
+		Country:       dbUser.Country,
+		Zip:           dbUser.Zip,
+		TOTPSecret:    dbUser.TOTPSecret,
+		TOTPEnabled:   dbUser.TOTPEnabled,
+		TOTPLastStep:  dbUser.TOTPLastStep,
+		RecoveryCodes: dbUser.RecoveryCodes,
+		Disabled:      dbUser.Disabled,
+
+		LicenseNumber:     dbUser.LicenseNumber,
+		LicenseAuthority:  dbUser.LicenseAuthority,
+		LicenseStatus:     dbUser.LicenseStatus,
+		LicenseReviewedBy: dbUser.LicenseReviewedBy,
+		LicenseReviewedAt: dbUser.LicenseReviewedAt,
+		LicenseNote:       dbUser.LicenseNote,
 	}
 }
 
+// Query selects users, oldest first. Zero-valued fields do not restrict the
+// result.
+type Query struct {
+	Type user.Type
+	// Text is searched for in the email and the full name, ignoring case
+	Text       string
+	IncludeDel bool
+	// Offset skips that many matching users and Limit caps how many are
+	// returned. A zero Limit returns them all.
+	Offset int
+	Limit  int
+}
+
+func (q Query) filter() bson.M {
+	filter := bson.M{}
+
+	if q.Type != "" {
+		filter["user_type"] = q.Type
+	}
+
+	if text := strings.TrimSpace(q.Text); text != "" {
+		pattern := regexp.QuoteMeta(text)
+		filter["$or"] = bson.A{
+			bson.M{"email": bson.M{"$regex": pattern, "$options": "i"}},
+			bson.M{"$expr": bson.M{"$regexMatch": bson.M{
+				"input":   bson.M{"$concat": bson.A{"$name", " ", "$surname"}},
+				"regex":   pattern,
+				"options": "i",
+			}}},
+		}
+	}
+
+	if !q.IncludeDel {
+		filter["deleted"] = false
+	}
+
+	return filter
+}
+
+func (q Query) matches(u user.User) bool {
+	if q.Type != "" && u.UserType != q.Type {
+		return false
+	}
+
+	if text := strings.ToLower(strings.TrimSpace(q.Text)); text != "" &&
+		!strings.Contains(strings.ToLower(u.Email), text) &&
+		!strings.Contains(strings.ToLower(u.Name+" "+u.Surname), text) {
+		return false
+	}
+
+	return q.IncludeDel || !u.Deleted
+}
+
 type Repository interface {
-	CreateUser(user user.User) (user.User, error)
-	User(id uuid.UUID) (user.User, error)
-	Users(includeDel bool) ([]user.User, error)
-	UpdateUser(u user.User) (user.User, error)
-	DeleteUser(id uuid.UUID) error
+	CreateUser(ctx context.Context, user user.User) (user.User, error)
+	User(ctx context.Context, id uuid.UUID) (user.User, error)
+	Users(ctx context.Context, includeDel bool) ([]user.User, error)
+	QueryUsers(ctx context.Context, query Query) ([]user.User, error)
+	// UsersByIds returns the users with the given ids, deleted ones included.
+	// Ids without a user are skipped.
+	UsersByIds(ctx context.Context, ids []uuid.UUID) ([]user.User, error)
+	UserByEmail(ctx context.Context, email string, includeDel bool) (user.User, error)
+	UpdateUser(ctx context.Context, u user.User) (user.User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	UsersDeletedBefore(ctx context.Context, before time.Time) ([]user.User, error)
+	PurgeUsers(ctx context.Context, ids []uuid.UUID) error
 }
 
 type repository struct {
-	mux   sync.Mutex
 	users *mongo.Collection
 }
 
+// EmailCollation compares emails case-insensitively. The unique email index
+// is created with it, so the email lookups must use it too.
+var EmailCollation = &options.Collation{Locale: "en", Strength: 2}
+
 func New(collection *mongo.Collection) Repository {
 	return &repository{
 		users: collection,
 	}
 }
 
-func (r *repository) CreateUser(u user.User) (user.User, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
+func (r *repository) CreateUser(ctx context.Context, u user.User) (user.User, error) {
 	id, err := uuid.NewRandom()
 	if err != nil {
 		return user.Nil, err
@@ -102,13 +209,17 @@ func (r *repository) CreateUser(u user.User) (user.User, error) {
 	u.UpdatedAt = now
 
 	u.Deleted = false
+	u.Version = 1
 
 	dbUser, err := bson.Marshal(ConvertToUserDBModel(u))
 	if err != nil {
 		return user.Nil, err
 	}
 
-	_, err = r.users.InsertOne(context.Background(), dbUser)
+	_, err = r.users.InsertOne(ctx, dbUser)
+	if mongo.IsDuplicateKeyError(err) {
+		return user.Nil, user.ErrMailExists
+	}
 	if err != nil {
 		return user.Nil, err
 	}
@@ -116,34 +227,49 @@ func (r *repository) CreateUser(u user.User) (user.User, error) {
 	return u, nil
 }
 
-func (r *repository) User(id uuid.UUID) (user.User, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
-	retrievedUser, err := r.userInternal(id)
+func (r *repository) User(ctx context.Context, id uuid.UUID) (user.User, error) {
+	retrievedUser, err := r.userInternal(ctx, id)
 
 	return ConvertToUserDomainModel(retrievedUser), err
 }
 
-func (r *repository) userInternal(id uuid.UUID) (UserDBModel, error) {
+func (r *repository) userInternal(ctx context.Context, id uuid.UUID) (UserDBModel, error) {
 	var retrievedUser UserDBModel
 
 	filter := bson.M{"_id": id}
 
-	err := r.users.FindOne(context.Background(), filter).Decode(&retrievedUser)
-	if err != nil {
+	err := r.users.FindOne(ctx, filter).Decode(&retrievedUser)
+	if err == mongo.ErrNoDocuments {
 		return UserDBModel{}, user.ErrNotFound
 	}
+	if err != nil {
+		return UserDBModel{}, err
+	}
 
 	return retrievedUser, nil
 }
 
-func (r *repository) Users(includeDel bool) ([]user.User, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
+func (r *repository) UserByEmail(ctx context.Context, email string, includeDel bool) (user.User, error) {
+	var retrievedUser UserDBModel
 
-	var users []user.User
+	filter := bson.M{"email": email}
+	if !includeDel {
+		filter["deleted"] = false
+	}
 
+	opts := options.FindOne().SetCollation(EmailCollation)
+	err := r.users.FindOne(ctx, filter, opts).Decode(&retrievedUser)
+	if err == mongo.ErrNoDocuments {
+		return user.Nil, user.ErrNotFound
+	}
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return ConvertToUserDomainModel(retrievedUser), nil
+}
+
+func (r *repository) Users(ctx context.Context, includeDel bool) ([]user.User, error) {
 	var filter bson.M
 
 	if includeDel {
@@ -153,9 +279,37 @@ func (r *repository) Users(includeDel bool) ([]user.User, error) {
 		filter = bson.M{"deleted": false}
 	}
 
-	ctx := context.Background()
+	return r.usersInternal(ctx, filter)
+}
+
+func (r *repository) QueryUsers(ctx context.Context, query Query) ([]user.User, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(query.Offset))
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+
+	return r.usersInternal(ctx, query.filter(), opts)
+}
+
+func (r *repository) UsersByIds(ctx context.Context, ids []uuid.UUID) ([]user.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return r.usersInternal(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+func (r *repository) UsersDeletedBefore(ctx context.Context, before time.Time) ([]user.User, error) {
+	return r.usersInternal(ctx, bson.M{"deleted": true, "deleted_at": bson.M{"$lt": before}})
+}
+
+func (r *repository) usersInternal(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]user.User, error) {
+	var users []user.User
+
 	// Perform the find operation
-	cursor, err := r.users.Find(ctx, filter)
+	cursor, err := r.users.Find(ctx, filter, opts...)
 	if err != nil {
 		return users, err
 	}
@@ -182,11 +336,8 @@ func (r *repository) Users(includeDel bool) ([]user.User, error) {
 	return users, nil
 }
 
-func (r *repository) UpdateUser(u user.User) (user.User, error) {
-	r.mux.Lock()
-	defer r.mux.Unlock()
-
-	updatedUser, err := r.updateUserInternal(ConvertToUserDBModel(u))
+func (r *repository) UpdateUser(ctx context.Context, u user.User) (user.User, error) {
+	updatedUser, err := r.updateUserInternal(ctx, ConvertToUserDBModel(u))
 	if err != nil {
 		return user.Nil, err
 	}
@@ -194,38 +345,67 @@ func (r *repository) UpdateUser(u user.User) (user.User, error) {
 	return ConvertToUserDomainModel(updatedUser), nil
 }
 
-func (r *repository) updateUserInternal(u UserDBModel) (UserDBModel, error) {
-	// Define the filter to identify the document to update
-	filter := bson.M{"_id": u.Id}
+func (r *repository) updateUserInternal(ctx context.Context, u UserDBModel) (UserDBModel, error) {
+	// Only replace the document if it was not updated since it was read.
+	// Documents written before versioning have no version field.
+	filter := bson.M{"_id": u.Id, "version": u.Version}
+	if u.Version == 0 {
+		filter["version"] = bson.M{"$exists": false}
+	}
 
 	u.UpdatedAt = time.Now()
-	// Define the update document using the '$set' operator
+	u.Version++
+
 	replacement, err := bson.Marshal(u)
 	if err != nil {
 		return UserDBModel{}, err
 	}
 
-	// Perform the update operation
-	_, err = r.users.ReplaceOne(context.Background(), filter, replacement)
+	res, err := r.users.ReplaceOne(ctx, filter, replacement)
+	if mongo.IsDuplicateKeyError(err) {
+		return UserDBModel{}, user.ErrMailExists
+	}
 	if err != nil {
 		return UserDBModel{}, err
 	}
 
+	if res.MatchedCount == 0 {
+		// tell a missing user apart from a stale one
+		_, err = r.userInternal(ctx, u.Id)
+		if err != nil {
+			return UserDBModel{}, err
+		}
+		return UserDBModel{}, user.ErrConflict
+	}
+
 	return u, nil
 }
 
-func (r *repository) DeleteUser(id uuid.UUID) error {
-	r.mux.Lock()
-	defer r.mux.Unlock()
+func (r *repository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{"deleted": true, "deleted_at": now, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}
 
-	retrievedUser, err := r.userInternal(id)
+	res, err := r.users.UpdateOne(ctx, bson.M{"_id": id}, update)
 	if err != nil {
 		return err
 	}
 
-	retrievedUser.Deleted = true
+	if res.MatchedCount == 0 {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) PurgeUsers(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
 
-	_, err = r.updateUserInternal(retrievedUser)
+	_, err := r.users.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
 
 	return err
 }
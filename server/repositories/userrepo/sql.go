@@ -0,0 +1,340 @@
+package userrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/user"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"strings"
+	"time"
+)
+
+var userColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"created_at INTEGER NOT NULL",
+	"updated_at INTEGER NOT NULL",
+	"deleted INTEGER NOT NULL DEFAULT 0",
+	"version INTEGER NOT NULL DEFAULT 0",
+	"user_type TEXT NOT NULL",
+	"email TEXT NOT NULL",
+	"email_verified INTEGER NOT NULL DEFAULT 0",
+	"password_hash TEXT NOT NULL",
+	"name TEXT NOT NULL",
+	"surname TEXT NOT NULL",
+	"phone TEXT NOT NULL DEFAULT ''",
+	"address TEXT NOT NULL DEFAULT ''",
+	"city TEXT NOT NULL DEFAULT ''",
+	"state TEXT NOT NULL DEFAULT ''",
+	"country TEXT NOT NULL DEFAULT ''",
+	"zip TEXT NOT NULL DEFAULT ''",
+	"deleted_at INTEGER",
+	"totp_secret TEXT NOT NULL DEFAULT ''",
+	"totp_enabled INTEGER NOT NULL DEFAULT 0",
+	"totp_last_step INTEGER NOT NULL DEFAULT 0",
+	"recovery_codes TEXT",
+	"disabled INTEGER NOT NULL DEFAULT 0",
+	"license_number TEXT NOT NULL DEFAULT ''",
+	"license_authority TEXT NOT NULL DEFAULT ''",
+	"license_status TEXT NOT NULL DEFAULT ''",
+	"license_reviewed_by TEXT NOT NULL DEFAULT ''",
+	"license_reviewed_at INTEGER",
+	"license_note TEXT NOT NULL DEFAULT ''",
+}
+
+const userSelect = `SELECT id, created_at, updated_at, deleted, version, user_type, email, email_verified, password_hash,
+	name, surname, phone, address, city, state, country, zip, deleted_at, totp_secret, totp_enabled, totp_last_step,
+	recovery_codes, disabled, license_number, license_authority, license_status, license_reviewed_by, license_reviewed_at,
+	license_note FROM users`
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Repository that stores users in the users table of db,
+// creating the table if needed.
+func NewSQL(db *sql.DB) (Repository, error) {
+	err := sqldb.EnsureTable(db, "users", userColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (email COLLATE NOCASE)")
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "users", "user_type", "created_at")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRepository{db: db}, nil
+}
+
+// conn returns the transaction in ctx, if any, or the database
+func (r *sqlRepository) conn(ctx context.Context) sqldb.Querier {
+	return sqldb.Conn(ctx, r.db)
+}
+
+func (r *sqlRepository) CreateUser(ctx context.Context, u user.User) (user.User, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return user.Nil, err
+	}
+	u.Id = id
+
+	now := time.Now()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+
+	u.Deleted = false
+	u.Version = 1
+
+	codes, err := sqldb.JSON(u.RecoveryCodes)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	_, err = r.conn(ctx).ExecContext(ctx, `INSERT INTO users (id, created_at, updated_at, deleted, version, user_type, email,
+		email_verified, password_hash, name, surname, phone, address, city, state, country, zip, deleted_at, totp_secret,
+		totp_enabled, totp_last_step, recovery_codes, disabled, license_number, license_authority, license_status,
+		license_reviewed_by, license_reviewed_at, license_note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		u.Id, sqldb.Time(u.CreatedAt), sqldb.Time(u.UpdatedAt), u.Deleted, u.Version, string(u.UserType), u.Email,
+		u.EmailVerified, u.PasswordHash, u.Name, u.Surname, u.Phone, u.Address, u.City, u.State, u.Country, u.Zip,
+		sqldb.NullTime(u.DeletedAt), u.TOTPSecret, u.TOTPEnabled, u.TOTPLastStep, codes, u.Disabled, u.LicenseNumber,
+		u.LicenseAuthority, string(u.LicenseStatus), u.LicenseReviewedBy, sqldb.NullTime(u.LicenseReviewedAt), u.LicenseNote)
+	if sqldb.IsUniqueViolation(err) {
+		return user.Nil, user.ErrMailExists
+	}
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return u, nil
+}
+
+func (r *sqlRepository) User(ctx context.Context, id uuid.UUID) (user.User, error) {
+	u, err := scanUser(r.conn(ctx).QueryRowContext(ctx, userSelect+" WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return user.Nil, user.ErrNotFound
+	}
+
+	return u, err
+}
+
+func (r *sqlRepository) UserByEmail(ctx context.Context, email string, includeDel bool) (user.User, error) {
+	query := userSelect + " WHERE email = ? COLLATE NOCASE"
+	if !includeDel {
+		query += " AND deleted = 0"
+	}
+
+	u, err := scanUser(r.conn(ctx).QueryRowContext(ctx, query, email))
+	if err == sql.ErrNoRows {
+		return user.Nil, user.ErrNotFound
+	}
+
+	return u, err
+}
+
+func (r *sqlRepository) Users(ctx context.Context, includeDel bool) ([]user.User, error) {
+	query := userSelect
+	if !includeDel {
+		query += " WHERE deleted = 0"
+	}
+
+	return r.usersInternal(ctx, query+" ORDER BY created_at")
+}
+
+func (r *sqlRepository) QueryUsers(ctx context.Context, query Query) ([]user.User, error) {
+	where, args := query.where()
+
+	// a negative LIMIT has no upper bound
+	limit := -1
+	if query.Limit > 0 {
+		limit = query.Limit
+	}
+
+	return r.usersInternal(ctx, userSelect+where+" ORDER BY created_at, id LIMIT ? OFFSET ?",
+		append(args, limit, query.Offset)...)
+}
+
+func (r *sqlRepository) UsersByIds(ctx context.Context, ids []uuid.UUID) ([]user.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	return r.usersInternal(ctx, userSelect+" WHERE id IN ("+sqldb.Placeholders(len(ids))+") ORDER BY created_at", args...)
+}
+
+func (r *sqlRepository) UsersDeletedBefore(ctx context.Context, before time.Time) ([]user.User, error) {
+	return r.usersInternal(ctx, userSelect+" WHERE deleted = 1 AND deleted_at < ? ORDER BY created_at", sqldb.Time(before))
+}
+
+func (r *sqlRepository) usersInternal(ctx context.Context, query string, args ...any) ([]user.User, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []user.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *sqlRepository) UpdateUser(ctx context.Context, u user.User) (user.User, error) {
+	u.UpdatedAt = time.Now()
+
+	codes, err := sqldb.JSON(u.RecoveryCodes)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	// only update the row if it was not updated since it was read
+	res, err := r.conn(ctx).ExecContext(ctx, `UPDATE users SET created_at = ?, updated_at = ?, deleted = ?, version = version + 1,
+		user_type = ?, email = ?, email_verified = ?, password_hash = ?, name = ?, surname = ?, phone = ?, address = ?,
+		city = ?, state = ?, country = ?, zip = ?, deleted_at = ?, totp_secret = ?, totp_enabled = ?, totp_last_step = ?,
+		recovery_codes = ?, disabled = ?, license_number = ?, license_authority = ?, license_status = ?,
+		license_reviewed_by = ?, license_reviewed_at = ?, license_note = ? WHERE id = ? AND version = ?`,
+		sqldb.Time(u.CreatedAt), sqldb.Time(u.UpdatedAt), u.Deleted, string(u.UserType), u.Email, u.EmailVerified,
+		u.PasswordHash, u.Name, u.Surname, u.Phone, u.Address, u.City, u.State, u.Country, u.Zip,
+		sqldb.NullTime(u.DeletedAt), u.TOTPSecret, u.TOTPEnabled, u.TOTPLastStep, codes, u.Disabled, u.LicenseNumber,
+		u.LicenseAuthority, string(u.LicenseStatus), u.LicenseReviewedBy, sqldb.NullTime(u.LicenseReviewedAt), u.LicenseNote,
+		u.Id, u.Version)
+	if sqldb.IsUniqueViolation(err) {
+		return user.Nil, user.ErrMailExists
+	}
+	if err != nil {
+		return user.Nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return user.Nil, err
+	}
+	if n == 0 {
+		// tell a missing user apart from a stale one
+		_, err = r.User(ctx, u.Id)
+		if err != nil {
+			return user.Nil, err
+		}
+		return user.Nil, user.ErrConflict
+	}
+	u.Version++
+
+	return u, nil
+}
+
+func (r *sqlRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	res, err := r.conn(ctx).ExecContext(ctx, `UPDATE users SET deleted = 1, deleted_at = ?, version = version + 1, updated_at = ?
+		WHERE id = ?`, sqldb.Time(now), sqldb.Time(now), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) PurgeUsers(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	_, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM users WHERE id IN ("+sqldb.Placeholders(len(ids))+")", args...)
+
+	return err
+}
+
+func scanUser(row sqldb.Scanner) (user.User, error) {
+	var (
+		u                    user.User
+		createdAt, updatedAt int64
+		userType             string
+		deletedAt            sql.NullInt64
+		codes                sql.NullString
+		licenseStatus        string
+		reviewedAt           sql.NullInt64
+	)
+
+	err := row.Scan(&u.Id, &createdAt, &updatedAt, &u.Deleted, &u.Version, &userType, &u.Email, &u.EmailVerified, &u.PasswordHash,
+		&u.Name, &u.Surname, &u.Phone, &u.Address, &u.City, &u.State, &u.Country, &u.Zip,
+		&deletedAt, &u.TOTPSecret, &u.TOTPEnabled, &u.TOTPLastStep, &codes, &u.Disabled,
+		&u.LicenseNumber, &u.LicenseAuthority, &licenseStatus, &u.LicenseReviewedBy, &reviewedAt, &u.LicenseNote)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	u.CreatedAt = sqldb.ParseTime(createdAt)
+	u.UpdatedAt = sqldb.ParseTime(updatedAt)
+	u.DeletedAt = sqldb.ParseNullTime(deletedAt)
+	u.UserType = user.Type(userType)
+	u.LicenseStatus = user.LicenseStatus(licenseStatus)
+	u.LicenseReviewedAt = sqldb.ParseNullTime(reviewedAt)
+
+	err = sqldb.ParseJSON(codes, &u.RecoveryCodes)
+	if err != nil {
+		return user.Nil, err
+	}
+
+	return u, nil
+}
+
+// where returns the WHERE clause of the query and its bind parameters
+func (q Query) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	if q.Type != "" {
+		conditions = append(conditions, "user_type = ?")
+		args = append(args, string(q.Type))
+	}
+
+	if text := strings.ToLower(strings.TrimSpace(q.Text)); text != "" {
+		conditions = append(conditions,
+			`(LOWER(email) LIKE ? ESCAPE '\' OR LOWER(name || ' ' || surname) LIKE ? ESCAPE '\')`)
+		pattern := "%" + likeEscaper.Replace(text) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	if !q.IncludeDel {
+		conditions = append(conditions, "deleted = 0")
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// likeEscaper escapes the LIKE wildcards, so that they match themselves
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
@@ -0,0 +1,114 @@
+package usertokenrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/scarlettmiss/petJournal/application/domain/usertoken"
+	"github.com/scarlettmiss/petJournal/repositories/transaction"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mux    sync.RWMutex
+	tokens map[uuid.UUID]usertoken.Token
+}
+
+// NewMemory returns a thread-safe Repository that keeps every token in memory.
+// It is meant for local development and tests where no database is available.
+func NewMemory() Repository {
+	return &memoryRepository{
+		tokens: make(map[uuid.UUID]usertoken.Token),
+	}
+}
+
+func (r *memoryRepository) CreateToken(ctx context.Context, t usertoken.Token) (usertoken.Token, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return usertoken.Nil, err
+	}
+	t.Id = id
+	t.CreatedAt = time.Now()
+
+	r.remember(ctx, t.Id)
+	r.tokens[t.Id] = t
+
+	return t, nil
+}
+
+func (r *memoryRepository) TokenByHash(ctx context.Context, purpose usertoken.Purpose, hash string) (usertoken.Token, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	for _, t := range r.tokens {
+		if t.Purpose == purpose && t.Hash == hash {
+			return t, nil
+		}
+	}
+
+	return usertoken.Nil, usertoken.ErrNotFound
+}
+
+func (r *memoryRepository) UseToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	t, ok := r.tokens[id]
+	if !ok || !t.UsedAt.IsZero() {
+		return usertoken.ErrUsed
+	}
+
+	t.UsedAt = at
+	r.remember(ctx, id)
+	r.tokens[id] = t
+
+	return nil
+}
+
+func (r *memoryRepository) DeleteUserTokens(ctx context.Context, userId uuid.UUID, purpose usertoken.Purpose) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for id, t := range r.tokens {
+		if t.UserId == userId && t.Purpose == purpose {
+			r.remember(ctx, id)
+			delete(r.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) PurgeTokens(ctx context.Context, userIds []uuid.UUID, expiredBefore time.Time) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for id, t := range r.tokens {
+		if lo.Contains(userIds, t.UserId) || t.ExpiresAt.Before(expiredBefore) {
+			r.remember(ctx, id)
+			delete(r.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+// remember registers the current state of the token to be restored if the
+// transaction in ctx is rolled back. Callers must hold the lock.
+func (r *memoryRepository) remember(ctx context.Context, id uuid.UUID) {
+	old, ok := r.tokens[id]
+	transaction.OnRollback(ctx, func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if ok {
+			r.tokens[id] = old
+		} else {
+			delete(r.tokens, id)
+		}
+	})
+}
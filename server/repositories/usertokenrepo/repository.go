@@ -0,0 +1,133 @@
+package usertokenrepo
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/usertoken"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type TokenDBModel struct {
+	Id        uuid.UUID         `bson:"_id"`
+	CreatedAt time.Time         `bson:"created_at"`
+	UserId    uuid.UUID         `bson:"user_id"`
+	Purpose   usertoken.Purpose `bson:"purpose"`
+	Hash      string            `bson:"hash"`
+	ExpiresAt time.Time         `bson:"expires_at"`
+	UsedAt    time.Time         `bson:"used_at,omitempty"`
+}
+
+func ConvertToTokenDBModel(t usertoken.Token) TokenDBModel {
+	return TokenDBModel{
+		Id:        t.Id,
+		CreatedAt: t.CreatedAt,
+		UserId:    t.UserId,
+		Purpose:   t.Purpose,
+		Hash:      t.Hash,
+		ExpiresAt: t.ExpiresAt,
+		UsedAt:    t.UsedAt,
+	}
+}
+
+func ConvertToTokenDomainModel(dbToken TokenDBModel) usertoken.Token {
+	return usertoken.Token{
+		Id:        dbToken.Id,
+		CreatedAt: dbToken.CreatedAt,
+		UserId:    dbToken.UserId,
+		Purpose:   dbToken.Purpose,
+		Hash:      dbToken.Hash,
+		ExpiresAt: dbToken.ExpiresAt,
+		UsedAt:    dbToken.UsedAt,
+	}
+}
+
+type Repository interface {
+	CreateToken(ctx context.Context, t usertoken.Token) (usertoken.Token, error)
+	TokenByHash(ctx context.Context, purpose usertoken.Purpose, hash string) (usertoken.Token, error)
+	// UseToken marks the token as used. It fails with usertoken.ErrUsed if it
+	// already was.
+	UseToken(ctx context.Context, id uuid.UUID, at time.Time) error
+	DeleteUserTokens(ctx context.Context, userId uuid.UUID, purpose usertoken.Purpose) error
+	// PurgeTokens deletes the tokens of the users and the tokens that expired
+	// before the given time
+	PurgeTokens(ctx context.Context, userIds []uuid.UUID, expiredBefore time.Time) error
+}
+
+type repository struct {
+	tokens *mongo.Collection
+}
+
+func New(collection *mongo.Collection) Repository {
+	return &repository{
+		tokens: collection,
+	}
+}
+
+func (r *repository) CreateToken(ctx context.Context, t usertoken.Token) (usertoken.Token, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return usertoken.Nil, err
+	}
+	t.Id = id
+	t.CreatedAt = time.Now()
+
+	dbToken, err := bson.Marshal(ConvertToTokenDBModel(t))
+	if err != nil {
+		return usertoken.Nil, err
+	}
+
+	_, err = r.tokens.InsertOne(ctx, dbToken)
+	if err != nil {
+		return usertoken.Nil, err
+	}
+
+	return t, nil
+}
+
+func (r *repository) TokenByHash(ctx context.Context, purpose usertoken.Purpose, hash string) (usertoken.Token, error) {
+	var t TokenDBModel
+
+	err := r.tokens.FindOne(ctx, bson.M{"purpose": purpose, "hash": hash}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return usertoken.Nil, usertoken.ErrNotFound
+	}
+	if err != nil {
+		return usertoken.Nil, err
+	}
+
+	return ConvertToTokenDomainModel(t), nil
+}
+
+func (r *repository) UseToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	filter := bson.M{"_id": id, "used_at": bson.M{"$exists": false}}
+
+	res, err := r.tokens.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used_at": at}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return usertoken.ErrUsed
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteUserTokens(ctx context.Context, userId uuid.UUID, purpose usertoken.Purpose) error {
+	_, err := r.tokens.DeleteMany(ctx, bson.M{"user_id": userId, "purpose": purpose})
+
+	return err
+}
+
+func (r *repository) PurgeTokens(ctx context.Context, userIds []uuid.UUID, expiredBefore time.Time) error {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"user_id": bson.M{"$in": userIds}},
+		bson.M{"expires_at": bson.M{"$lt": expiredBefore}},
+	}}
+
+	_, err := r.tokens.DeleteMany(ctx, filter)
+
+	return err
+}
@@ -0,0 +1,130 @@
+package usertokenrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/scarlettmiss/petJournal/application/domain/usertoken"
+	"github.com/scarlettmiss/petJournal/repositories/sqldb"
+	"time"
+)
+
+var tokenColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"created_at INTEGER NOT NULL",
+	"user_id TEXT NOT NULL",
+	"purpose TEXT NOT NULL",
+	"hash TEXT NOT NULL UNIQUE",
+	"expires_at INTEGER NOT NULL",
+	"used_at INTEGER",
+}
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQL returns a Repository that stores tokens in the user_tokens table of
+// db, creating the table if needed.
+func NewSQL(db *sql.DB) (Repository, error) {
+	err := sqldb.EnsureTable(db, "user_tokens", tokenColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqldb.EnsureIndex(db, "user_tokens", "user_id")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRepository{db: db}, nil
+}
+
+// conn returns the transaction in ctx, if any, or the database
+func (r *sqlRepository) conn(ctx context.Context) sqldb.Querier {
+	return sqldb.Conn(ctx, r.db)
+}
+
+func (r *sqlRepository) CreateToken(ctx context.Context, t usertoken.Token) (usertoken.Token, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return usertoken.Nil, err
+	}
+	t.Id = id
+	t.CreatedAt = time.Now()
+
+	_, err = r.conn(ctx).ExecContext(ctx, `INSERT INTO user_tokens (id, created_at, user_id, purpose, hash,
+		expires_at, used_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.Id, sqldb.Time(t.CreatedAt), t.UserId, string(t.Purpose), t.Hash, sqldb.Time(t.ExpiresAt),
+		sqldb.NullTime(t.UsedAt))
+	if err != nil {
+		return usertoken.Nil, err
+	}
+
+	return t, nil
+}
+
+func (r *sqlRepository) TokenByHash(ctx context.Context, purpose usertoken.Purpose, hash string) (usertoken.Token, error) {
+	var (
+		t                    usertoken.Token
+		p                    string
+		createdAt, expiresAt int64
+		usedAt               sql.NullInt64
+	)
+
+	err := r.conn(ctx).QueryRowContext(ctx, `SELECT id, created_at, user_id, purpose, hash, expires_at, used_at
+		FROM user_tokens WHERE purpose = ? AND hash = ?`, string(purpose), hash).Scan(&t.Id, &createdAt, &t.UserId,
+		&p, &t.Hash, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return usertoken.Nil, usertoken.ErrNotFound
+	}
+	if err != nil {
+		return usertoken.Nil, err
+	}
+
+	t.Purpose = usertoken.Purpose(p)
+	t.CreatedAt = sqldb.ParseTime(createdAt)
+	t.ExpiresAt = sqldb.ParseTime(expiresAt)
+	t.UsedAt = sqldb.ParseNullTime(usedAt)
+
+	return t, nil
+}
+
+func (r *sqlRepository) UseToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE user_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL",
+		sqldb.Time(at), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return usertoken.ErrUsed
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) DeleteUserTokens(ctx context.Context, userId uuid.UUID, purpose usertoken.Purpose) error {
+	_, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?",
+		userId, string(purpose))
+
+	return err
+}
+
+func (r *sqlRepository) PurgeTokens(ctx context.Context, userIds []uuid.UUID, expiredBefore time.Time) error {
+	args := []any{sqldb.Time(expiredBefore)}
+	query := "DELETE FROM user_tokens WHERE expires_at < ?"
+	if len(userIds) > 0 {
+		for _, id := range userIds {
+			args = append(args, id)
+		}
+		query += " OR user_id IN (" + sqldb.Placeholders(len(userIds)) + ")"
+	}
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, args...)
+
+	return err
+}
@@ -0,0 +1,109 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"sort"
+	"sync/atomic"
+)
+
+// Keyring signs tokens with one key and verifies them with any of its keys, so
+// that the tokens signed with a retired key stay valid until they expire
+type Keyring struct {
+	signing Key
+	keys    map[string]Key
+}
+
+// NewKeyring returns a keyring that signs with signing and also accepts the
+// tokens signed with the verifying keys
+func NewKeyring(signing Key, verifying ...Key) (*Keyring, error) {
+	if signing.signKey == nil {
+		return nil, errors.New("the signing key must be a private key")
+	}
+
+	keys := map[string]Key{signing.Id: signing}
+	for _, k := range verifying {
+		if _, ok := keys[k.Id]; ok {
+			return nil, fmt.Errorf("key %s is in the keyring twice", k.Id)
+		}
+		keys[k.Id] = k
+	}
+
+	return &Keyring{signing: signing, keys: keys}, nil
+}
+
+// errNoKeyring is returned until Use is called, so that no token is ever
+// signed with a key that was not configured
+var errNoKeyring = errors.New("no keyring to sign and verify the tokens with")
+
+// keyring is the keyring that the tokens are signed and verified with
+var keyring atomic.Pointer[Keyring]
+
+// Use makes the tokens signed and verified with r from now on
+func Use(r *Keyring) {
+	keyring.Store(r)
+}
+
+// PublicKeys returns the keys that the services verifying the tokens need.
+// Secret keys are left out.
+func PublicKeys() JWKS {
+	return keyring.Load().JWKS()
+}
+
+// JWKS returns the public keys of the keyring, the signing key first
+func (r *Keyring) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	if r == nil {
+		return jwks
+	}
+
+	for _, k := range r.keys {
+		if k.public() {
+			jwks.Keys = append(jwks.Keys, k.jwk())
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		if jwks.Keys[i].Kid == r.signing.Id || jwks.Keys[j].Kid == r.signing.Id {
+			return jwks.Keys[i].Kid == r.signing.Id
+		}
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
+
+func (r *Keyring) sign(claims jwt.Claims) (string, error) {
+	if r == nil {
+		return "", errNoKeyring
+	}
+
+	token := jwt.NewWithClaims(r.signing.Method, claims)
+	token.Header["kid"] = r.signing.Id
+	return token.SignedString(r.signing.signKey)
+}
+
+func (r *Keyring) parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	if r == nil {
+		return nil, errNoKeyring
+	}
+
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = SecretKeyId
+		}
+
+		k, ok := r.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key: %q", kid)
+		}
+		// the algorithm is the key's, never the one the token claims
+		if token.Method.Alg() != k.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return k.verifyKey, nil
+	})
+}
@@ -0,0 +1,148 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+)
+
+// SecretKeyId is the kid of the HS256 key. Tokens without a kid, issued before
+// the keyring, are verified with it.
+const SecretKeyId = "secret"
+
+// minRSABits is the size below which RSA keys are refused
+const minRSABits = 2048
+
+// Key is a key that tokens are signed or verified with
+type Key struct {
+	// Id is the kid header of the tokens signed with the key. It is the JWK
+	// thumbprint of the asymmetric keys.
+	Id     string
+	Method jwt.SigningMethod
+	// signKey is nil for the keys that only verify tokens
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewSecretKey returns the HS256 key of the secret. Secret keys are never
+// published, so only this server can verify the tokens signed with them.
+func NewSecretKey(secret []byte) Key {
+	return Key{
+		Id:        SecretKeyId,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// ParseKey returns the Ed25519 (EdDSA) or RSA (RS256) key in the PEM data. A
+// private key signs and verifies tokens, a public one only verifies them.
+func ParseKey(data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("no PEM encoded key found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	var k Key
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		k = Key{Method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()}
+	case ed25519.PublicKey:
+		k = Key{Method: jwt.SigningMethodEdDSA, verifyKey: key}
+	case *rsa.PrivateKey:
+		k = Key{Method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey}
+	case *rsa.PublicKey:
+		k = Key{Method: jwt.SigningMethodRS256, verifyKey: key}
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %T, use an Ed25519 or RSA key", key)
+	}
+
+	if pub, ok := k.verifyKey.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSABits {
+		return Key{}, fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+	}
+
+	k.Id = thumbprint(k.jwk())
+
+	return k, nil
+}
+
+// JWK is the public half of a key, as published in a JWKS
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// Crv and X are the curve and the public key of the OKP keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	// N and E are the modulus and the exponent of the RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517)
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk returns the JWK of the key, which is only meaningful for asymmetric keys
+func (k Key) jwk() JWK {
+	jwk := JWK{Kid: k.Id, Alg: k.Method.Alg(), Use: "sig"}
+
+	switch pub := k.verifyKey.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+
+	return jwk
+}
+
+// public returns whether the key can be published
+func (k Key) public() bool {
+	_, ok := k.verifyKey.([]byte)
+	return !ok
+}
+
+// thumbprint returns the JWK thumbprint (RFC 7638) of an OKP or RSA key
+func thumbprint(jwk JWK) string {
+	var members string
+	if jwk.Kty == "OKP" {
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Crv, jwk.Kty, jwk.X)
+	} else {
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, jwk.E, jwk.Kty, jwk.N)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -5,37 +5,105 @@ import (
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"github.com/scarlettmiss/petJournal/application/domain/user"
-	"os"
 	"time"
 )
 
-var jwtKey = []byte(os.Getenv("SECRET_KEY"))
-
+// JWTClaim is the claim of the access tokens. The Subject is the id of the user
+// too, for the services that verify the tokens.
 type JWTClaim struct {
 	UserId   uuid.UUID
 	UserType user.Type
+	// SessionId is the family of the refresh token issued with the token
+	SessionId uuid.UUID
 	jwt.StandardClaims
 }
 
-func GenerateJWT(userId uuid.UUID, userType user.Type) (string, error) {
-	expirationTime := time.Now().Add(1 * time.Hour)
+func GenerateJWT(userId uuid.UUID, userType user.Type, sessionId uuid.UUID, expiresAt time.Time) (string, error) {
 	claims := JWTClaim{
-		UserId:   userId,
-		UserType: userType,
+		UserId:    userId,
+		UserType:  userType,
+		SessionId: sessionId,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.UnixMilli(),
+			Subject:   userId.String(),
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiresAt.Unix(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return keyring.Load().sign(claims)
 }
 
-func ValidateToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(jwtKey), nil
-	})
+// The purposes of the tokens handed out by email or to finish a login. A token
+// is only accepted for its purpose, and never as an access token.
+const (
+	emailVerification = "email_verification"
+	loginChallenge    = "login_challenge"
+)
+
+// PurposeClaim is the claim of the tokens issued for a single purpose. The
+// Subject is the id of the user.
+type PurposeClaim struct {
+	Email   string
+	Purpose string
+	jwt.StandardClaims
+}
+
+// GenerateVerificationJWT returns a token that proves that whoever holds it
+// received the emails sent to email
+func GenerateVerificationJWT(userId uuid.UUID, email string, expiresAt time.Time) (string, error) {
+	return generatePurposeJWT(emailVerification, userId, email, expiresAt)
+}
+
+// ValidateVerificationToken returns the user id and the email of a token
+// generated by GenerateVerificationJWT
+func ValidateVerificationToken(tokenString string) (uuid.UUID, string, error) {
+	return validatePurposeToken(emailVerification, tokenString)
+}
+
+// GenerateChallengeJWT returns a token that proves that the user passed the
+// first step of a login
+func GenerateChallengeJWT(userId uuid.UUID, expiresAt time.Time) (string, error) {
+	return generatePurposeJWT(loginChallenge, userId, "", expiresAt)
+}
+
+// ValidateChallengeToken returns the user id of a token generated by
+// GenerateChallengeJWT
+func ValidateChallengeToken(tokenString string) (uuid.UUID, error) {
+	userId, _, err := validatePurposeToken(loginChallenge, tokenString)
+	return userId, err
+}
 
+func generatePurposeJWT(purpose string, userId uuid.UUID, email string, expiresAt time.Time) (string, error) {
+	claims := PurposeClaim{
+		Email:   email,
+		Purpose: purpose,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   userId.String(),
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+	return keyring.Load().sign(claims)
+}
+
+func validatePurposeToken(purpose string, tokenString string) (uuid.UUID, string, error) {
+	var claims PurposeClaim
+	_, err := keyring.Load().parse(tokenString, &claims)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	if claims.Purpose != purpose {
+		return uuid.Nil, "", fmt.Errorf("unexpected token purpose: %q", claims.Purpose)
+	}
+
+	userId, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	return userId, claims.Email, nil
+}
+
+func ValidateToken(tokenString string) (*jwt.Token, error) {
+	return keyring.Load().parse(tokenString, jwt.MapClaims{})
 }